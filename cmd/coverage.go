@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/brendanryan/gmail-brita/internal/coverage"
+	"github.com/brendanryan/gmail-brita/internal/simulate"
+)
+
+// runCoverage reports how a filter set covers a corpus of sample mail
+func runCoverage(args []string) error {
+	var (
+		configFile string
+		format     string
+	)
+
+	fs := newFlagSet("coverage")
+	fs.StringVar(&configFile, "config", "", "Path to YAML config file or Gmail filter export (.xml)")
+	fs.StringVar(&format, "format", "text", "Output format: text or json")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: gmail-brita coverage [flags] PATH...")
+		fmt.Fprintln(os.Stderr, "\nEach PATH is a Maildir, an mbox file, a message file or a directory of them.")
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if err := requireFlag(fs, configFile, "config file"); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "Error: at least one path is required")
+		fs.Usage()
+		return errUsage
+	}
+	if format != "text" && format != "json" {
+		return fmt.Errorf("unknown format %q", format)
+	}
+
+	set, err := loadFilterSet(configFile)
+	if err != nil {
+		return err
+	}
+
+	var messages []*simulate.Message
+	for _, path := range fs.Args() {
+		found, skipped, err := simulate.ReadPath(path)
+		if err != nil {
+			return fmt.Errorf("reading messages: %w", err)
+		}
+		for _, e := range skipped {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", e)
+		}
+		messages = append(messages, found...)
+	}
+
+	report, err := coverage.Analyze(set, messages)
+	if err != nil {
+		return fmt.Errorf("analyzing coverage: %w", err)
+	}
+
+	if format == "json" {
+		err = report.WriteJSON(os.Stdout)
+	} else {
+		err = report.WriteText(os.Stdout)
+	}
+	if err != nil {
+		return fmt.Errorf("writing report: %w", err)
+	}
+	return nil
+}
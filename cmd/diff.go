@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/brendanryan/gmail-brita/internal/config"
+	"github.com/brendanryan/gmail-brita/internal/diff"
+	"github.com/brendanryan/gmail-brita/internal/filter"
+	"github.com/brendanryan/gmail-brita/pkg/britta"
+)
+
+// runDiff reports the semantic differences between two filter sets
+func runDiff(args []string) error {
+	var (
+		format   string
+		exitCode bool
+	)
+
+	fs := newFlagSet("diff")
+	fs.StringVar(&format, "format", "text", "Output format: text or json")
+	fs.BoolVar(&exitCode, "exit-code", false, "Exit with status 1 when the filter sets differ")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: gmail-brita diff [flags] OLD NEW")
+		fmt.Fprintln(os.Stderr, "\nOLD and NEW are YAML configs or Gmail filter exports (.xml).")
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, "Error: two filter sets are required")
+		fs.Usage()
+		return errUsage
+	}
+	if format != "text" && format != "json" {
+		return fmt.Errorf("unknown format %q", format)
+	}
+
+	oldSet, err := loadFilterSet(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	newSet, err := loadFilterSet(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	report, err := diff.Compare(oldSet, newSet)
+	if err != nil {
+		return fmt.Errorf("comparing filters: %w", err)
+	}
+
+	if format == "json" {
+		err = report.WriteJSON(os.Stdout)
+	} else {
+		err = report.WriteText(os.Stdout)
+	}
+	if err != nil {
+		return fmt.Errorf("writing report: %w", err)
+	}
+
+	if exitCode && !report.Empty() {
+		return errFailed
+	}
+	return nil
+}
+
+// loadFilterSet loads a filter set from a Gmail export or a YAML config,
+// depending on the file extension
+func loadFilterSet(path string) (*filter.Set, error) {
+	if strings.EqualFold(filepath.Ext(path), ".xml") {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading export: %w", err)
+		}
+		set, err := filter.ParseXML(data)
+		if err != nil {
+			return nil, fmt.Errorf("loading %s: %w", path, err)
+		}
+		return set, nil
+	}
+
+	cfg, err := config.LoadFromFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("loading config: %w", err)
+	}
+	set, err := britta.Build(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("building filters: %w", err)
+	}
+	return set, nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brendanryan/gmail-brita/internal/config"
+	"github.com/brendanryan/gmail-brita/internal/filter"
+	"github.com/brendanryan/gmail-brita/internal/gmail"
+	"github.com/brendanryan/gmail-brita/pkg/britta"
+	"github.com/brendanryan/gmail-brita/pkg/render"
+)
+
+// runGenerate converts a YAML config into Gmail filter XML or another
+// registered output format
+func runGenerate(args []string) error {
+	var (
+		configFile string
+		outputFile string
+		timestamp  string
+		limits     string
+		format     string
+		labelIDs   string
+		account    string
+		optimize   bool
+	)
+
+	fs := newFlagSet("generate")
+	fs.StringVar(&configFile, "config", "", "Path to YAML config file")
+	fs.StringVar(&outputFile, "out", "", "Path to output file")
+	fs.StringVar(&format, "format", "", "Output format: "+strings.Join(render.Names(), ", ")+" (defaults to the one matching the output file's extension, then xml)")
+	fs.StringVar(&timestamp, "timestamp", "", "RFC 3339 timestamp to write instead of the current time (defaults to $SOURCE_DATE_EPOCH)")
+	fs.StringVar(&labelIDs, "label-ids", "", "JSON file mapping label names to Gmail label IDs for the gmail-json format, either an object or a labels.list response")
+	fs.StringVar(&account, "imap-account", "", "IMAP account URI whose folders the thunderbird format files into, such as imap://me%40gmail.com@imap.gmail.com")
+	fs.StringVar(&limits, "limits", "", "What to do with filters over Gmail's limits: warn, fail or split (defaults to the config's limits key, then warn)")
+	fs.BoolVar(&optimize, "optimize", false, "Merge filters with the same actions and drop duplicates")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if err := requireFlag(fs, configFile, "config file"); err != nil {
+		return err
+	}
+	if err := requireFlag(fs, outputFile, "output file"); err != nil {
+		return err
+	}
+
+	// Load configuration
+	cfg, diags, err := config.Load(configFile)
+	if err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+	if diags.HasErrors() {
+		return fmt.Errorf("loading config: invalid config: %w", diags.Errors())
+	}
+	printWarnings(diags)
+	renderer, err := outputRenderer(format, outputFile)
+	if err != nil {
+		return err
+	}
+	if labelIDs != "" {
+		if _, ok := renderer.(render.GmailAPI); !ok {
+			return fmt.Errorf("-label-ids only applies to the %s format", render.GmailJSON)
+		}
+		ids, err := readLabelIDs(labelIDs)
+		if err != nil {
+			return err
+		}
+		renderer = render.GmailAPI{LabelIDs: ids}
+	}
+	if account != "" {
+		if _, ok := renderer.(render.ThunderbirdFilters); !ok {
+			return fmt.Errorf("-imap-account only applies to the %s format", render.Thunderbird)
+		}
+		renderer = render.ThunderbirdFilters{Account: account}
+	}
+	if err := applyTimestamp(cfg, timestamp); err != nil {
+		return err
+	}
+
+	if limits != "" {
+		if _, err := filter.ParseLimitPolicy(limits); err != nil {
+			return err
+		}
+		cfg.Limits = limits
+	}
+
+	// Generate the output
+	set, err := britta.Build(cfg)
+	if err != nil {
+		return fmt.Errorf("generating filters: %w", err)
+	}
+	if optimize {
+		fmt.Fprintln(os.Stderr, set.Optimize())
+	}
+	if w, ok := renderer.(render.Warner); ok {
+		for _, e := range w.Warnings(set) {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", e)
+		}
+	}
+	output, err := renderer.Render(set)
+	if err != nil {
+		return fmt.Errorf("generating %s: %w", renderer.Name(), err)
+	}
+
+	// Write output
+	if err := os.WriteFile(outputFile, output, 0600); err != nil {
+		return fmt.Errorf("writing output: %w", err)
+	}
+
+	return nil
+}
+
+// outputRenderer picks the renderer named by the -format flag or, failing
+// that, the one matching the output file's extension
+func outputRenderer(format, outputFile string) (render.Renderer, error) {
+	if format != "" {
+		r, ok := render.Lookup(format)
+		if !ok {
+			return nil, fmt.Errorf("unknown format %q, want one of %s", format, strings.Join(render.Names(), ", "))
+		}
+		return r, nil
+	}
+	if r, ok := render.ForExtension(filepath.Ext(outputFile)); ok {
+		return r, nil
+	}
+	r, _ := render.Lookup(render.XML)
+	return r, nil
+}
+
+// readLabelIDs reads the file given to -label-ids
+func readLabelIDs(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading label IDs: %w", err)
+	}
+	defer f.Close()
+	return gmail.ReadLabelIDs(f)
+}
+
+// applyTimestamp overrides the config's timestamp from the -timestamp flag
+// or, failing that, the SOURCE_DATE_EPOCH environment variable
+func applyTimestamp(cfg *config.Config, flagValue string) error {
+	if flagValue != "" {
+		t, err := time.Parse(time.RFC3339, flagValue)
+		if err != nil {
+			return fmt.Errorf("invalid timestamp: %w", err)
+		}
+		cfg.Timestamp = t
+		return nil
+	}
+
+	if epoch := os.Getenv("SOURCE_DATE_EPOCH"); epoch != "" {
+		seconds, err := strconv.ParseInt(epoch, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid SOURCE_DATE_EPOCH: %w", err)
+		}
+		cfg.Timestamp = time.Unix(seconds, 0).UTC()
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/brendanryan/gmail-brita/internal/config"
+	"github.com/brendanryan/gmail-brita/pkg/britta"
+)
+
+// runImport converts a Gmail filter export into a YAML config
+func runImport(args []string) error {
+	var (
+		inputFile  string
+		outputFile string
+	)
+
+	fs := newFlagSet("import")
+	fs.StringVar(&inputFile, "in", "", "Path to Gmail filter export (mailFilters.xml)")
+	fs.StringVar(&outputFile, "out", "", "Path to output YAML config file")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if err := requireFlag(fs, inputFile, "input file"); err != nil {
+		return err
+	}
+	if err := requireFlag(fs, outputFile, "output file"); err != nil {
+		return err
+	}
+
+	// Read export
+	data, err := os.ReadFile(inputFile)
+	if err != nil {
+		return fmt.Errorf("reading export: %w", err)
+	}
+
+	// Convert filters
+	cfg, err := britta.ImportXML(data)
+	if err != nil {
+		return fmt.Errorf("importing filters: %w", err)
+	}
+
+	// Write config
+	if err := config.SaveToFile(outputFile, cfg); err != nil {
+		return fmt.Errorf("writing config: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/brendanryan/gmail-brita/internal/lint"
+)
+
+// runLint reports filters that duplicate, contradict or make each other
+// redundant
+func runLint(args []string) error {
+	var (
+		configFile string
+		format     string
+	)
+
+	fs := newFlagSet("lint")
+	fs.StringVar(&configFile, "config", "", "Path to YAML config file or Gmail filter export (.xml)")
+	fs.StringVar(&format, "format", "text", "Output format: text or json")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if err := requireFlag(fs, configFile, "config file"); err != nil {
+		return err
+	}
+	if format != "text" && format != "json" {
+		return fmt.Errorf("unknown format %q", format)
+	}
+
+	set, err := loadFilterSet(configFile)
+	if err != nil {
+		return err
+	}
+
+	report, err := lint.Run(set)
+	if err != nil {
+		return fmt.Errorf("linting filters: %w", err)
+	}
+
+	if format == "json" {
+		err = report.WriteJSON(os.Stdout)
+	} else {
+		err = report.WriteText(os.Stdout)
+	}
+	if err != nil {
+		return fmt.Errorf("writing report: %w", err)
+	}
+	if !report.Empty() {
+		return errFailed
+	}
+	return nil
+}
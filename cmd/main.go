@@ -1,53 +1,145 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"sort"
+	"strings"
+)
+
+// command is a gmail-brita subcommand
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+// commands lists the available subcommands by name
+var commands = map[string]command{
+	"generate": {
+		usage: "Generate Gmail filter XML from a YAML config",
+		run:   runGenerate,
+	},
+	"coverage": {
+		usage: "Report which filters match a corpus of sample mail",
+		run:   runCoverage,
+	},
+	"diff": {
+		usage: "Compare two filter sets by meaning",
+		run:   runDiff,
+	},
+	"import": {
+		usage: "Convert a Gmail filter export into a YAML config",
+		run:   runImport,
+	},
+	"lint": {
+		usage: "Report duplicate, conflicting and redundant filters",
+		run:   runLint,
+	},
+	"plan": {
+		usage: "Show the changes apply would make to managed Gmail filters",
+		run:   runPlan,
+	},
+	"apply": {
+		usage: "Carry out a plan and record the managed filters in a state file",
+		run:   runApply,
+	},
+	"push": {
+		usage: "Apply a config's labels and filters through the Gmail API",
+		run:   runPush,
+	},
+	"test": {
+		usage: "Run the tests defined in a YAML config",
+		run:   runTest,
+	},
+	"validate": {
+		usage: "Check a YAML config and report every problem found",
+		run:   runValidate,
+	},
+	"simulate": {
+		usage: "Show which filters match sample messages",
+		run:   runSimulate,
+	},
+}
+
+var (
+	// errUsage signals that a command was invoked incorrectly and has
+	// already printed its usage
+	errUsage = errors.New("invalid usage")
 
-	"github.com/brendanryan/gmail-brita/internal/config"
-	"github.com/brendanryan/gmail-brita/pkg/britta"
+	// errFailed signals a failure the command has already reported
+	errFailed = errors.New("failed")
 )
 
 func main() {
-	var (
-		configFile string
-		outputFile string
-	)
-
-	flag.StringVar(&configFile, "config", "", "Path to YAML config file")
-	flag.StringVar(&outputFile, "out", "", "Path to output XML file")
-	flag.Parse()
-
-	if configFile == "" {
-		fmt.Fprintln(os.Stderr, "Error: config file is required")
-		flag.Usage()
-		os.Exit(1)
+	args := os.Args[1:]
+
+	// Without a subcommand, behave like generate for compatibility
+	name := "generate"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
 	}
 
-	if outputFile == "" {
-		fmt.Fprintln(os.Stderr, "Error: output file is required")
-		flag.Usage()
-		os.Exit(1)
+	if name == "help" {
+		usage()
+		return
 	}
 
-	// Load configuration
-	cfg, err := config.LoadFromFile(configFile)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error: unknown command %q\n", name)
+		usage()
 		os.Exit(1)
 	}
 
-	// Generate XML
-	xml, err := britta.GenerateXML(cfg)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error generating XML: %v\n", err)
+	if err := cmd.run(args); err != nil {
+		if !errors.Is(err, errUsage) && !errors.Is(err, errFailed) {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
 		os.Exit(1)
 	}
+}
 
-	// Write output
-	if err := os.WriteFile(outputFile, xml, 0600); err != nil {
-		fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
-		os.Exit(1)
+// usage prints the list of subcommands
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(os.Stderr, "Usage: gmail-brita <command> [flags]")
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, commands[name].usage)
+	}
+}
+
+// newFlagSet creates the flag set for a subcommand
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: gmail-brita %s [flags]\n\n", name)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags parses a subcommand's flags, mapping parse failures to errUsage
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	return nil
+}
+
+// requireFlag reports a missing required flag and prints the usage
+func requireFlag(fs *flag.FlagSet, value, description string) error {
+	if value != "" {
+		return nil
 	}
+	fmt.Fprintf(os.Stderr, "Error: %s is required\n", description)
+	fs.Usage()
+	return errUsage
 }
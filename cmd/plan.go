@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/brendanryan/gmail-brita/internal/filter"
+	"github.com/brendanryan/gmail-brita/internal/gmail"
+)
+
+// defaultStateFile records which Gmail filters plan and apply manage
+const defaultStateFile = "gmail-brita.state.json"
+
+// runPlan shows the changes apply would make to the managed Gmail filters
+func runPlan(args []string) error {
+	var (
+		configFile  string
+		stateFile   string
+		currentFile string
+		outFile     string
+		api         apiFlags
+	)
+
+	fs := newFlagSet("plan")
+	fs.StringVar(&configFile, "config", "", "Path to YAML config file or Gmail filter export (.xml)")
+	fs.StringVar(&stateFile, "state", defaultStateFile, "Path to the state file recording managed filters")
+	fs.StringVar(&currentFile, "current", "", "Gmail filter export (.xml) to plan against instead of fetching filters through the API; such plans are for review and cannot be applied")
+	fs.StringVar(&outFile, "out", "", "Path to save the plan for apply")
+	api.register(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if err := requireFlag(fs, configFile, "config file"); err != nil {
+		return err
+	}
+	if currentFile == "" {
+		if err := requireFlag(fs, api.token, "access token or -current export"); err != nil {
+			return err
+		}
+	}
+
+	plan, err := makePlan(configFile, stateFile, currentFile, &api)
+	if err != nil {
+		return err
+	}
+	if err := plan.WriteText(os.Stdout); err != nil {
+		return fmt.Errorf("writing plan: %w", err)
+	}
+
+	if outFile != "" {
+		var b strings.Builder
+		if err := plan.WriteJSON(&b); err != nil {
+			return fmt.Errorf("writing plan: %w", err)
+		}
+		if err := os.WriteFile(outFile, []byte(b.String()), 0600); err != nil {
+			return fmt.Errorf("writing plan: %w", err)
+		}
+	}
+	return nil
+}
+
+// runApply carries out a saved plan, or a fresh one, and updates the state
+func runApply(args []string) error {
+	var (
+		configFile string
+		stateFile  string
+		planFile   string
+		api        apiFlags
+	)
+
+	fs := newFlagSet("apply")
+	fs.StringVar(&configFile, "config", "", "Path to YAML config file or Gmail filter export (.xml), when no -plan is given")
+	fs.StringVar(&stateFile, "state", defaultStateFile, "Path to the state file recording managed filters")
+	fs.StringVar(&planFile, "plan", "", "Plan saved by plan -out to carry out exactly")
+	api.register(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if planFile == "" {
+		if err := requireFlag(fs, configFile, "config file or -plan"); err != nil {
+			return err
+		}
+	}
+	if err := requireFlag(fs, api.token, "access token"); err != nil {
+		return err
+	}
+
+	var plan *gmail.Plan
+	if planFile != "" {
+		f, err := os.Open(planFile)
+		if err != nil {
+			return fmt.Errorf("reading plan: %w", err)
+		}
+		plan, err = gmail.ReadPlan(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	} else {
+		var err error
+		if plan, err = makePlan(configFile, stateFile, "", &api); err != nil {
+			return err
+		}
+		if err := plan.WriteText(os.Stdout); err != nil {
+			return fmt.Errorf("writing plan: %w", err)
+		}
+	}
+
+	state, err := gmail.LoadState(stateFile)
+	if err != nil {
+		return err
+	}
+	result, err := gmail.Apply(context.Background(), api.client(), plan, state)
+
+	// Record whatever was applied, even when an operation failed
+	if serr := state.Save(stateFile); serr != nil && err == nil {
+		err = serr
+	}
+	if result != nil {
+		for _, name := range result.CreatedLabels {
+			fmt.Printf("Created label %s\n", name)
+		}
+		fmt.Printf("Applied %d of %d operations\n", result.Applied, len(plan.Operations))
+	}
+	if err != nil {
+		return fmt.Errorf("applying plan: %w", err)
+	}
+	return nil
+}
+
+// makePlan compares the config with the current filters, read from an
+// export when currentFile is set and fetched through the API otherwise
+func makePlan(configFile, stateFile, currentFile string, api *apiFlags) (*gmail.Plan, error) {
+	set, err := loadFilterSet(configFile)
+	if err != nil {
+		return nil, err
+	}
+	desired, err := gmail.Desired(set)
+	if err != nil {
+		return nil, fmt.Errorf("building filters: %w", err)
+	}
+	state, err := gmail.LoadState(stateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var current []gmail.Filter
+	if currentFile != "" {
+		data, err := os.ReadFile(currentFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading export: %w", err)
+		}
+		export, err := filter.ParseXML(data)
+		if err != nil {
+			return nil, fmt.Errorf("loading %s: %w", currentFile, err)
+		}
+		current = gmail.CurrentFromExport(export)
+	} else {
+		current, err = gmail.Current(context.Background(), api.client())
+		if err != nil {
+			return nil, fmt.Errorf("fetching filters: %w", err)
+		}
+	}
+
+	plan := gmail.NewPlan(desired, current, state)
+	plan.FromExport = currentFile != ""
+	return plan, nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/brendanryan/gmail-brita/internal/gmail"
+)
+
+// apiFlags are the flags shared by the commands that call the Gmail API
+type apiFlags struct {
+	token    string
+	endpoint string
+}
+
+func (a *apiFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&a.token, "token", os.Getenv("GMAIL_ACCESS_TOKEN"), "OAuth access token with the gmail.settings.basic and gmail.labels scopes (defaults to $GMAIL_ACCESS_TOKEN)")
+	fs.StringVar(&a.endpoint, "endpoint", gmail.DefaultBaseURL, "Gmail API base URL for the user")
+}
+
+func (a *apiFlags) client() *gmail.Client {
+	return gmail.NewClient(&http.Client{Timeout: 30 * time.Second}, a.endpoint, a.token)
+}
+
+// runPush applies a filter set to a Gmail account through the Gmail API
+func runPush(args []string) error {
+	var (
+		configFile string
+		dryRun     bool
+		prune      bool
+		api        apiFlags
+	)
+
+	fs := newFlagSet("push")
+	fs.StringVar(&configFile, "config", "", "Path to YAML config file or Gmail filter export (.xml)")
+	api.register(fs)
+	fs.BoolVar(&dryRun, "dry-run", false, "Show the changes without making them")
+	fs.BoolVar(&prune, "prune", false, "Delete every Gmail filter that is not in the config, including filters made by hand")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if err := requireFlag(fs, configFile, "config file"); err != nil {
+		return err
+	}
+	if err := requireFlag(fs, api.token, "access token"); err != nil {
+		return err
+	}
+
+	set, err := loadFilterSet(configFile)
+	if err != nil {
+		return err
+	}
+
+	result, err := gmail.Push(context.Background(), api.client(), set, dryRun, prune)
+	if result != nil {
+		if werr := result.WriteText(os.Stdout); werr != nil && err == nil {
+			err = fmt.Errorf("writing result: %w", werr)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("pushing filters: %w", err)
+	}
+	return nil
+}
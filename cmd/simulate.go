@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/brendanryan/gmail-brita/internal/simulate"
+)
+
+// runSimulate reports which filters match sample messages and what they do
+func runSimulate(args []string) error {
+	var (
+		configFile string
+		format     string
+	)
+
+	fs := newFlagSet("simulate")
+	fs.StringVar(&configFile, "config", "", "Path to YAML config file or Gmail filter export (.xml)")
+	fs.StringVar(&format, "format", "text", "Output format: text or json")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: gmail-brita simulate [flags] MESSAGE...")
+		fmt.Fprintln(os.Stderr, "\nEach MESSAGE is an RFC 5322 message (.eml) or an mbox file.")
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if err := requireFlag(fs, configFile, "config file"); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "Error: at least one message is required")
+		fs.Usage()
+		return errUsage
+	}
+	if format != "text" && format != "json" {
+		return fmt.Errorf("unknown format %q", format)
+	}
+
+	set, err := loadFilterSet(configFile)
+	if err != nil {
+		return err
+	}
+	sim, err := simulate.New(set)
+	if err != nil {
+		return fmt.Errorf("preparing filters: %w", err)
+	}
+	for _, skipped := range sim.Skipped() {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", skipped)
+	}
+
+	results := make([]simulate.Result, 0, fs.NArg())
+	for _, path := range fs.Args() {
+		messages, unread, err := simulate.ReadPath(path)
+		if err != nil {
+			return fmt.Errorf("reading messages: %w", err)
+		}
+		for _, e := range unread {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", e)
+		}
+		for _, m := range messages {
+			results = append(results, sim.Run(m))
+		}
+	}
+
+	if format == "json" {
+		err = simulate.WriteJSON(os.Stdout, results)
+	} else {
+		err = simulate.WriteText(os.Stdout, results)
+	}
+	if err != nil {
+		return fmt.Errorf("writing results: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/brendanryan/gmail-brita/internal/config"
+	"github.com/brendanryan/gmail-brita/pkg/britta"
+)
+
+// runTest runs the tests defined in a YAML config against its filters
+func runTest(args []string) error {
+	var (
+		configFile string
+		strict     bool
+	)
+
+	fs := newFlagSet("test")
+	fs.StringVar(&configFile, "config", "", "Path to YAML config file")
+	fs.BoolVar(&strict, "strict", false, "Fail when a filter cannot be evaluated, such as one using is:unread")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if err := requireFlag(fs, configFile, "config file"); err != nil {
+		return err
+	}
+
+	cfg, err := config.LoadFromFile(configFile)
+	if err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+	if len(cfg.Tests) == 0 {
+		return fmt.Errorf("%s defines no tests", configFile)
+	}
+
+	results, skipped, err := britta.RunTests(cfg)
+	if err != nil {
+		return fmt.Errorf("running tests: %w", err)
+	}
+	for _, s := range skipped {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", s)
+	}
+	if err := britta.WriteTestResults(os.Stdout, results); err != nil {
+		return fmt.Errorf("writing results: %w", err)
+	}
+
+	for _, r := range results {
+		if !r.Passed() {
+			return errFailed
+		}
+	}
+	if strict && len(skipped) > 0 {
+		return errFailed
+	}
+	return nil
+}
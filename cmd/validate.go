@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/brendanryan/gmail-brita/internal/config"
+)
+
+// runValidate reports every diagnostic found in a YAML config
+func runValidate(args []string) error {
+	var (
+		configFile string
+		format     string
+		strict     bool
+	)
+
+	fs := newFlagSet("validate")
+	fs.StringVar(&configFile, "config", "", "Path to YAML config file")
+	fs.StringVar(&format, "format", "text", "Output format: text or json")
+	fs.BoolVar(&strict, "strict", false, "Exit with status 1 on warnings as well as errors")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if err := requireFlag(fs, configFile, "config file"); err != nil {
+		return err
+	}
+	if format != "text" && format != "json" {
+		return fmt.Errorf("unknown format %q", format)
+	}
+
+	_, diags, err := config.Load(configFile)
+	if err != nil {
+		return err
+	}
+
+	if format == "json" {
+		if diags == nil {
+			diags = config.Diagnostics{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(diags); err != nil {
+			return fmt.Errorf("writing diagnostics: %w", err)
+		}
+	} else {
+		for _, d := range diags {
+			fmt.Println(d.Error())
+		}
+		fmt.Printf("%d errors, %d warnings\n", len(diags.Errors()), len(diags.Warnings()))
+	}
+
+	if diags.HasErrors() || (strict && len(diags) > 0) {
+		return errFailed
+	}
+	return nil
+}
+
+// printWarnings reports a config's warnings on stderr
+func printWarnings(diags config.Diagnostics) {
+	for _, d := range diags.Warnings() {
+		fmt.Fprintln(os.Stderr, d.Error())
+	}
+}
@@ -68,10 +68,10 @@ func ExampleFilters() *config.Config {
 			{
 				Name: "Family Emails",
 				Conditions: config.Conditions{
-					Has: []string{
-						"from:mom@example.com",
-						"from:dad@example.com",
-						"from:sister@example.com",
+					Any: []config.Condition{
+						{Term: "from:mom@example.com"},
+						{Term: "from:dad@example.com"},
+						{Term: "from:sister@example.com"},
 					},
 				},
 				Actions: config.Actions{
@@ -98,10 +98,10 @@ func ExampleFilters() *config.Config {
 			{
 				Name: "Social Updates",
 				Conditions: config.Conditions{
-					Has: []string{
-						"from:notifications@twitter.com",
-						"from:notification@linkedin.com",
-						"from:notification@facebook.com",
+					Any: []config.Condition{
+						{Term: "from:notifications@twitter.com"},
+						{Term: "from:notification@linkedin.com"},
+						{Term: "from:notification@facebook.com"},
 					},
 					HasNot: []string{
 						"subject:\"Security alert\"",
@@ -119,12 +119,12 @@ func ExampleFilters() *config.Config {
 			{
 				Name: "Shopping",
 				Conditions: config.Conditions{
-					Has: []string{
-						"from:amazon.com",
-						"from:orders@*.com",
-						"subject:\"order confirmation\"",
-						"subject:\"tracking number\"",
-						"subject:\"shipped\"",
+					Any: []config.Condition{
+						{Term: "from:amazon.com"},
+						{Term: "from:orders@*.com"},
+						{Term: "subject:\"order confirmation\""},
+						{Term: "subject:\"tracking number\""},
+						{Term: "subject:\"shipped\""},
 					},
 				},
 				Actions: config.Actions{
@@ -136,10 +136,10 @@ func ExampleFilters() *config.Config {
 			{
 				Name: "Calendar",
 				Conditions: config.Conditions{
-					Has: []string{
-						"filename:invite.ics",
-						"subject:\"invited you to\"",
-						"subject:\"calendar invitation\"",
+					Any: []config.Condition{
+						{Term: "filename:invite.ics"},
+						{Term: "subject:\"invited you to\""},
+						{Term: "subject:\"calendar invitation\""},
 					},
 				},
 				Actions: config.Actions{
@@ -151,11 +151,11 @@ func ExampleFilters() *config.Config {
 			{
 				Name: "Promotions",
 				Conditions: config.Conditions{
-					Has: []string{
-						"subject:\"% off\"",
-						"subject:\"sale\"",
-						"subject:\"deal\"",
-						"subject:\"limited time\"",
+					Any: []config.Condition{
+						{Term: "subject:\"% off\""},
+						{Term: "subject:\"sale\""},
+						{Term: "subject:\"deal\""},
+						{Term: "subject:\"limited time\""},
 					},
 					HasNot: []string{
 						"from:important-sender@example.com",
@@ -172,13 +172,13 @@ func ExampleFilters() *config.Config {
 			{
 				Name: "Travel",
 				Conditions: config.Conditions{
-					Has: []string{
-						"subject:\"itinerary\"",
-						"subject:\"booking confirmation\"",
-						"subject:\"flight confirmation\"",
-						"subject:\"hotel reservation\"",
-						"from:*@airlines.com",
-						"from:*@hotels.com",
+					Any: []config.Condition{
+						{Term: "subject:\"itinerary\""},
+						{Term: "subject:\"booking confirmation\""},
+						{Term: "subject:\"flight confirmation\""},
+						{Term: "subject:\"hotel reservation\""},
+						{Term: "from:*@airlines.com"},
+						{Term: "from:*@hotels.com"},
 					},
 				},
 				Actions: config.Actions{
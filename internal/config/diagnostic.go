@@ -0,0 +1,264 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Severity is how serious a diagnostic is. Configs with errors are
+// rejected, while warnings point out likely mistakes.
+type Severity string
+
+// Diagnostic severities
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Code identifies the kind of problem a diagnostic reports
+type Code string
+
+// Diagnostic codes
+const (
+	CodeSyntax             Code = "syntax"
+	CodeUnknownField       Code = "unknown-field"
+	CodeDuplicateKey       Code = "duplicate-key"
+	CodeInvalidValue       Code = "invalid-value"
+	CodeNoEmails           Code = "no-emails"
+	CodeInvalidEmail       Code = "invalid-email"
+	CodeDuplicateEmail     Code = "duplicate-email"
+	CodeNoFilters          Code = "no-filters"
+	CodeMissingName        Code = "missing-name"
+	CodeNoConditions       Code = "no-conditions"
+	CodeNoActions          Code = "no-actions"
+	CodeInvalidCondition   Code = "invalid-condition"
+	CodeInvalidQuery       Code = "invalid-query"
+	CodeUnknownOperator    Code = "unknown-operator"
+	CodeInvalidSize        Code = "invalid-size"
+	CodeInvalidLabel       Code = "invalid-label"
+	CodeReservedLabel      Code = "reserved-label"
+	CodeDuplicateLabel     Code = "duplicate-label"
+	CodeInvalidForward     Code = "invalid-forward"
+	CodeUnknownCategory    Code = "unknown-category"
+	CodeConflictingActions Code = "conflicting-actions"
+	CodeNoHeaders          Code = "no-headers"
+)
+
+// Diagnostic is a problem with a configuration, located at the YAML node
+// that caused it when the configuration was read from a file
+type Diagnostic struct {
+	File     string   `json:"file,omitempty"`
+	Line     int      `json:"line,omitempty"`
+	Column   int      `json:"column,omitempty"`
+	Severity Severity `json:"severity"`
+	Code     Code     `json:"code"`
+	Message  string   `json:"message"`
+}
+
+// Error formats the diagnostic as file:line:column: severity: message
+// [code], leaving out whatever part of the location is unknown
+func (d *Diagnostic) Error() string {
+	var location []string
+	if d.File != "" {
+		location = append(location, d.File)
+	}
+	if d.Line > 0 {
+		location = append(location, strconv.Itoa(d.Line))
+		if d.Column > 0 {
+			location = append(location, strconv.Itoa(d.Column))
+		}
+	}
+	msg := fmt.Sprintf("%s: %s [%s]", d.Severity, d.Message, d.Code)
+	if len(location) == 0 {
+		return msg
+	}
+	return strings.Join(location, ":") + ": " + msg
+}
+
+// Diagnostics collects every problem found in a configuration
+type Diagnostics []*Diagnostic
+
+// Error lists the diagnostics one per line
+func (l Diagnostics) Error() string {
+	if len(l) == 1 {
+		return l[0].Error()
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d problems:", len(l))
+	for _, d := range l {
+		b.WriteString("\n  ")
+		b.WriteString(d.Error())
+	}
+	return b.String()
+}
+
+// Errors returns the diagnostics with error severity
+func (l Diagnostics) Errors() Diagnostics {
+	return l.bySeverity(SeverityError)
+}
+
+// Warnings returns the diagnostics with warning severity
+func (l Diagnostics) Warnings() Diagnostics {
+	return l.bySeverity(SeverityWarning)
+}
+
+// HasErrors reports whether any diagnostic is an error
+func (l Diagnostics) HasErrors() bool {
+	return len(l.Errors()) > 0
+}
+
+func (l Diagnostics) bySeverity(severity Severity) Diagnostics {
+	var out Diagnostics
+	for _, d := range l {
+		if d.Severity == severity {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// sort orders the diagnostics by their position in the file
+func (l Diagnostics) sort() {
+	sort.SliceStable(l, func(i, j int) bool {
+		if l[i].Line != l[j].Line {
+			return l[i].Line < l[j].Line
+		}
+		return l[i].Column < l[j].Column
+	})
+}
+
+// err returns the list as an error, or nil when it is empty
+func (l Diagnostics) err() error {
+	if len(l) == 0 {
+		return nil
+	}
+	return l
+}
+
+// yamlLine matches the line prefix of yaml.v3 error messages, along with
+// the column that errors raised while decoding conditions also give
+var yamlLine = regexp.MustCompile(`^(?:yaml: )?line (\d+)(?:, column (\d+))?: (.*)$`)
+
+// yamlDiagnostics converts an error from the YAML decoder into located
+// diagnostics
+func yamlDiagnostics(file string, err error) Diagnostics {
+	code := CodeSyntax
+	messages := []string{err.Error()}
+	if typeErr, ok := err.(*yaml.TypeError); ok {
+		code = CodeInvalidValue
+		messages = typeErr.Errors
+	}
+
+	list := make(Diagnostics, 0, len(messages))
+	for _, msg := range messages {
+		d := &Diagnostic{
+			File:     file,
+			Severity: SeverityError,
+			Code:     code,
+			Message:  strings.TrimPrefix(msg, "yaml: "),
+		}
+		if m := yamlLine.FindStringSubmatch(msg); m != nil {
+			d.Line, _ = strconv.Atoi(m[1])
+			d.Column, _ = strconv.Atoi(m[2])
+			d.Message = m[3]
+		}
+		switch {
+		case strings.Contains(d.Message, "not found in type"):
+			d.Code = CodeUnknownField
+		case strings.Contains(d.Message, "already defined"):
+			d.Code = CodeDuplicateKey
+		}
+		list = append(list, d)
+	}
+	return list
+}
+
+// locate finds the node at a path of mapping keys and sequence indexes
+// below root, stopping at the deepest node that exists
+func locate(root *yaml.Node, path []interface{}) *yaml.Node {
+	n := root
+	for _, elem := range path {
+		next := child(n, elem)
+		if next == nil {
+			break
+		}
+		n = next
+	}
+	return n
+}
+
+// child returns the value at a mapping key or sequence index of n
+func child(n *yaml.Node, elem interface{}) *yaml.Node {
+	n = resolve(n)
+	if n == nil {
+		return nil
+	}
+
+	switch key := elem.(type) {
+	case string:
+		if n.Kind != yaml.MappingNode {
+			return nil
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Value == key {
+				return n.Content[i+1]
+			}
+		}
+	case int:
+		if n.Kind == yaml.SequenceNode && key < len(n.Content) {
+			return n.Content[key]
+		}
+	}
+	return nil
+}
+
+// columnAt returns the column of the first node on a line, or zero when
+// there is none
+func columnAt(n *yaml.Node, line int) int {
+	if n == nil || line == 0 {
+		return 0
+	}
+	if n.Line == line && n.Kind != yaml.DocumentNode {
+		return n.Column
+	}
+	for _, c := range n.Content {
+		if column := columnAt(c, line); column != 0 {
+			return column
+		}
+	}
+	return 0
+}
+
+// lastLine returns the last line the node or any of its children is on
+func lastLine(n *yaml.Node) int {
+	last := n.Line
+	for _, c := range n.Content {
+		if l := lastLine(c); l > last {
+			last = l
+		}
+	}
+	return last
+}
+
+// resolve looks through document and alias nodes to the node they hold
+func resolve(n *yaml.Node) *yaml.Node {
+	for n != nil {
+		switch n.Kind {
+		case yaml.DocumentNode:
+			if len(n.Content) == 0 {
+				return nil
+			}
+			n = n.Content[0]
+		case yaml.AliasNode:
+			n = n.Alias
+		default:
+			return n
+		}
+	}
+	return nil
+}
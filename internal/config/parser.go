@@ -1,58 +1,85 @@
 package config
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"os"
 
 	"gopkg.in/yaml.v3"
 )
 
-// LoadFromFile loads a filter configuration from a YAML file
+// LoadFromFile loads a filter configuration from a YAML file. Unknown
+// keys are rejected, and when the config has errors every one of them is
+// reported at once as Diagnostics locating each in the file. Warnings are
+// not reported; use Load to see them.
 func LoadFromFile(path string) (*Config, error) {
-	data, err := os.ReadFile(path)
+	config, diags, err := Load(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+		return nil, err
 	}
-
-	var config Config
-	if err := yaml.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("invalid config: %w", diags.Errors())
 	}
-
-	if err := validateConfig(&config); err != nil {
-		return nil, fmt.Errorf("invalid config: %w", err)
-	}
-
-	return &config, nil
+	return config, nil
 }
 
-// validateConfig checks that the configuration is valid
-func validateConfig(config *Config) error {
-	if len(config.Emails) == 0 {
-		return fmt.Errorf("no email addresses specified")
+// Load reads a filter configuration from a YAML file along with every
+// diagnostic found in it, sorted by position. The configuration is nil
+// when any diagnostic is an error. The returned error is only set when the
+// file cannot be read.
+func Load(path string) (*Config, Diagnostics, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
-	if len(config.Filters) == 0 {
-		return fmt.Errorf("no filters specified")
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, yamlDiagnostics(path, err), nil
 	}
 
-	for i := 0; i < len(config.Filters); i++ {
-		if err := validateFilter(&config.Filters[i], i); err != nil {
-			return err
+	// Type errors such as unknown keys leave the rest of the config
+	// decoded, so validation still runs to report everything in one go
+	var config Config
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	var diags Diagnostics
+	if err := dec.Decode(&config); err != nil && err != io.EOF {
+		diags = yamlDiagnostics(path, err)
+		if _, ok := err.(*yaml.TypeError); !ok {
+			return nil, diags, nil
+		}
+	}
+	for _, d := range diags {
+		if d.Column == 0 {
+			d.Column = columnAt(&root, d.Line)
 		}
 	}
 
-	return nil
+	v := &validator{file: path, root: &root, diags: diags, decodeErrors: diags}
+	v.validateConfig(&config)
+	v.diags.sort()
+	if v.diags.HasErrors() {
+		return nil, v.diags, nil
+	}
+	return &config, v.diags, nil
 }
 
-// validateFilter checks that a filter configuration is valid
-func validateFilter(filter *Filter, index int) error {
-	if filter.Name == "" {
-		return fmt.Errorf("filter %d has no name", index)
+// SaveToFile writes a filter configuration to a YAML file
+func SaveToFile(path string, config *Config) error {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(config); err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
 	}
 
-	if len(filter.Conditions.Has) == 0 && len(filter.Conditions.HasNot) == 0 {
-		return fmt.Errorf("filter %q has no conditions", filter.Name)
+	if err := os.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
 	}
 
 	return nil
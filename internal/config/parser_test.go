@@ -1,7 +1,13 @@
 package config
 
 import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestLoadFromFile(t *testing.T) {
@@ -20,6 +26,26 @@ func TestLoadFromFile(t *testing.T) {
 			file:    "../testdata/filters/complex.yaml",
 			wantErr: false,
 		},
+		{
+			name:    "condition expressions",
+			file:    "../testdata/filters/conditions.yaml",
+			wantErr: false,
+		},
+		{
+			name:    "otherwise chain",
+			file:    "../testdata/filters/otherwise.yaml",
+			wantErr: false,
+		},
+		{
+			name:    "chain branches",
+			file:    "../testdata/filters/chain.yaml",
+			wantErr: false,
+		},
+		{
+			name:    "inline tests",
+			file:    "../testdata/filters/tests.yaml",
+			wantErr: false,
+		},
 		{
 			name:    "invalid config",
 			file:    "../testdata/filters/invalid.yaml",
@@ -46,6 +72,81 @@ func TestLoadFromFile(t *testing.T) {
 	}
 }
 
+func TestLoadFromFileErrors(t *testing.T) {
+	_, err := LoadFromFile("../testdata/filters/invalid.yaml")
+	var list Diagnostics
+	if !errors.As(err, &list) {
+		t.Fatalf("LoadFromFile() error = %v, want Diagnostics", err)
+	}
+
+	want := []string{
+		`../testdata/filters/invalid.yaml:2:5: error: email address "invalid@@example.com" is not an email address [invalid-email]`,
+		"../testdata/filters/invalid.yaml:3:5: error: email address is empty [invalid-email]",
+		"../testdata/filters/invalid.yaml:6:5: error: filter 0 has no name [missing-name]",
+		`../testdata/filters/invalid.yaml:13:5: error: filter "Missing Conditions" has no conditions [no-conditions]`,
+		"../testdata/filters/invalid.yaml:22:7: error: field unknown_action not found in type config.Actions [unknown-field]",
+		`../testdata/filters/invalid.yaml:33:7: error: filter "Empty Conditions" has no conditions [no-conditions]`,
+		`../testdata/filters/invalid.yaml:44:7: error: mapping key "label" already defined at line 43 [duplicate-key]`,
+	}
+	if len(list) != len(want) {
+		t.Fatalf("got %d errors, want %d:\n%v", len(list), len(want), list)
+	}
+	for i, e := range list {
+		if e.Error() != want[i] {
+			t.Errorf("error %d = %q, want %q", i, e.Error(), want[i])
+		}
+	}
+
+	// Filters that failed to decode get no warnings about the parts left
+	// out, such as their actions
+	_, diags, err := Load("../testdata/filters/invalid.yaml")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if warnings := diags.Warnings(); len(warnings) != 0 {
+		t.Errorf("Load() warnings = %v, want none", warnings)
+	}
+
+	path := filepath.Join(t.TempDir(), "broken.yaml")
+	if err := os.WriteFile(path, []byte("emails:\n  - me@example.com\nfilters: [\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, err = LoadFromFile(path)
+	if !errors.As(err, &list) || list[0].Line == 0 || list[0].Code != CodeSyntax {
+		t.Errorf("LoadFromFile() error = %v, want a located syntax error", err)
+	}
+}
+
+func TestLoadWarnings(t *testing.T) {
+	cfg, diags, err := Load("../testdata/filters/warnings.yaml")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg == nil {
+		t.Fatalf("Load() returned no config for warnings only: %v", diags)
+	}
+
+	want := []struct {
+		line int
+		code Code
+	}{
+		{3, CodeDuplicateEmail},
+		{8, CodeUnknownOperator},
+		{13, CodeInvalidLabel},
+		{14, CodeNoActions},
+		{18, CodeInvalidValue},
+		{24, CodeInvalidCondition},
+	}
+	if len(diags) != len(want) {
+		t.Fatalf("got %d diagnostics, want %d:\n%v", len(diags), len(want), diags)
+	}
+	for i, d := range diags {
+		if d.Severity != SeverityWarning || d.Line != want[i].line || d.Code != want[i].code {
+			t.Errorf("diagnostic %d = %v, want a %s warning on line %d", i, d, want[i].code, want[i].line)
+		}
+	}
+}
+
 func TestValidateConfig(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -70,6 +171,433 @@ func TestValidateConfig(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "unknown limits policy",
+			config: &Config{
+				Emails: []string{"me@example.com"},
+				Limits: "truncate",
+				Filters: []Filter{
+					{
+						Name:       "Test Filter",
+						Conditions: Conditions{Has: []string{"test"}},
+						Actions:    Actions{Label: "test"},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "empty structured value",
+			config: &Config{
+				Emails: []string{"me@example.com"},
+				Filters: []Filter{
+					{
+						Name:       "Test Filter",
+						Conditions: Conditions{From: []string{""}},
+						Actions:    Actions{Label: "test"},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "quote inside structured value",
+			config: &Config{
+				Emails: []string{"me@example.com"},
+				Filters: []Filter{
+					{
+						Name:       "Test Filter",
+						Conditions: Conditions{Subject: []string{`the "big" sale`}},
+						Actions:    Actions{Label: "test"},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "structured value quoted as a whole",
+			config: &Config{
+				Emails: []string{"me@example.com"},
+				Filters: []Filter{
+					{
+						Name:       "Test Filter",
+						Conditions: Conditions{Subject: []string{`"big sale"`}},
+						Actions:    Actions{Label: "test"},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "structured conditions only",
+			config: &Config{
+				Emails: []string{"me@example.com"},
+				Filters: []Filter{
+					{
+						Name: "Test Filter",
+						Conditions: Conditions{
+							From:    []string{"someone@example.com"},
+							Subject: []string{"hello world"},
+						},
+						Actions: Actions{
+							Label: "test",
+						},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "condition expression",
+			config: &Config{
+				Emails: []string{"me@example.com"},
+				Filters: []Filter{
+					{
+						Name: "Test Filter",
+						Conditions: Conditions{
+							Any: []Condition{
+								{Term: "from:a@example.com"},
+								{Not: &Condition{All: []Condition{{Term: "b"}, {Term: "c"}}}},
+							},
+						},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "ambiguous condition",
+			config: &Config{
+				Emails: []string{"me@example.com"},
+				Filters: []Filter{
+					{
+						Name: "Test Filter",
+						Conditions: Conditions{
+							Any: []Condition{
+								{Term: "a", All: []Condition{{Term: "b"}}},
+							},
+						},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "empty condition group",
+			config: &Config{
+				Emails: []string{"me@example.com"},
+				Filters: []Filter{
+					{
+						Name: "Test Filter",
+						Conditions: Conditions{
+							Not: &Condition{Any: []Condition{}},
+						},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid otherwise condition",
+			config: &Config{
+				Emails: []string{"me@example.com"},
+				Filters: []Filter{
+					{
+						Name: "Test Filter",
+						Conditions: Conditions{
+							Has: []string{"test"},
+						},
+						Otherwise: &Filter{
+							Conditions: Conditions{
+								Not: &Condition{},
+							},
+						},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "unconditional chain branch before the last",
+			config: &Config{
+				Emails: []string{"me@example.com"},
+				Filters: []Filter{
+					{
+						Name: "Test Filter",
+						Conditions: Conditions{
+							List: []string{"robots@example.com"},
+						},
+						Chain: []Filter{
+							{Actions: Actions{Label: "everything"}},
+							{Conditions: Conditions{Subject: []string{"x"}}, Actions: Actions{Label: "x"}},
+						},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "full action coverage",
+			config: &Config{
+				Emails: []string{"me@example.com"},
+				Filters: []Filter{
+					{
+						Name: "Test Filter",
+						Conditions: Conditions{
+							Larger: "10M",
+						},
+						Actions: Actions{
+							Delete:        true,
+							MarkImportant: true,
+							Category:      "promotions",
+							Forward:       "archive@example.com",
+						},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid forward address",
+			config: &Config{
+				Emails: []string{"me@example.com"},
+				Filters: []Filter{
+					{
+						Name:       "Test Filter",
+						Conditions: Conditions{Has: []string{"test"}},
+						Actions:    Actions{Forward: "not an address"},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "forward with display name",
+			config: &Config{
+				Emails: []string{"me@example.com"},
+				Filters: []Filter{
+					{
+						Name:       "Test Filter",
+						Conditions: Conditions{Has: []string{"test"}},
+						Actions:    Actions{Forward: "Archive <archive@example.com>"},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown category",
+			config: &Config{
+				Emails: []string{"me@example.com"},
+				Filters: []Filter{
+					{
+						Name:       "Test Filter",
+						Conditions: Conditions{Has: []string{"test"}},
+						Actions:    Actions{Category: "spam"},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "conflicting importance",
+			config: &Config{
+				Emails: []string{"me@example.com"},
+				Filters: []Filter{
+					{
+						Name:       "Test Filter",
+						Conditions: Conditions{Has: []string{"test"}},
+						Actions:    Actions{MarkImportant: true, NeverImportant: true},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid size",
+			config: &Config{
+				Emails: []string{"me@example.com"},
+				Filters: []Filter{
+					{
+						Name:       "Test Filter",
+						Conditions: Conditions{Larger: "huge"},
+						Actions:    Actions{Label: "test"},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "multiple labels",
+			config: &Config{
+				Emails: []string{"me@example.com"},
+				Filters: []Filter{
+					{
+						Name:       "Test Filter",
+						Conditions: Conditions{Has: []string{"test"}},
+						Actions:    Actions{Label: "a", Labels: []string{"b", "c"}},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "repeated label",
+			config: &Config{
+				Emails: []string{"me@example.com"},
+				Filters: []Filter{
+					{
+						Name:       "Test Filter",
+						Conditions: Conditions{Has: []string{"test"}},
+						Actions:    Actions{Label: "a", Labels: []string{"a"}},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "empty label in list",
+			config: &Config{
+				Emails: []string{"me@example.com"},
+				Filters: []Filter{
+					{
+						Name:       "Test Filter",
+						Conditions: Conditions{Has: []string{"test"}},
+						Actions:    Actions{Labels: []string{""}},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "test without name",
+			config: &Config{
+				Emails: []string{"me@example.com"},
+				Filters: []Filter{
+					{
+						Name:       "Test Filter",
+						Conditions: Conditions{Has: []string{"test"}},
+						Actions:    Actions{Label: "test"},
+					},
+				},
+				Tests: []Test{{Headers: map[string]string{"From": "a@example.com"}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "test without headers",
+			config: &Config{
+				Emails: []string{"me@example.com"},
+				Filters: []Filter{
+					{
+						Name:       "Test Filter",
+						Conditions: Conditions{Has: []string{"test"}},
+						Actions:    Actions{Label: "test"},
+					},
+				},
+				Tests: []Test{{Name: "Empty"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "test with invalid size",
+			config: &Config{
+				Emails: []string{"me@example.com"},
+				Filters: []Filter{
+					{
+						Name:       "Test Filter",
+						Conditions: Conditions{Has: []string{"test"}},
+						Actions:    Actions{Label: "test"},
+					},
+				},
+				Tests: []Test{{Name: "Huge", Headers: map[string]string{"From": "a@example.com"}, Size: "huge"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "reserved label",
+			config: &Config{
+				Emails: []string{"me@example.com"},
+				Filters: []Filter{
+					{
+						Name:       "Test Filter",
+						Conditions: Conditions{Has: []string{"test"}},
+						Actions:    Actions{Label: "Inbox/robots"},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "label with empty level",
+			config: &Config{
+				Emails: []string{"me@example.com"},
+				Filters: []Filter{
+					{
+						Name:       "Test Filter",
+						Conditions: Conditions{Has: []string{"test"}},
+						Actions:    Actions{Label: "work//robots"},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "overlong label",
+			config: &Config{
+				Emails: []string{"me@example.com"},
+				Filters: []Filter{
+					{
+						Name:       "Test Filter",
+						Conditions: Conditions{Has: []string{"test"}},
+						Actions:    Actions{Label: strings.Repeat("a", 226)},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid query",
+			config: &Config{
+				Emails: []string{"me@example.com"},
+				Filters: []Filter{
+					{
+						Name:       "Test Filter",
+						Conditions: Conditions{Has: []string{"(from:a"}},
+						Actions:    Actions{Label: "test"},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid query in condition",
+			config: &Config{
+				Emails: []string{"me@example.com"},
+				Filters: []Filter{
+					{
+						Name:       "Test Filter",
+						Conditions: Conditions{All: []Condition{{Term: "subject:{a"}}},
+						Actions:    Actions{Label: "test"},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid email address",
+			config: &Config{
+				Emails: []string{"invalid@@example.com"},
+				Filters: []Filter{
+					{
+						Name:       "Test Filter",
+						Conditions: Conditions{Has: []string{"test"}},
+						Actions:    Actions{Label: "test"},
+					},
+				},
+			},
+			wantErr: true,
+		},
 		{
 			name: "missing emails",
 			config: &Config{
@@ -139,3 +667,104 @@ func TestValidateConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestConditionYAML(t *testing.T) {
+	cfg, err := LoadFromFile("../testdata/filters/conditions.yaml")
+	if err != nil {
+		t.Fatalf("LoadFromFile() error = %v", err)
+	}
+
+	family := cfg.Filters[0].Conditions
+	if len(family.Any) != 3 || family.Any[0].Term != "from:mom@example.com" {
+		t.Errorf("any group not decoded correctly: %+v", family.Any)
+	}
+
+	robots := cfg.Filters[1].Conditions
+	if len(robots.All) != 2 || robots.All[0].Term != "list:robots@bigco.com" {
+		t.Fatalf("all group not decoded correctly: %+v", robots.All)
+	}
+	nested := robots.All[1]
+	if len(nested.Any) != 2 || nested.Any[1].Not == nil || len(nested.Any[1].Not.Any) != 2 {
+		t.Errorf("nested groups not decoded correctly: %+v", nested)
+	}
+}
+
+func TestConditionUnknownKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "filters.yaml")
+	data := `emails:
+  - me@example.com
+filters:
+  - name: Robots
+    conditions:
+      all:
+        - "list:robots@bigco.com"
+        - any:
+            - "subject:alert"
+            - nto: "subject:urgent"
+      not: {al: ["from:me"], any: ["to:me"]}
+    actions:
+      label: robots
+`
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := LoadFromFile(path)
+	var list Diagnostics
+	if !errors.As(err, &list) {
+		t.Fatalf("LoadFromFile() error = %v, want Diagnostics", err)
+	}
+	want := []string{
+		path + ":10:15: error: field nto not found in type config.Condition [unknown-field]",
+		path + ":11:13: error: field al not found in type config.Condition [unknown-field]",
+	}
+	if len(list) != len(want) {
+		t.Fatalf("got %d errors, want %d:\n%v", len(list), len(want), list)
+	}
+	for i, e := range list {
+		if e.Error() != want[i] {
+			t.Errorf("error %d = %q, want %q", i, e.Error(), want[i])
+		}
+	}
+}
+
+func TestTimestamp(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "filters.yaml")
+	data := "timestamp: 2024-01-02T03:04:05Z\n" +
+		"emails: [me@example.com]\n" +
+		"filters:\n" +
+		"  - name: Test\n" +
+		"    conditions:\n" +
+		"      has: [test]\n"
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadFromFile(path)
+	if err != nil {
+		t.Fatalf("LoadFromFile() error = %v", err)
+	}
+	if want := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC); !cfg.Timestamp.Equal(want) {
+		t.Errorf("Timestamp = %v, want %v", cfg.Timestamp, want)
+	}
+}
+
+func TestSaveToFile(t *testing.T) {
+	cfg, err := LoadFromFile("../testdata/filters/conditions.yaml")
+	if err != nil {
+		t.Fatalf("LoadFromFile() error = %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "filters.yaml")
+	if err := SaveToFile(path, cfg); err != nil {
+		t.Fatalf("SaveToFile() error = %v", err)
+	}
+
+	saved, err := LoadFromFile(path)
+	if err != nil {
+		t.Fatalf("LoadFromFile() of saved config error = %v", err)
+	}
+	if !reflect.DeepEqual(saved, cfg) {
+		t.Errorf("saved config = %+v, want %+v", saved, cfg)
+	}
+}
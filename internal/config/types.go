@@ -1,9 +1,28 @@
 package config
 
+import (
+	"fmt"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
 // Config represents the top-level YAML configuration
 type Config struct {
 	Emails  []string `yaml:"emails"`
 	Filters []Filter `yaml:"filters"`
+
+	// Timestamp fixes the updated time written to generated XML so that
+	// the output is reproducible
+	Timestamp time.Time `yaml:"timestamp,omitempty"`
+
+	// Limits decides what happens to filters that exceed Gmail's limits:
+	// warn, fail or split
+	Limits string `yaml:"limits,omitempty"`
+
+	// Tests are sample messages along with the outcome the filters must
+	// produce for them
+	Tests []Test `yaml:"tests,omitempty"`
 }
 
 // Filter represents a single Gmail filter configuration
@@ -11,25 +30,193 @@ type Filter struct {
 	Name       string     `yaml:"name"`
 	Conditions Conditions `yaml:"conditions"`
 	Actions    Actions    `yaml:"actions"`
+
+	// Otherwise is applied to messages that this filter's conditions do
+	// not match. Its own conditions, if any, narrow it further.
+	Otherwise *Filter `yaml:"otherwise,omitempty"`
+
+	// Chain lists branches that each inherit this filter's conditions and
+	// apply only when no earlier branch matched. This filter only produces
+	// a Gmail filter of its own when it has actions.
+	Chain []Filter `yaml:"chain,omitempty"`
+
+	// LintIgnore lists lint rules that are not reported for this filter
+	LintIgnore []string `yaml:"lint_ignore,omitempty"`
 }
 
-// Conditions represents the conditions for a filter
+// Conditions represents the conditions for a filter. Values within a
+// structured field such as From are alternatives; the fields themselves
+// must all match.
 type Conditions struct {
-	Has    []string `yaml:"has,omitempty"`
-	HasNot []string `yaml:"has_not,omitempty"`
+	Has         []string `yaml:"has,omitempty"`
+	HasNot      []string `yaml:"has_not,omitempty"`
+	From        []string `yaml:"from,omitempty"`
+	To          []string `yaml:"to,omitempty"`
+	Cc          []string `yaml:"cc,omitempty"`
+	Bcc         []string `yaml:"bcc,omitempty"`
+	Subject     []string `yaml:"subject,omitempty"`
+	List        []string `yaml:"list,omitempty"`
+	DeliveredTo []string `yaml:"deliveredto,omitempty"`
+	Filename    []string `yaml:"filename,omitempty"`
+
+	// Larger and Smaller match messages by size, such as "10M" or "500K"
+	Larger  string `yaml:"larger,omitempty"`
+	Smaller string `yaml:"smaller,omitempty"`
+
+	// All, Any and Not build a boolean expression that is combined with the
+	// other conditions
+	All []Condition `yaml:"all,omitempty"`
+	Any []Condition `yaml:"any,omitempty"`
+	Not *Condition  `yaml:"not,omitempty"`
+}
+
+// IsEmpty reports whether no condition is set
+func (c Conditions) IsEmpty() bool {
+	return len(c.Has) == 0 &&
+		len(c.HasNot) == 0 &&
+		len(c.From) == 0 &&
+		len(c.To) == 0 &&
+		len(c.Cc) == 0 &&
+		len(c.Bcc) == 0 &&
+		len(c.Subject) == 0 &&
+		len(c.List) == 0 &&
+		len(c.DeliveredTo) == 0 &&
+		len(c.Filename) == 0 &&
+		c.Larger == "" &&
+		c.Smaller == "" &&
+		len(c.All) == 0 &&
+		len(c.Any) == 0 &&
+		c.Not == nil
+}
+
+// Condition is a node in a boolean condition expression. In YAML a plain
+// string is a Gmail search term, while a mapping with a single all, any or
+// not key groups nested conditions.
+type Condition struct {
+	Term string      `yaml:"-"`
+	All  []Condition `yaml:"all,omitempty"`
+	Any  []Condition `yaml:"any,omitempty"`
+	Not  *Condition  `yaml:"not,omitempty"`
+}
+
+// condition is used to decode and encode the mapping form of a Condition
+// without recursing into its custom (un)marshalling
+type condition Condition
+
+// conditionKeys are the keys allowed in the mapping form of a Condition
+var conditionKeys = map[string]bool{"all": true, "any": true, "not": true}
+
+// UnmarshalYAML decodes either a search term or a nested group. Decoding
+// through yaml.Node does not inherit the decoder's KnownFields setting, so
+// unknown keys are reported here, each at its own line and column.
+func (c *Condition) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*c = Condition{}
+		return node.Decode(&c.Term)
+	}
+
+	var errs []string
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			if !conditionKeys[key.Value] {
+				errs = append(errs, fmt.Sprintf("line %d, column %d: field %s not found in type config.Condition",
+					key.Line, key.Column, key.Value))
+			}
+		}
+	}
+	if err := node.Decode((*condition)(c)); err != nil {
+		typeErr, ok := err.(*yaml.TypeError)
+		if !ok {
+			return err
+		}
+		errs = append(errs, typeErr.Errors...)
+	}
+	if len(errs) > 0 {
+		return &yaml.TypeError{Errors: errs}
+	}
+	return nil
+}
+
+// MarshalYAML encodes search terms as plain strings
+func (c Condition) MarshalYAML() (interface{}, error) {
+	if c.Term != "" {
+		return c.Term, nil
+	}
+	return condition(c), nil
 }
 
 // Actions represents the actions for a filter
 type Actions struct {
 	Label                 string                 `yaml:"label,omitempty"`
+	Labels                []string               `yaml:"labels,omitempty"`
 	Archive               bool                   `yaml:"archive,omitempty"`
 	MarkRead              bool                   `yaml:"mark_read,omitempty"`
 	Star                  bool                   `yaml:"star,omitempty"`
 	NeverSpam             bool                   `yaml:"never_spam,omitempty"`
+	Delete                bool                   `yaml:"delete,omitempty"`
+	MarkImportant         bool                   `yaml:"mark_important,omitempty"`
+	NeverImportant        bool                   `yaml:"never_important,omitempty"`
+	Category              string                 `yaml:"category,omitempty"`
+	Forward               string                 `yaml:"forward,omitempty"`
 	ArchiveUnlessDirected *ArchiveUnlessDirected `yaml:"archive_unless_directed,omitempty"`
 }
 
+// IsEmpty reports whether no action is set
+func (a Actions) IsEmpty() bool {
+	return a.Label == "" &&
+		len(a.Labels) == 0 &&
+		!a.Archive &&
+		!a.MarkRead &&
+		!a.Star &&
+		!a.NeverSpam &&
+		!a.Delete &&
+		!a.MarkImportant &&
+		!a.NeverImportant &&
+		a.Category == "" &&
+		a.Forward == "" &&
+		a.ArchiveUnlessDirected == nil
+}
+
+// AllLabels returns the labels to apply, with label ahead of those listed
+// under labels
+func (a Actions) AllLabels() []string {
+	labels := make([]string, 0, len(a.Labels)+1)
+	if a.Label != "" {
+		labels = append(labels, a.Label)
+	}
+	return append(labels, a.Labels...)
+}
+
 // ArchiveUnlessDirected represents the archive_unless_directed action parameters
 type ArchiveUnlessDirected struct {
 	MarkRead bool `yaml:"mark_read,omitempty"`
 }
+
+// Test is a sample message and the labels and flags expected once every
+// filter has been applied to it
+type Test struct {
+	Name        string            `yaml:"name"`
+	Headers     map[string]string `yaml:"headers"`
+	Body        string            `yaml:"body,omitempty"`
+	Attachments []string          `yaml:"attachments,omitempty"`
+	// Size overrides the message size, such as "5M", for testing size
+	// conditions
+	Size   string `yaml:"size,omitempty"`
+	Expect Expect `yaml:"expect"`
+}
+
+// Expect is the expected outcome of a test. Labels are compared exactly
+// when given; flags are only checked when set to true or false.
+type Expect struct {
+	Labels         []string `yaml:"labels,omitempty"`
+	Archive        *bool    `yaml:"archive,omitempty"`
+	MarkRead       *bool    `yaml:"mark_read,omitempty"`
+	Star           *bool    `yaml:"star,omitempty"`
+	NeverSpam      *bool    `yaml:"never_spam,omitempty"`
+	Delete         *bool    `yaml:"delete,omitempty"`
+	MarkImportant  *bool    `yaml:"mark_important,omitempty"`
+	NeverImportant *bool    `yaml:"never_important,omitempty"`
+	Category       *string  `yaml:"category,omitempty"`
+	Forward        *string  `yaml:"forward,omitempty"`
+}
@@ -0,0 +1,436 @@
+package config
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+
+	"github.com/brendanryan/gmail-brita/internal/lintrule"
+	"github.com/brendanryan/gmail-brita/internal/query"
+	"gopkg.in/yaml.v3"
+)
+
+// maxLabelLength is the longest label name Gmail accepts
+const maxLabelLength = 225
+
+// reservedLabels lists Gmail's system labels, which cannot be created or
+// nested under, in lower case
+var reservedLabels = map[string]bool{
+	"inbox":     true,
+	"spam":      true,
+	"trash":     true,
+	"unread":    true,
+	"starred":   true,
+	"important": true,
+	"sent":      true,
+	"drafts":    true,
+	"draft":     true,
+	"chats":     true,
+	"all mail":  true,
+	"scheduled": true,
+	"snoozed":   true,
+}
+
+// categories lists Gmail's inbox categories
+var categories = map[string]bool{
+	"primary":    true,
+	"social":     true,
+	"updates":    true,
+	"forums":     true,
+	"promotions": true,
+}
+
+// validator collects the diagnostics for a configuration, locating each at
+// the YAML node it concerns when the configuration came from a file
+type validator struct {
+	file  string
+	root  *yaml.Node
+	diags Diagnostics
+	// decodeErrors are the errors found decoding the document, such as
+	// unknown keys. The value decoded for their nodes is incomplete, so no
+	// warnings are reported about those nodes.
+	decodeErrors Diagnostics
+}
+
+// path is a location in the YAML document as mapping keys and sequence
+// indexes
+type path []interface{}
+
+// at extends the path without sharing its backing array
+func (p path) at(elems ...interface{}) path {
+	return append(append(path(nil), p...), elems...)
+}
+
+// report records a diagnostic at the node found at p
+func (v *validator) report(severity Severity, code Code, p path, format string, args ...interface{}) {
+	d := &Diagnostic{
+		File:     v.file,
+		Severity: severity,
+		Code:     code,
+		Message:  fmt.Sprintf(format, args...),
+	}
+	if v.root != nil {
+		if n := locate(v.root, p); n != nil {
+			if severity == SeverityWarning && v.decodeFailed(n) {
+				return
+			}
+			d.Line, d.Column = n.Line, n.Column
+		}
+	}
+	v.diags = append(v.diags, d)
+}
+
+// decodeFailed reports whether a decode error lies within the node, other
+// than the document as a whole
+func (v *validator) decodeFailed(n *yaml.Node) bool {
+	if n == v.root || n == resolve(v.root) {
+		return false
+	}
+	last := lastLine(n)
+	for _, d := range v.decodeErrors {
+		if d.Line >= n.Line && d.Line <= last {
+			return true
+		}
+	}
+	return false
+}
+
+// errorf records an error at the node found at p
+func (v *validator) errorf(code Code, p path, format string, args ...interface{}) {
+	v.report(SeverityError, code, p, format, args...)
+}
+
+// warnf records a warning at the node found at p
+func (v *validator) warnf(code Code, p path, format string, args ...interface{}) {
+	v.report(SeverityWarning, code, p, format, args...)
+}
+
+// validateConfig checks that the configuration is valid, returning every
+// error found
+func validateConfig(config *Config) error {
+	v := &validator{}
+	v.validateConfig(config)
+	return v.diags.Errors().err()
+}
+
+func (v *validator) validateConfig(config *Config) {
+	if len(config.Emails) == 0 {
+		v.errorf(CodeNoEmails, path{"emails"}, "no email addresses specified")
+	}
+	seen := make(map[string]bool)
+	for i, email := range config.Emails {
+		p := path{"emails", i}
+		if !v.validateAddress(CodeInvalidEmail, p, "email address", email) {
+			continue
+		}
+		if key := strings.ToLower(email); seen[key] {
+			v.warnf(CodeDuplicateEmail, p, "email address %q is listed more than once", email)
+		} else {
+			seen[key] = true
+		}
+	}
+
+	switch config.Limits {
+	case "", "warn", "fail", "split":
+	default:
+		v.errorf(CodeInvalidValue, path{"limits"}, "unknown limits policy %q; use warn, fail or split", config.Limits)
+	}
+
+	if len(config.Filters) == 0 {
+		v.errorf(CodeNoFilters, path{"filters"}, "no filters specified")
+	}
+
+	for i := range config.Filters {
+		v.validateFilter(&config.Filters[i], i, path{"filters", i})
+	}
+
+	for i := range config.Tests {
+		v.validateTest(&config.Tests[i], i, path{"tests", i})
+	}
+}
+
+// validateAddress checks that value is a bare email address such as
+// me@example.com, reporting whether it is
+func (v *validator) validateAddress(code Code, p path, what, value string) bool {
+	if value == "" {
+		v.errorf(code, p, "%s is empty", what)
+		return false
+	}
+	addr, err := mail.ParseAddress(value)
+	if err != nil || addr.Address != value {
+		v.errorf(code, p, "%s %q is not an email address", what, value)
+		return false
+	}
+	return true
+}
+
+// validateTest checks that a test case is valid
+func (v *validator) validateTest(test *Test, index int, p path) {
+	name := fmt.Sprintf("test %q", test.Name)
+	if test.Name == "" {
+		v.errorf(CodeMissingName, p, "test %d has no name", index)
+		name = fmt.Sprintf("test %d", index)
+	}
+
+	if len(test.Headers) == 0 {
+		v.errorf(CodeNoHeaders, p.at("headers"), "%s has no headers", name)
+	}
+
+	if test.Size != "" {
+		if _, err := query.ParseSize(test.Size); err != nil {
+			v.errorf(CodeInvalidSize, p.at("size"), "%s: size: %v", name, err)
+		}
+	}
+
+	if c := test.Expect.Category; c != nil && *c != "" && !categories[*c] {
+		v.errorf(CodeUnknownCategory, p.at("expect", "category"), "%s: unknown category %q", name, *c)
+	}
+}
+
+// validateFilter checks that a filter configuration is valid
+func (v *validator) validateFilter(filter *Filter, index int, p path) {
+	context := fmt.Sprintf("filter %q", filter.Name)
+	if filter.Name == "" {
+		v.errorf(CodeMissingName, p, "filter %d has no name", index)
+		context = fmt.Sprintf("filter %d", index)
+	}
+
+	if filter.Conditions.IsEmpty() {
+		v.errorf(CodeNoConditions, p.at("conditions"), "%s has no conditions", context)
+	}
+
+	v.validateBranches(filter, context, p)
+
+	for i, rule := range filter.LintIgnore {
+		if !lintrule.Known(rule) {
+			v.warnf(CodeInvalidValue, p.at("lint_ignore", i), "%s: %q is not a lint rule", context, rule)
+		}
+	}
+}
+
+// validateBranches checks the conditions of a filter along with its
+// otherwise and chain branches, which may leave out names and conditions
+func (v *validator) validateBranches(filter *Filter, context string, p path) {
+	v.validateConditions(&filter.Conditions, context, p.at("conditions"))
+	v.validateActions(&filter.Actions, context, p.at("actions"))
+
+	if filter.Actions.IsEmpty() && len(filter.Chain) == 0 {
+		v.warnf(CodeNoActions, p, "%s has no actions", context)
+	}
+
+	if filter.Otherwise != nil {
+		v.validateBranches(filter.Otherwise, context+" otherwise", p.at("otherwise"))
+	}
+
+	for i := range filter.Chain {
+		branch := &filter.Chain[i]
+		branchContext := fmt.Sprintf("%s chain branch %d", context, i)
+		if branch.Name != "" {
+			branchContext = fmt.Sprintf("%s chain branch %q", context, branch.Name)
+		}
+		if branch.Conditions.IsEmpty() && i < len(filter.Chain)-1 {
+			v.errorf(CodeNoConditions, p.at("chain", i), "%s has no conditions; only the last branch may match unconditionally", branchContext)
+		}
+		v.validateBranches(branch, branchContext, p.at("chain", i))
+	}
+}
+
+// validateConditions checks the condition expressions of a filter
+func (v *validator) validateConditions(conditions *Conditions, context string, p path) {
+	for i, term := range conditions.Has {
+		v.validateQuery(term, context, p.at("has", i))
+	}
+	for i, term := range conditions.HasNot {
+		v.validateQuery(term, context, p.at("has_not", i))
+	}
+
+	for _, field := range []struct {
+		key       string
+		values    []string
+		addresses bool
+	}{
+		{"from", conditions.From, true},
+		{"to", conditions.To, true},
+		{"cc", conditions.Cc, true},
+		{"bcc", conditions.Bcc, true},
+		{"subject", conditions.Subject, false},
+		{"list", conditions.List, true},
+		{"deliveredto", conditions.DeliveredTo, true},
+		{"filename", conditions.Filename, false},
+	} {
+		for i, value := range field.values {
+			v.validateFieldValue(field.key, value, field.addresses, context, p.at(field.key, i))
+		}
+	}
+
+	if conditions.Larger != "" {
+		if _, err := query.ParseSize(conditions.Larger); err != nil {
+			v.errorf(CodeInvalidSize, p.at("larger"), "%s: larger: %v", context, err)
+		}
+	}
+	if conditions.Smaller != "" {
+		if _, err := query.ParseSize(conditions.Smaller); err != nil {
+			v.errorf(CodeInvalidSize, p.at("smaller"), "%s: smaller: %v", context, err)
+		}
+	}
+
+	for i := range conditions.All {
+		v.validateCondition(&conditions.All[i], context, p.at("all", i))
+	}
+	for i := range conditions.Any {
+		v.validateCondition(&conditions.Any[i], context, p.at("any", i))
+	}
+	if conditions.Not != nil {
+		v.validateCondition(conditions.Not, context, p.at("not"))
+	}
+}
+
+// validateFieldValue checks a value of a structured condition such as
+// from, which is written as a single search term for its operator. Gmail
+// has no way to escape a quote inside a quoted term, so only a value quoted
+// as a whole may contain quotes. Addresses never contain a colon, so one
+// starting with an operator, such as from: [form:boss@example.com], is
+// most likely a mistake.
+func (v *validator) validateFieldValue(key, value string, address bool, context string, p path) {
+	if strings.TrimSpace(value) == "" {
+		v.errorf(CodeInvalidCondition, p, "%s: %s value is empty", context, key)
+		return
+	}
+	inner := value
+	if len(value) >= 2 && strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`) {
+		inner = value[1 : len(value)-1]
+	}
+	if strings.Contains(inner, `"`) {
+		v.errorf(CodeInvalidCondition, p, "%s: %s value %q contains a quote, which Gmail cannot search for", context, key, value)
+		return
+	}
+	if address {
+		if op, _, ok := strings.Cut(value, ":"); ok && op != "" && !strings.ContainsAny(op, " \t@") {
+			v.warnf(CodeInvalidCondition, p, "%s: %s value %q looks like it starts with an operator, %q; list the bare value instead", context, key, value, op+":")
+		}
+	}
+}
+
+// validateQuery checks that a search term parses as a Gmail query and
+// uses only operators Gmail knows
+func (v *validator) validateQuery(term, context string, p path) {
+	n, err := query.Parse(term)
+	if err != nil {
+		v.errorf(CodeInvalidQuery, p, "%s: invalid search %q: %v", context, term, err)
+		return
+	}
+	query.Walk(n, func(w query.Word, _ bool) {
+		if w.Op != "" && !query.KnownOperator(w.Op) {
+			v.warnf(CodeUnknownOperator, p, "%s: %q is not a Gmail search operator", context, w.Op+":")
+		}
+	})
+}
+
+// validateActions checks that a filter's actions are valid
+func (v *validator) validateActions(actions *Actions, context string, p path) {
+	seen := make(map[string]bool)
+	checkLabel := func(label string, at path) {
+		if !v.validateLabel(label, context, at) {
+			return
+		}
+		if seen[label] {
+			v.errorf(CodeDuplicateLabel, at, "%s: label %q is applied more than once", context, label)
+		}
+		seen[label] = true
+	}
+	if actions.Label != "" {
+		checkLabel(actions.Label, p.at("label"))
+	}
+	for i, label := range actions.Labels {
+		checkLabel(label, p.at("labels", i))
+	}
+
+	if actions.Forward != "" {
+		v.validateAddress(CodeInvalidForward, p.at("forward"), context+": forward address", actions.Forward)
+	}
+
+	if actions.Category != "" && !categories[actions.Category] {
+		v.errorf(CodeUnknownCategory, p.at("category"), "%s: unknown category %q", context, actions.Category)
+	}
+
+	if actions.MarkImportant && actions.NeverImportant {
+		v.errorf(CodeConflictingActions, p.at("never_important"), "%s: mark_important and never_important cannot both be set", context)
+	}
+}
+
+// validateLabel checks a label name against Gmail's naming rules,
+// reporting whether it is usable
+func (v *validator) validateLabel(label, context string, p path) bool {
+	if strings.TrimSpace(label) == "" {
+		v.errorf(CodeInvalidLabel, p, "%s: labels contains an empty label", context)
+		return false
+	}
+	if len(label) > maxLabelLength {
+		v.errorf(CodeInvalidLabel, p, "%s: label %q is longer than %d characters", context, label, maxLabelLength)
+		return false
+	}
+
+	segments := strings.Split(label, "/")
+	for _, segment := range segments {
+		if segment == "" {
+			v.errorf(CodeInvalidLabel, p, "%s: label %q has an empty level; use / only between nested label names", context, label)
+			return false
+		}
+	}
+	if reservedLabels[strings.ToLower(segments[0])] {
+		v.errorf(CodeReservedLabel, p, "%s: label %q uses the reserved system label %q", context, label, segments[0])
+		return false
+	}
+
+	for _, segment := range segments {
+		if strings.TrimSpace(segment) != segment {
+			v.warnf(CodeInvalidLabel, p, "%s: label %q has spaces around a level name, which Gmail removes", context, label)
+			break
+		}
+	}
+	if strings.HasPrefix(label, "^") {
+		v.warnf(CodeInvalidLabel, p, "%s: label %q starts with ^, which Gmail uses for system labels", context, label)
+	}
+	return true
+}
+
+// validateCondition checks that a condition node and its children are well formed
+func (v *validator) validateCondition(c *Condition, context string, p path) {
+	kinds := 0
+	if c.Term != "" {
+		kinds++
+	}
+	if c.All != nil {
+		kinds++
+	}
+	if c.Any != nil {
+		kinds++
+	}
+	if c.Not != nil {
+		kinds++
+	}
+	if kinds != 1 {
+		v.errorf(CodeInvalidCondition, p, "%s: condition must be exactly one of a search term, all, any or not", context)
+		return
+	}
+
+	if c.Term != "" {
+		v.validateQuery(c.Term, context, p)
+	}
+	if c.All != nil && len(c.All) == 0 {
+		v.errorf(CodeInvalidCondition, p.at("all"), "%s: condition has an empty all group", context)
+	}
+	if c.Any != nil && len(c.Any) == 0 {
+		v.errorf(CodeInvalidCondition, p.at("any"), "%s: condition has an empty any group", context)
+	}
+
+	for i := range c.All {
+		v.validateCondition(&c.All[i], context, p.at("all", i))
+	}
+	for i := range c.Any {
+		v.validateCondition(&c.Any[i], context, p.at("any", i))
+	}
+	if c.Not != nil {
+		v.validateCondition(c.Not, context, p.at("not"))
+	}
+}
@@ -0,0 +1,204 @@
+// Package coverage measures how a filter set applies to a corpus of sample
+// mail: which filters match, which never do and which messages no filter
+// handles.
+package coverage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/brendanryan/gmail-brita/internal/filter"
+	"github.com/brendanryan/gmail-brita/internal/simulate"
+)
+
+// Report describes how a filter set covers a corpus of messages
+type Report struct {
+	Messages  int       `json:"messages"`
+	Filters   []Filter  `json:"filters"`
+	Unmatched []Message `json:"unmatched"`
+}
+
+// Filter is the coverage of a single filter
+type Filter struct {
+	// Index is the filter's position in the set, starting at 1
+	Index int    `json:"index"`
+	Name  string `json:"name,omitempty"`
+	Query string `json:"query"`
+	Hits  int    `json:"hits"`
+	// ShadowedBy is the index of an earlier filter that matched every
+	// message this filter matched, or zero when there is none
+	ShadowedBy int `json:"shadowed_by,omitempty"`
+	// NotEvaluated describes the search terms that kept the filter out of
+	// the simulation, and is empty when the filter was evaluated
+	NotEvaluated []string `json:"not_evaluated,omitempty"`
+}
+
+// Message identifies a message in the corpus
+type Message struct {
+	Source  string `json:"source"`
+	Subject string `json:"subject"`
+}
+
+// Analyze evaluates every filter in the set against every message
+func Analyze(set *filter.Set, messages []*simulate.Message) (*Report, error) {
+	sim, err := simulate.New(set)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{
+		Messages:  len(messages),
+		Filters:   make([]Filter, 0, len(set.Filters)),
+		Unmatched: make([]Message, 0),
+	}
+	for i, f := range set.Filters {
+		q, err := f.Query()
+		if err != nil {
+			return nil, fmt.Errorf("filter %d: %w", i+1, err)
+		}
+		text := ""
+		if q != nil {
+			text = q.String()
+		}
+		report.Filters = append(report.Filters, Filter{Index: i + 1, Name: f.Name, Query: text})
+	}
+	for _, skipped := range sim.Skipped() {
+		report.Filters[skipped.Index-1].NotEvaluated = skipped.Reasons
+	}
+
+	// matched[i] lists the messages matched by filter i
+	matched := make([]map[int]bool, len(set.Filters))
+	for i := range matched {
+		matched[i] = make(map[int]bool)
+	}
+	for m, msg := range messages {
+		result := sim.Run(msg)
+		if len(result.Matches) == 0 {
+			report.Unmatched = append(report.Unmatched, Message{Source: msg.Source, Subject: result.Subject})
+		}
+		for _, match := range result.Matches {
+			report.Filters[match.Index-1].Hits++
+			matched[match.Index-1][m] = true
+		}
+	}
+
+	for i := range report.Filters {
+		report.Filters[i].ShadowedBy = shadowedBy(set.Filters, matched, i)
+	}
+
+	return report, nil
+}
+
+// shadowedBy returns the index, starting at 1, of the first earlier filter
+// that matched every message filter i matched, or zero. A companion such as
+// the one added by archive_unless_directed always matches a subset of the
+// filter it was derived from, so it is not shadowed by that filter.
+func shadowedBy(filters []*filter.Filter, matched []map[int]bool, i int) int {
+	if len(matched[i]) == 0 {
+		return 0
+	}
+	for j := 0; j < i; j++ {
+		if filters[i].Source == filters[j] {
+			continue
+		}
+		covered := true
+		for m := range matched[i] {
+			if !matched[j][m] {
+				covered = false
+				break
+			}
+		}
+		if covered {
+			return j + 1
+		}
+	}
+	return 0
+}
+
+// Unused returns the evaluated filters that matched no message
+func (r *Report) Unused() []Filter {
+	var unused []Filter
+	for _, f := range r.Filters {
+		if f.Hits == 0 && len(f.NotEvaluated) == 0 {
+			unused = append(unused, f)
+		}
+	}
+	return unused
+}
+
+// NotEvaluated returns the filters left out of the simulation
+func (r *Report) NotEvaluated() []Filter {
+	var skipped []Filter
+	for _, f := range r.Filters {
+		if len(f.NotEvaluated) > 0 {
+			skipped = append(skipped, f)
+		}
+	}
+	return skipped
+}
+
+// Shadowed returns the filters whose matches were all matched by an
+// earlier filter
+func (r *Report) Shadowed() []Filter {
+	var shadowed []Filter
+	for _, f := range r.Filters {
+		if f.ShadowedBy != 0 {
+			shadowed = append(shadowed, f)
+		}
+	}
+	return shadowed
+}
+
+// WriteText writes a human-readable summary of the report
+func (r *Report) WriteText(w io.Writer) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Filters (%d messages):\n", r.Messages)
+	for _, f := range r.Filters {
+		fmt.Fprintf(&b, "  %5d  %s", f.Hits, describe(f))
+		switch {
+		case len(f.NotEvaluated) > 0:
+			fmt.Fprintf(&b, "  [not evaluated: %s]", strings.Join(f.NotEvaluated, "; "))
+		case f.Hits == 0:
+			b.WriteString("  [never matched]")
+		case f.ShadowedBy != 0:
+			fmt.Fprintf(&b, "  [shadowed by %s]", describe(r.Filters[f.ShadowedBy-1]))
+		}
+		b.WriteString("\n")
+	}
+
+	if len(r.Unmatched) > 0 {
+		fmt.Fprintf(&b, "\nUnmatched messages (%d):\n", len(r.Unmatched))
+		for _, m := range r.Unmatched {
+			fmt.Fprintf(&b, "  %s: %s\n", m.Source, m.Subject)
+		}
+	}
+
+	fmt.Fprintf(&b, "\n%d of %d filters never matched, %d shadowed, %d not evaluated, %d of %d messages unmatched\n",
+		len(r.Unused()), len(r.Filters), len(r.Shadowed()), len(r.NotEvaluated()), len(r.Unmatched), r.Messages)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteJSON writes the report as indented JSON
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// describe labels a filter by its position and name, or its condition
+// when it has no name
+func describe(f Filter) string {
+	label := f.Name
+	if label == "" {
+		label = f.Query
+	}
+	if label == "" {
+		label = "(matches everything)"
+	}
+	return fmt.Sprintf("%d. %s", f.Index, label)
+}
@@ -0,0 +1,95 @@
+package coverage
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/brendanryan/gmail-brita/internal/filter"
+	"github.com/brendanryan/gmail-brita/internal/simulate"
+)
+
+func TestAnalyze(t *testing.T) {
+	set := filter.NewFilterSet([]string{"me@example.com"})
+	filter.NewBuilder(set).Name("Robots").
+		Has([]string{"list:robots@bigco.com"}).
+		Label("robots")
+	filter.NewBuilder(set).Name("Important robots").
+		Has([]string{"list:robots@bigco.com", "subject:Important"}).
+		Star()
+	filter.NewBuilder(set).Name("Invoices").
+		Has([]string{"from:billing@example.com"}).
+		Label("finance")
+	filter.NewBuilder(set).Name("Unread").
+		Has([]string{"is:unread"}).
+		Label("unread")
+
+	messages, _, err := simulate.ReadPath("../testdata/messages/robots.mbox")
+	if err != nil {
+		t.Fatalf("ReadPath() error = %v", err)
+	}
+
+	report, err := Analyze(set, messages)
+	if err != nil {
+		t.Fatalf("Analyze() error = %v", err)
+	}
+
+	hits := []int{2, 1, 0, 0}
+	for i, f := range report.Filters {
+		if f.Hits != hits[i] {
+			t.Errorf("filter %d hits = %d, want %d", f.Index, f.Hits, hits[i])
+		}
+	}
+	if got := report.Filters[1].ShadowedBy; got != 1 {
+		t.Errorf("ShadowedBy = %d, want 1", got)
+	}
+	if got := report.Filters[3].NotEvaluated; len(got) != 1 {
+		t.Errorf("NotEvaluated = %q, want one reason", got)
+	}
+	if len(report.Unmatched) != 1 || report.Unmatched[0].Subject != "Lunch?" {
+		t.Errorf("Unmatched = %+v", report.Unmatched)
+	}
+
+	var out bytes.Buffer
+	if err := report.WriteText(&out); err != nil {
+		t.Fatalf("WriteText() error = %v", err)
+	}
+	for _, want := range []string{
+		"1  2. Important robots  [shadowed by 1. Robots]",
+		"0  3. Invoices  [never matched]",
+		"robots.mbox:3: Lunch?",
+		"0  4. Unread  [not evaluated: is:unread cannot be evaluated locally]",
+		"1 of 4 filters never matched, 1 shadowed, 1 not evaluated, 1 of 3 messages unmatched",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("WriteText() output missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestAnalyzeCompanion(t *testing.T) {
+	// The robot mail is addressed to someone else, so the companion
+	// archives it
+	set := filter.NewFilterSet([]string{"you@example.com"})
+	filter.NewBuilder(set).Name("Robots").
+		Has([]string{"list:robots@bigco.com"}).
+		Label("robots").
+		ArchiveUnlessDirected()
+
+	messages, _, err := simulate.ReadPath("../testdata/messages/robots.mbox")
+	if err != nil {
+		t.Fatalf("ReadPath() error = %v", err)
+	}
+	report, err := Analyze(set, messages)
+	if err != nil {
+		t.Fatalf("Analyze() error = %v", err)
+	}
+
+	companion := report.Filters[1]
+	if companion.Hits == 0 {
+		t.Fatalf("companion hits = 0, want it to match the robot mail")
+	}
+	if companion.ShadowedBy != 0 {
+		t.Errorf("companion ShadowedBy = %d, want it not shadowed by its own filter", companion.ShadowedBy)
+	}
+}
@@ -0,0 +1,227 @@
+// Package diff compares two filter sets by what their filters do rather than
+// by their text, reporting the filters added, removed and changed.
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/brendanryan/gmail-brita/internal/filter"
+	"github.com/brendanryan/gmail-brita/internal/query"
+)
+
+// Report describes how one filter set differs from another. Filters are
+// matched by their normalized search condition, so ordering, IDs and
+// timestamps do not register as changes.
+type Report struct {
+	Added    []Entry        `json:"added"`
+	Removed  []Entry        `json:"removed"`
+	Modified []Modification `json:"modified"`
+}
+
+// Entry is a filter that exists on only one side of the comparison
+type Entry struct {
+	Names   []string `json:"names,omitempty"`
+	Query   string   `json:"query"`
+	Actions []string `json:"actions"`
+}
+
+// Modification is a condition present on both sides whose actions differ
+type Modification struct {
+	Names   []string `json:"names,omitempty"`
+	Query   string   `json:"query"`
+	Added   []string `json:"added_actions,omitempty"`
+	Removed []string `json:"removed_actions,omitempty"`
+}
+
+// Empty reports whether the sets are semantically identical
+func (r *Report) Empty() bool {
+	return len(r.Added) == 0 && len(r.Removed) == 0 && len(r.Modified) == 0
+}
+
+// group collects the filters sharing one search condition. Gmail applies
+// every matching filter, so their actions are combined.
+type group struct {
+	names   []string
+	query   string
+	actions []string
+}
+
+// Compare reports the differences between an old and a new filter set
+func Compare(oldSet, newSet *filter.Set) (*Report, error) {
+	before, err := groupFilters(oldSet)
+	if err != nil {
+		return nil, fmt.Errorf("old filters: %w", err)
+	}
+	after, err := groupFilters(newSet)
+	if err != nil {
+		return nil, fmt.Errorf("new filters: %w", err)
+	}
+
+	report := &Report{
+		Added:    make([]Entry, 0),
+		Removed:  make([]Entry, 0),
+		Modified: make([]Modification, 0),
+	}
+
+	for _, key := range sortedKeys(after) {
+		a := after[key]
+		b, ok := before[key]
+		if !ok {
+			report.Added = append(report.Added, Entry{Names: a.names, Query: a.query, Actions: a.actions})
+			continue
+		}
+		added, removed := difference(a.actions, b.actions), difference(b.actions, a.actions)
+		if len(added) > 0 || len(removed) > 0 {
+			report.Modified = append(report.Modified, Modification{
+				Names:   mergeNames(b.names, a.names),
+				Query:   a.query,
+				Added:   added,
+				Removed: removed,
+			})
+		}
+	}
+
+	for _, key := range sortedKeys(before) {
+		if _, ok := after[key]; !ok {
+			b := before[key]
+			report.Removed = append(report.Removed, Entry{Names: b.names, Query: b.query, Actions: b.actions})
+		}
+	}
+
+	return report, nil
+}
+
+// groupFilters groups a set's filters by normalized search condition
+func groupFilters(set *filter.Set) (map[string]*group, error) {
+	groups := make(map[string]*group)
+	for i, f := range set.Filters {
+		q, err := f.Query()
+		if err != nil {
+			return nil, fmt.Errorf("filter %d: %w", i+1, err)
+		}
+		key := ""
+		if n := query.Normalize(q); n != nil {
+			key = n.String()
+		}
+
+		g, ok := groups[key]
+		if !ok {
+			g = &group{query: key}
+			groups[key] = g
+		}
+		if f.Name != "" {
+			g.names = mergeNames(g.names, []string{f.Name})
+		}
+		g.actions = union(g.actions, f.Actions())
+	}
+	return groups, nil
+}
+
+func sortedKeys(groups map[string]*group) []string {
+	keys := make([]string, 0, len(groups))
+	for k := range groups {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// union returns the sorted, deduplicated union of two lists
+func union(a, b []string) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	out := make([]string, 0, len(a)+len(b))
+	for _, s := range append(append([]string(nil), a...), b...) {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// difference returns the entries of a that are not in b
+func difference(a, b []string) []string {
+	in := make(map[string]bool, len(b))
+	for _, s := range b {
+		in[s] = true
+	}
+	var out []string
+	for _, s := range a {
+		if !in[s] {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// mergeNames combines two name lists, keeping the first occurrence order
+func mergeNames(a, b []string) []string {
+	out := append([]string(nil), a...)
+	for _, name := range b {
+		found := false
+		for _, existing := range out {
+			if existing == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+// WriteText writes a human-readable summary of the report
+func (r *Report) WriteText(w io.Writer) error {
+	var b strings.Builder
+	if r.Empty() {
+		b.WriteString("No changes\n")
+	}
+	for _, e := range r.Added {
+		fmt.Fprintf(&b, "+ %s\n", describe(e.Names, e.Query))
+		fmt.Fprintf(&b, "    actions: %s\n", strings.Join(e.Actions, ", "))
+	}
+	for _, e := range r.Removed {
+		fmt.Fprintf(&b, "- %s\n", describe(e.Names, e.Query))
+		fmt.Fprintf(&b, "    actions: %s\n", strings.Join(e.Actions, ", "))
+	}
+	for _, m := range r.Modified {
+		fmt.Fprintf(&b, "~ %s\n", describe(m.Names, m.Query))
+		for _, a := range m.Added {
+			fmt.Fprintf(&b, "    + %s\n", a)
+		}
+		for _, a := range m.Removed {
+			fmt.Fprintf(&b, "    - %s\n", a)
+		}
+	}
+	if !r.Empty() {
+		fmt.Fprintf(&b, "\n%d added, %d removed, %d modified\n", len(r.Added), len(r.Removed), len(r.Modified))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteJSON writes the report as indented JSON
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// describe labels a filter by its names followed by its condition
+func describe(names []string, q string) string {
+	if q == "" {
+		q = "(matches everything)"
+	}
+	if len(names) == 0 {
+		return q
+	}
+	return fmt.Sprintf("%s: %s", strings.Join(names, ", "), q)
+}
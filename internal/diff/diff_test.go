@@ -0,0 +1,130 @@
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/brendanryan/gmail-brita/internal/filter"
+)
+
+func TestCompare(t *testing.T) {
+	oldSet := filter.NewFilterSet([]string{"me@example.com"})
+	filter.NewBuilder(oldSet).Name("Family").
+		Has([]string{"from:mom@example.com", "from:dad@example.com"}).
+		Label("family")
+	filter.NewBuilder(oldSet).Name("Robots").
+		Has([]string{"list:robots@bigco.com"}).
+		Label("robots").
+		Archive()
+	filter.NewBuilder(oldSet).Name("Spam").
+		Has([]string{"from:spam@example.com"}).
+		Archive()
+
+	newSet := filter.NewFilterSet([]string{"me@example.com"})
+	filter.NewBuilder(newSet).Name("Robots").
+		Has([]string{"list:robots@bigco.com"}).
+		Label("robots").
+		Star()
+	// Same terms in a different order and position is not a change
+	filter.NewBuilder(newSet).Name("Family").
+		Has([]string{"from:dad@example.com", "from:mom@example.com"}).
+		Label("family")
+	filter.NewBuilder(newSet).Name("News").
+		Has([]string{"from:news@example.com"}).
+		Label("news")
+
+	report, err := Compare(oldSet, newSet)
+	if err != nil {
+		t.Fatalf("Compare() error = %v", err)
+	}
+
+	if len(report.Added) != 1 || report.Added[0].Query != "from:news@example.com" {
+		t.Errorf("Added = %+v", report.Added)
+	}
+	if len(report.Removed) != 1 || report.Removed[0].Query != "from:spam@example.com" {
+		t.Errorf("Removed = %+v", report.Removed)
+	}
+	if len(report.Modified) != 1 {
+		t.Fatalf("Modified = %+v", report.Modified)
+	}
+	m := report.Modified[0]
+	if m.Query != "list:robots@bigco.com" || len(m.Added) != 1 || m.Added[0] != "star" || len(m.Removed) != 1 || m.Removed[0] != "archive" {
+		t.Errorf("Modified = %+v", m)
+	}
+}
+
+func TestCompareMergesSharedConditions(t *testing.T) {
+	// Two filters with one condition act like a single filter with both actions
+	oldSet := filter.NewFilterSet([]string{"me@example.com"})
+	filter.NewBuilder(oldSet).Has([]string{"list:a"}).Label("a")
+	filter.NewBuilder(oldSet).Has([]string{"list:a"}).Archive()
+
+	newSet := filter.NewFilterSet([]string{"me@example.com"})
+	filter.NewBuilder(newSet).Has([]string{"list:a"}).Label("a").Archive()
+
+	report, err := Compare(oldSet, newSet)
+	if err != nil {
+		t.Fatalf("Compare() error = %v", err)
+	}
+	if !report.Empty() {
+		t.Errorf("expected no changes, got %+v", report)
+	}
+}
+
+func TestCompareExport(t *testing.T) {
+	set := filter.NewFilterSet([]string{"me@example.com"})
+	filter.NewBuilder(set).
+		From([]string{"mom@example.com"}).
+		Has([]string{"list:a"}).
+		Label("a").
+		ArchiveUnlessDirected(filter.WithMarkRead(true))
+
+	data, err := set.ToXML()
+	if err != nil {
+		t.Fatalf("ToXML() error = %v", err)
+	}
+	exported, err := filter.ParseXML(data)
+	if err != nil {
+		t.Fatalf("ParseXML() error = %v", err)
+	}
+
+	report, err := Compare(set, exported)
+	if err != nil {
+		t.Fatalf("Compare() error = %v", err)
+	}
+	if !report.Empty() {
+		t.Errorf("expected no changes against own export, got %+v", report)
+	}
+}
+
+func TestReportOutput(t *testing.T) {
+	report := &Report{
+		Added:    []Entry{{Names: []string{"News"}, Query: "from:news", Actions: []string{"label:news"}}},
+		Removed:  []Entry{},
+		Modified: []Modification{{Query: "list:a", Added: []string{"star"}}},
+	}
+
+	var text bytes.Buffer
+	if err := report.WriteText(&text); err != nil {
+		t.Fatalf("WriteText() error = %v", err)
+	}
+	for _, want := range []string{"+ News: from:news", "actions: label:news", "~ list:a", "    + star", "1 added, 0 removed, 1 modified"} {
+		if !strings.Contains(text.String(), want) {
+			t.Errorf("text output missing %q:\n%s", want, text.String())
+		}
+	}
+
+	var out bytes.Buffer
+	if err := report.WriteJSON(&out); err != nil {
+		t.Fatalf("WriteJSON() error = %v", err)
+	}
+	var decoded Report
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("invalid JSON output: %v", err)
+	}
+	if len(decoded.Added) != 1 || decoded.Added[0].Query != "from:news" {
+		t.Errorf("decoded JSON = %+v", decoded)
+	}
+}
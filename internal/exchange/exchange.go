@@ -0,0 +1,438 @@
+// Package exchange converts filter sets into Microsoft Exchange inbox rules,
+// as used by Outlook and Microsoft 365, modelled on the Microsoft Graph
+// messageRule resource.
+package exchange
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/brendanryan/gmail-brita/internal/filter"
+	"github.com/brendanryan/gmail-brita/internal/query"
+)
+
+// ArchiveFolder is the folder messages are moved to when a filter archives
+// them without applying a label
+const ArchiveFolder = "Archive"
+
+// maxSize is the largest size Graph accepts in a size range, used when a
+// filter only sets a minimum
+const maxSize = math.MaxInt32
+
+// Rule is an inbox rule as used by Graph's mailFolders/inbox/messageRules
+type Rule struct {
+	DisplayName string      `json:"displayName"`
+	Sequence    int         `json:"sequence"`
+	IsEnabled   bool        `json:"isEnabled"`
+	Conditions  *Predicates `json:"conditions,omitempty"`
+	Exceptions  *Predicates `json:"exceptions,omitempty"`
+	Actions     Actions     `json:"actions"`
+}
+
+// Predicates are the conditions or exceptions of a rule. Values within a
+// list match when any of them does, while every predicate that is set must
+// match.
+type Predicates struct {
+	FromAddresses         []Recipient `json:"fromAddresses,omitempty"`
+	SenderContains        []string    `json:"senderContains,omitempty"`
+	SentToAddresses       []Recipient `json:"sentToAddresses,omitempty"`
+	RecipientContains     []string    `json:"recipientContains,omitempty"`
+	SubjectContains       []string    `json:"subjectContains,omitempty"`
+	BodyOrSubjectContains []string    `json:"bodyOrSubjectContains,omitempty"`
+	HasAttachments        bool        `json:"hasAttachments,omitempty"`
+	WithinSizeRange       *SizeRange  `json:"withinSizeRange,omitempty"`
+}
+
+// SizeRange bounds a message's size in kilobytes
+type SizeRange struct {
+	MinimumSize int64 `json:"minimumSize"`
+	MaximumSize int64 `json:"maximumSize"`
+}
+
+// Actions are what a rule does to the messages it matches. Folders are
+// named by their path, with / between nested folders, and must be replaced
+// by folder IDs before the rule is sent to Graph.
+type Actions struct {
+	MoveToFolder   string      `json:"moveToFolder,omitempty"`
+	CopyToFolder   string      `json:"copyToFolder,omitempty"`
+	MarkAsRead     bool        `json:"markAsRead,omitempty"`
+	MarkImportance string      `json:"markImportance,omitempty"`
+	Delete         bool        `json:"delete,omitempty"`
+	ForwardTo      []Recipient `json:"forwardTo,omitempty"`
+	// StopProcessingRules is always false, since Gmail applies every
+	// matching filter
+	StopProcessingRules bool `json:"stopProcessingRules"`
+}
+
+// Recipient is an email address in a rule
+type Recipient struct {
+	EmailAddress EmailAddress `json:"emailAddress"`
+}
+
+// EmailAddress is the address of a Recipient
+type EmailAddress struct {
+	Address string `json:"address"`
+}
+
+// UnsupportedError reports part of a filter that has no inbox rule
+// equivalent. A filter with unsupported conditions is left out, while
+// unsupported actions are dropped from its rule.
+type UnsupportedError struct {
+	Filter string
+	// Feature is the search term or action that was not translated
+	Feature string
+	// Skipped reports whether the whole filter was left out
+	Skipped bool
+}
+
+func (e *UnsupportedError) Error() string {
+	if e.Skipped {
+		return fmt.Sprintf("filter %q skipped: %s cannot be expressed as an Exchange inbox rule", e.Filter, e.Feature)
+	}
+	return fmt.Sprintf("filter %q: %s is not translated to Exchange", e.Filter, e.Feature)
+}
+
+// Convert translates a filter set into inbox rules, returning the parts of
+// filters that could not be translated alongside them. Labels become
+// folders, copied into unless the filter archives, in which case the
+// message is moved into the first label's folder, and one further rule
+// copies it into each other label's. Stars, categories and never_spam
+// have no equivalent.
+func Convert(set *filter.Set) ([]Rule, []*UnsupportedError, error) {
+	c := &converter{names: make(map[string]int)}
+	for i, f := range set.Filters {
+		if err := c.filter(f, i); err != nil {
+			return nil, nil, err
+		}
+	}
+	return c.rules, c.unsupported, nil
+}
+
+// converter accumulates the rules written for a filter set
+type converter struct {
+	rules       []Rule
+	unsupported []*UnsupportedError
+	names       map[string]int
+}
+
+// filter writes the rules for a single filter
+func (c *converter) filter(f *filter.Filter, index int) error {
+	name := strings.Join(strings.Fields(f.Name), " ")
+	if name == "" {
+		name = fmt.Sprintf("Filter %d", index+1)
+	}
+
+	q, err := f.Query()
+	if err != nil {
+		return fmt.Errorf("filter %q: %w", f.Name, err)
+	}
+	p := &predicates{used: make(map[string]bool)}
+	if q != nil {
+		p.add(q)
+	}
+	if len(p.unsupported) > 0 {
+		c.unsupported = append(c.unsupported, &UnsupportedError{
+			Filter:  name,
+			Feature: strings.Join(p.unsupported, ", "),
+			Skipped: true,
+		})
+		return nil
+	}
+
+	actions, skipped := translateActions(f)
+	for _, s := range skipped {
+		c.unsupported = append(c.unsupported, &UnsupportedError{Filter: name, Feature: s})
+	}
+
+	folders := f.Labels
+	if f.Archive && len(folders) == 0 {
+		folders = []string{ArchiveFolder}
+	}
+	// Copies into further folders come first, so they still see the
+	// message when the main rule moves it
+	if len(folders) > 1 {
+		for _, folder := range folders[1:] {
+			c.add(name+": "+folder, p, Actions{CopyToFolder: folder})
+		}
+	}
+	if len(folders) > 0 {
+		if f.Archive {
+			actions.MoveToFolder = folders[0]
+		} else {
+			actions.CopyToFolder = folders[0]
+		}
+	}
+
+	if !actions.any() {
+		c.unsupported = append(c.unsupported, &UnsupportedError{
+			Filter:  name,
+			Feature: "a filter with no translatable actions",
+			Skipped: true,
+		})
+		return nil
+	}
+	c.add(name, p, actions)
+	return nil
+}
+
+// add appends a rule, numbering it after any earlier rule of the same name
+// since Exchange requires rule names to be unique
+func (c *converter) add(name string, p *predicates, actions Actions) {
+	c.names[name]++
+	if n := c.names[name]; n > 1 {
+		name = fmt.Sprintf("%s #%d", name, n)
+	}
+	c.rules = append(c.rules, Rule{
+		DisplayName: name,
+		Sequence:    len(c.rules) + 1,
+		IsEnabled:   true,
+		Conditions:  p.conditions.orNil(),
+		Exceptions:  p.exceptions.orNil(),
+		Actions:     actions,
+	})
+}
+
+// translateActions converts the filter's actions other than its labels,
+// returning those that have no equivalent separately
+func translateActions(f *filter.Filter) (actions Actions, skipped []string) {
+	actions.MarkAsRead = f.MarkRead
+	actions.Delete = f.Trash
+	if f.MarkImportant {
+		actions.MarkImportance = "high"
+	}
+	if f.NeverImportant {
+		actions.MarkImportance = "low"
+	}
+	if f.ForwardTo != "" {
+		actions.ForwardTo = []Recipient{recipient(f.ForwardTo)}
+	}
+
+	if f.Star {
+		skipped = append(skipped, "star")
+	}
+	if f.NeverSpam {
+		skipped = append(skipped, "never_spam")
+	}
+	if f.Category != "" {
+		skipped = append(skipped, "category "+f.Category)
+	}
+	return actions, skipped
+}
+
+// any reports whether any action is set
+func (a Actions) any() bool {
+	return a.MoveToFolder != "" || a.CopyToFolder != "" || a.MarkAsRead ||
+		a.MarkImportance != "" || a.Delete || len(a.ForwardTo) > 0
+}
+
+// predicates collects a filter's conditions and exceptions from its query.
+// Conditions are ANDed, so each kind of condition may only be set once,
+// while exceptions are ORed and may be added to freely.
+type predicates struct {
+	conditions  Predicates
+	exceptions  Predicates
+	used        map[string]bool
+	unsupported []string
+}
+
+// add translates a query. The top level must be an AND of words, ORs of
+// words of the same kind and negations of words or ORs of words.
+func (p *predicates) add(n query.Node) {
+	terms, ok := n.(query.And)
+	if !ok {
+		terms = query.And{n}
+	}
+	for _, t := range terms {
+		switch v := t.(type) {
+		case query.Word:
+			p.condition(t, []query.Word{v})
+		case query.Or:
+			words, ok := wordsOf(v)
+			if !ok {
+				p.unsupported = append(p.unsupported, t.String())
+				continue
+			}
+			p.condition(t, words)
+		case query.Not:
+			words, ok := wordsOf(v.X)
+			if !ok {
+				p.unsupported = append(p.unsupported, t.String())
+				continue
+			}
+			for _, w := range words {
+				// A second size exception cannot share the one size range
+				if p.exceptions.WithinSizeRange != nil && isSize(w) {
+					p.unsupported = append(p.unsupported, "-"+w.String())
+					continue
+				}
+				if _, ok := p.exceptions.add(w); !ok {
+					p.unsupported = append(p.unsupported, "-"+w.String())
+				}
+			}
+		default:
+			p.unsupported = append(p.unsupported, t.String())
+		}
+	}
+}
+
+// condition adds words that must match, any one of them, as a condition
+func (p *predicates) condition(n query.Node, words []query.Word) {
+	var conditions Predicates
+	kind := ""
+	for _, w := range words {
+		k, ok := conditions.add(w)
+		if !ok || (kind != "" && k != kind) {
+			p.unsupported = append(p.unsupported, n.String())
+			return
+		}
+		kind = k
+	}
+	if p.used[kind] {
+		p.unsupported = append(p.unsupported, n.String())
+		return
+	}
+	p.used[kind] = true
+	p.conditions.merge(conditions)
+}
+
+// wordsOf returns the words of a single word or an OR of words
+func wordsOf(n query.Node) ([]query.Word, bool) {
+	switch v := n.(type) {
+	case query.Word:
+		return []query.Word{v}, true
+	case query.Or:
+		words := make([]query.Word, 0, len(v))
+		to := make(map[string]bool)
+		for _, c := range v {
+			w, ok := c.(query.Word)
+			if !ok {
+				return nil, false
+			}
+			if strings.EqualFold(w.Op, "to") {
+				to[strings.ToLower(w.Value)] = true
+			}
+			words = append(words, w)
+		}
+		// Gmail's to: also searches Cc, so cc: beside a to: of the same
+		// address adds nothing, as in archive_unless_directed's condition
+		kept := words[:0]
+		for _, w := range words {
+			if !strings.EqualFold(w.Op, "cc") || !to[strings.ToLower(w.Value)] {
+				kept = append(kept, w)
+			}
+		}
+		return kept, true
+	default:
+		return nil, false
+	}
+}
+
+// add translates a single search term into a predicate, returning the kind
+// of predicate set and whether the term could be translated
+func (p *Predicates) add(w query.Word) (string, bool) {
+	op := strings.ToLower(w.Op)
+	value := w.Value
+	switch op {
+	case "":
+		p.BodyOrSubjectContains = append(p.BodyOrSubjectContains, value)
+	case "subject":
+		p.SubjectContains = append(p.SubjectContains, value)
+	case "from":
+		// Addresses and partial addresses are kept apart, since Exchange
+		// requires both kinds of predicate to match
+		if isAddress(value) {
+			p.FromAddresses = append(p.FromAddresses, recipient(value))
+			op = "from-address"
+		} else {
+			p.SenderContains = append(p.SenderContains, value)
+		}
+	case "to":
+		if isAddress(value) {
+			p.SentToAddresses = append(p.SentToAddresses, recipient(value))
+			op = "to-address"
+		} else {
+			p.RecipientContains = append(p.RecipientContains, value)
+		}
+	case "has":
+		if !strings.EqualFold(value, "attachment") {
+			return "", false
+		}
+		p.HasAttachments = true
+	case "larger", "size", "smaller":
+		size, err := query.ParseSize(value)
+		if err != nil {
+			return "", false
+		}
+		if p.WithinSizeRange == nil {
+			p.WithinSizeRange = &SizeRange{MaximumSize: maxSize}
+		}
+		if op == "smaller" {
+			p.WithinSizeRange.MaximumSize = size / query.Kilobyte
+		} else {
+			op = "larger"
+			p.WithinSizeRange.MinimumSize = (size + query.Kilobyte - 1) / query.Kilobyte
+		}
+	default:
+		return "", false
+	}
+	return op, true
+}
+
+// merge adds the predicates set in o
+func (p *Predicates) merge(o Predicates) {
+	p.FromAddresses = append(p.FromAddresses, o.FromAddresses...)
+	p.SenderContains = append(p.SenderContains, o.SenderContains...)
+	p.SentToAddresses = append(p.SentToAddresses, o.SentToAddresses...)
+	p.RecipientContains = append(p.RecipientContains, o.RecipientContains...)
+	p.SubjectContains = append(p.SubjectContains, o.SubjectContains...)
+	p.BodyOrSubjectContains = append(p.BodyOrSubjectContains, o.BodyOrSubjectContains...)
+	p.HasAttachments = p.HasAttachments || o.HasAttachments
+	if r := o.WithinSizeRange; r != nil {
+		if p.WithinSizeRange == nil {
+			p.WithinSizeRange = &SizeRange{MaximumSize: maxSize}
+		}
+		if r.MinimumSize > p.WithinSizeRange.MinimumSize {
+			p.WithinSizeRange.MinimumSize = r.MinimumSize
+		}
+		if r.MaximumSize < p.WithinSizeRange.MaximumSize {
+			p.WithinSizeRange.MaximumSize = r.MaximumSize
+		}
+	}
+}
+
+// orNil returns nil when no predicate is set
+func (p Predicates) orNil() *Predicates {
+	if p.empty() {
+		return nil
+	}
+	return &p
+}
+
+// empty reports whether no predicate is set
+func (p Predicates) empty() bool {
+	return len(p.FromAddresses) == 0 && len(p.SenderContains) == 0 &&
+		len(p.SentToAddresses) == 0 && len(p.RecipientContains) == 0 &&
+		len(p.SubjectContains) == 0 && len(p.BodyOrSubjectContains) == 0 &&
+		!p.HasAttachments && p.WithinSizeRange == nil
+}
+
+// isSize reports whether a search term compares the message size
+func isSize(w query.Word) bool {
+	switch strings.ToLower(w.Op) {
+	case "larger", "size", "smaller":
+		return true
+	}
+	return false
+}
+
+// isAddress reports whether a search value is a complete email address
+func isAddress(value string) bool {
+	at := strings.Index(value, "@")
+	return at > 0 && at < len(value)-1 && !strings.ContainsAny(value, "*\" ")
+}
+
+// recipient wraps an address as a Recipient
+func recipient(address string) Recipient {
+	return Recipient{EmailAddress: EmailAddress{Address: address}}
+}
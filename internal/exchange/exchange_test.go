@@ -0,0 +1,154 @@
+package exchange
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/brendanryan/gmail-brita/internal/filter"
+	"github.com/brendanryan/gmail-brita/internal/query"
+)
+
+func testSet() *filter.Set {
+	set := filter.NewFilterSet([]string{"me@example.com"})
+	filter.NewBuilder(set).Name("Robots").
+		From([]string{"robots@bigco.com", "alerts@bigco.com"}).
+		HasNot([]string{"urgent"}).
+		Label("work/robots").
+		Label("todo").
+		Archive().
+		MarkRead()
+	filter.NewBuilder(set).Name("Deals").
+		Subject([]string{"sale"}).
+		Larger(5 * query.Megabyte).
+		Star().
+		MarkImportant()
+	filter.NewBuilder(set).Name("Lists").
+		List([]string{"dev@lists.example.com"}).
+		Label("lists")
+	filter.NewBuilder(set).Name("O'Brien").
+		From([]string{"bigco.com"}).
+		Has([]string{"has:attachment"}).
+		Trash()
+	filter.NewBuilder(set).Name("Either").
+		Has([]string{"from:a@example.com OR subject:b"}).
+		Label("either")
+	return set
+}
+
+func TestConvert(t *testing.T) {
+	rules, unsupported, err := Convert(testSet())
+	if err != nil {
+		t.Fatalf("Convert() error = %v", err)
+	}
+
+	var names []string
+	for _, r := range rules {
+		names = append(names, r.DisplayName)
+	}
+	if got, want := strings.Join(names, ", "), "Robots: todo, Robots, Deals, O'Brien"; got != want {
+		t.Fatalf("rules = %s, want %s", got, want)
+	}
+
+	copied, robots := rules[0], rules[1]
+	if copied.Actions.CopyToFolder != "todo" || !reflect.DeepEqual(copied.Conditions, robots.Conditions) {
+		t.Errorf("copy rule = %+v", copied)
+	}
+	if robots.Actions.MoveToFolder != "work/robots" || !robots.Actions.MarkAsRead {
+		t.Errorf("Robots actions = %+v", robots.Actions)
+	}
+	if c := robots.Conditions; len(c.FromAddresses) != 2 || c.FromAddresses[1].EmailAddress.Address != "alerts@bigco.com" {
+		t.Errorf("Robots conditions = %+v", c)
+	}
+	if e := robots.Exceptions; e == nil || strings.Join(e.BodyOrSubjectContains, ",") != "urgent" {
+		t.Errorf("Robots exceptions = %+v", e)
+	}
+
+	deals := rules[2]
+	if r := deals.Conditions.WithinSizeRange; r == nil || r.MinimumSize != 5120 || r.MaximumSize != maxSize {
+		t.Errorf("Deals size range = %+v", r)
+	}
+	if deals.Actions.MarkImportance != "high" {
+		t.Errorf("Deals actions = %+v", deals.Actions)
+	}
+
+	obrien := rules[3]
+	if c := obrien.Conditions; !c.HasAttachments || strings.Join(c.SenderContains, ",") != "bigco.com" || !obrien.Actions.Delete {
+		t.Errorf("O'Brien rule = %+v", obrien)
+	}
+
+	var got []string
+	for _, u := range unsupported {
+		got = append(got, u.Error())
+	}
+	want := []string{
+		`filter "Deals": star is not translated to Exchange`,
+		`filter "Lists" skipped: list:dev@lists.example.com cannot be expressed as an Exchange inbox rule`,
+		`filter "Either" skipped: from:a@example.com OR subject:b cannot be expressed as an Exchange inbox rule`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unsupported =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestConvertRepeatedConditions(t *testing.T) {
+	set := filter.NewFilterSet([]string{"me@example.com"})
+	// Exchange ORs values within a condition, so ANDed subjects cannot be
+	// expressed, while excluded subjects can
+	filter.NewBuilder(set).Name("Both").
+		Has([]string{"subject:a", "subject:b"}).
+		Label("both")
+	filter.NewBuilder(set).Name("Neither").
+		Has([]string{"-subject:a", "-subject:b"}).
+		Label("neither")
+	// Gmail's to: covers cc:, so the cc: term is dropped
+	filter.NewBuilder(set).Name("Undirected").
+		Has([]string{"-(to:me@example.com OR cc:me@example.com)"}).
+		Archive()
+
+	rules, unsupported, err := Convert(set)
+	if err != nil {
+		t.Fatalf("Convert() error = %v", err)
+	}
+	if len(rules) != 2 || rules[0].DisplayName != "Neither" || len(unsupported) != 1 {
+		t.Fatalf("Convert() = %+v, %v", rules, unsupported)
+	}
+	if e := rules[0].Exceptions; e == nil || strings.Join(e.SubjectContains, ",") != "a,b" {
+		t.Errorf("exceptions = %+v", e)
+	}
+	if e := rules[1].Exceptions; e == nil || len(e.SentToAddresses) != 1 || rules[1].Actions.MoveToFolder != ArchiveFolder {
+		t.Errorf("Undirected rule = %+v", rules[1])
+	}
+}
+
+func TestPowerShell(t *testing.T) {
+	rules, unsupported, err := Convert(testSet())
+	if err != nil {
+		t.Fatalf("Convert() error = %v", err)
+	}
+	script := string(PowerShell(rules, unsupported))
+
+	for _, want := range []string{
+		"# Not translated: filter \"Lists\" skipped: list:dev@lists.example.com cannot be expressed as an Exchange inbox rule\n",
+		"param(\n    [Parameter(Mandatory = $true)]\n    [string]$Mailbox\n)\n",
+		"New-InboxRule -Mailbox $Mailbox `\n" +
+			"    -Name 'Robots' `\n" +
+			"    -From 'robots@bigco.com', 'alerts@bigco.com' `\n" +
+			"    -ExceptIfSubjectOrBodyContainsWords 'urgent' `\n" +
+			"    -MoveToFolder ($Mailbox + ':\\work\\robots') `\n" +
+			"    -MarkAsRead $true `\n" +
+			"    -StopProcessingRules $false\n",
+		"-Name 'O''Brien'",
+		"-WithinSizeRangeMinimum '5120KB'",
+		"-MarkImportance 'High'",
+		"-HasAttachment $true",
+		"-DeleteMessage $true",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("script missing %q:\n%s", want, script)
+		}
+	}
+	if strings.Contains(script, "WithinSizeRangeMaximum") {
+		t.Errorf("script sets a maximum size:\n%s", script)
+	}
+}
@@ -0,0 +1,141 @@
+package exchange
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PowerShell renders rules as an Exchange Online PowerShell script of
+// New-InboxRule commands. The script takes the mailbox as its -Mailbox
+// parameter, and the folders the rules use must already exist in it.
+// Unsupported features are listed in comments at the top.
+func PowerShell(rules []Rule, unsupported []*UnsupportedError) []byte {
+	var b strings.Builder
+	b.WriteString("# Generated by gmail-brita\n")
+	b.WriteString("# Run in an Exchange Online PowerShell session, such as after Connect-ExchangeOnline\n")
+	for _, u := range unsupported {
+		fmt.Fprintf(&b, "# Not translated: %s\n", u.Error())
+	}
+	b.WriteString("\nparam(\n    [Parameter(Mandatory = $true)]\n    [string]$Mailbox\n)\n")
+
+	for _, r := range rules {
+		args := []string{"-Mailbox $Mailbox", "-Name " + psString(r.DisplayName)}
+		if r.Conditions != nil {
+			args = append(args, r.Conditions.psArgs("")...)
+		}
+		if r.Exceptions != nil {
+			args = append(args, r.Exceptions.psArgs("ExceptIf")...)
+		}
+		args = append(args, r.Actions.psArgs()...)
+
+		fmt.Fprintf(&b, "\nNew-InboxRule %s", strings.Join(args, " `\n    "))
+		b.WriteString("\n")
+	}
+	return []byte(b.String())
+}
+
+// psArgs returns the New-InboxRule parameters for the predicates, each
+// name prefixed as given
+func (p *Predicates) psArgs(prefix string) []string {
+	var args []string
+	arg := func(name, value string) {
+		args = append(args, "-"+prefix+name+" "+value)
+	}
+	if len(p.FromAddresses) > 0 {
+		arg("From", psAddresses(p.FromAddresses))
+	}
+	if len(p.SenderContains) > 0 {
+		arg("FromAddressContainsWords", psList(p.SenderContains))
+	}
+	if len(p.SentToAddresses) > 0 {
+		arg("SentTo", psAddresses(p.SentToAddresses))
+	}
+	if len(p.RecipientContains) > 0 {
+		arg("RecipientAddressContainsWords", psList(p.RecipientContains))
+	}
+	if len(p.SubjectContains) > 0 {
+		arg("SubjectContainsWords", psList(p.SubjectContains))
+	}
+	if len(p.BodyOrSubjectContains) > 0 {
+		arg("SubjectOrBodyContainsWords", psList(p.BodyOrSubjectContains))
+	}
+	if p.HasAttachments {
+		arg("HasAttachment", "$true")
+	}
+	if r := p.WithinSizeRange; r != nil {
+		if r.MinimumSize > 0 {
+			arg("WithinSizeRangeMinimum", fmt.Sprintf("'%dKB'", r.MinimumSize))
+		}
+		if r.MaximumSize < maxSize {
+			arg("WithinSizeRangeMaximum", fmt.Sprintf("'%dKB'", r.MaximumSize))
+		}
+	}
+	return args
+}
+
+// psArgs returns the New-InboxRule parameters for the actions
+func (a Actions) psArgs() []string {
+	var args []string
+	if a.MoveToFolder != "" {
+		args = append(args, "-MoveToFolder "+psFolder(a.MoveToFolder))
+	}
+	if a.CopyToFolder != "" {
+		args = append(args, "-CopyToFolder "+psFolder(a.CopyToFolder))
+	}
+	if a.MarkAsRead {
+		args = append(args, "-MarkAsRead $true")
+	}
+	if a.MarkImportance != "" {
+		args = append(args, "-MarkImportance "+psString(psImportance[a.MarkImportance]))
+	}
+	if a.Delete {
+		args = append(args, "-DeleteMessage $true")
+	}
+	if len(a.ForwardTo) > 0 {
+		args = append(args, "-ForwardTo "+psAddresses(a.ForwardTo))
+	}
+	return append(args, "-StopProcessingRules $false")
+}
+
+// psImportance maps Graph's importance values to New-InboxRule's
+var psImportance = map[string]string{"high": "High", "normal": "Normal", "low": "Low"}
+
+// psFolder returns the path of a folder in the script's mailbox, with
+// nested labels separated by backslashes as Exchange expects
+func psFolder(folder string) string {
+	return "($Mailbox + " + psString(`:\`+strings.ReplaceAll(folder, "/", `\`)) + ")"
+}
+
+// psAddresses renders recipients as a PowerShell list of addresses
+func psAddresses(recipients []Recipient) string {
+	addresses := make([]string, 0, len(recipients))
+	for _, r := range recipients {
+		addresses = append(addresses, r.EmailAddress.Address)
+	}
+	return psList(addresses)
+}
+
+// psList renders values as a comma separated PowerShell list
+func psList(values []string) string {
+	quoted := make([]string, 0, len(values))
+	for _, v := range values {
+		quoted = append(quoted, psString(v))
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// psString quotes a value as a literal PowerShell string. PowerShell also
+// ends single-quoted strings at typographic single quotes, so those are
+// doubled as well.
+func psString(s string) string {
+	var b strings.Builder
+	b.WriteByte('\'')
+	for _, r := range s {
+		if strings.ContainsRune("'\u2018\u2019\u201a\u201b", r) {
+			b.WriteRune(r)
+		}
+		b.WriteRune(r)
+	}
+	b.WriteByte('\'')
+	return b.String()
+}
@@ -8,7 +8,6 @@ import (
 type Builder struct {
 	filter *Filter
 	set    *Set
-	chain  []*Filter
 }
 
 // NewBuilder creates a new filter builder
@@ -16,10 +15,27 @@ func NewBuilder(set *Set) *Builder {
 	return &Builder{
 		filter: set.AddFilter(),
 		set:    set,
-		chain:  make([]*Filter, 0),
 	}
 }
 
+// Filter returns the filter being built
+func (b *Builder) Filter() *Filter {
+	return b.filter
+}
+
+// Name sets a descriptive name for the filter, used in reports
+func (b *Builder) Name(name string) *Builder {
+	b.filter.Name = name
+	return b
+}
+
+// LintIgnore excludes lint rules from being reported for the filter and
+// for companion filters derived from it afterwards
+func (b *Builder) LintIgnore(rules ...string) *Builder {
+	b.filter.LintIgnore = append(b.filter.LintIgnore, rules...)
+	return b
+}
+
 // Has adds positive match conditions to the filter
 func (b *Builder) Has(words []string) *Builder {
 	b.filter.HasWords = append(b.filter.HasWords, words...)
@@ -32,6 +48,87 @@ func (b *Builder) HasNot(words []string) *Builder {
 	return b
 }
 
+// Where adds a boolean condition expression to the filter, which must match
+// in addition to any other conditions
+func (b *Builder) Where(c Condition) *Builder {
+	b.filter.Condition = and(b.filter.Condition, c)
+	return b
+}
+
+// From adds sender conditions to the filter, matching any of the addresses
+func (b *Builder) From(addrs []string) *Builder {
+	b.filter.From = append(b.filter.From, addrs...)
+	return b
+}
+
+// To adds recipient conditions to the filter, matching any of the addresses
+func (b *Builder) To(addrs []string) *Builder {
+	b.filter.To = append(b.filter.To, addrs...)
+	return b
+}
+
+// Subject adds subject conditions to the filter, matching any of the phrases
+func (b *Builder) Subject(phrases []string) *Builder {
+	b.filter.Subject = append(b.filter.Subject, phrases...)
+	return b
+}
+
+// Cc adds carbon-copy recipient conditions to the filter, matching any of the addresses
+func (b *Builder) Cc(addrs []string) *Builder {
+	return b.operator("cc", addrs)
+}
+
+// Bcc adds blind-copy recipient conditions to the filter, matching any of the addresses
+func (b *Builder) Bcc(addrs []string) *Builder {
+	return b.operator("bcc", addrs)
+}
+
+// List adds mailing list conditions to the filter, matching any of the lists
+func (b *Builder) List(lists []string) *Builder {
+	return b.operator("list", lists)
+}
+
+// DeliveredTo adds delivery address conditions to the filter, matching any of the addresses
+func (b *Builder) DeliveredTo(addrs []string) *Builder {
+	return b.operator("deliveredto", addrs)
+}
+
+// Filename adds attachment name conditions to the filter, matching any of the names
+func (b *Builder) Filename(names []string) *Builder {
+	return b.operator("filename", names)
+}
+
+// Larger adds a condition matching messages larger than the given size
+func (b *Builder) Larger(bytes int64) *Builder {
+	return b.size(Larger, bytes)
+}
+
+// Smaller adds a condition matching messages smaller than the given size
+func (b *Builder) Smaller(bytes int64) *Builder {
+	return b.size(Smaller, bytes)
+}
+
+// size sets the filter's size condition. Gmail filters have a single size
+// field, so a second size condition is added as a search term instead.
+func (b *Builder) size(op SizeOperator, bytes int64) *Builder {
+	size := &Size{Operator: op, Bytes: bytes}
+	if b.filter.Size == nil {
+		b.filter.Size = size
+	} else {
+		b.filter.HasWords = append(b.filter.HasWords, size.word().String())
+	}
+	return b
+}
+
+// operator adds a search term for an operator without a dedicated Gmail filter property
+func (b *Builder) operator(op string, values []string) *Builder {
+	if len(values) == 0 {
+		return b
+	}
+	b.filter.HasWords = append(b.filter.HasWords, operatorTerm(op, values))
+	return b
+}
+
 // Label adds a label action to the filter
 func (b *Builder) Label(label string) *Builder {
 	b.filter.Labels = append(b.filter.Labels, label)
@@ -62,6 +159,37 @@ func (b *Builder) NeverSpam() *Builder {
 	return b
 }
 
+// Trash adds a delete action to the filter
+func (b *Builder) Trash() *Builder {
+	b.filter.Trash = true
+	return b
+}
+
+// MarkImportant adds an always-mark-as-important action to the filter
+func (b *Builder) MarkImportant() *Builder {
+	b.filter.MarkImportant = true
+	return b
+}
+
+// NeverImportant adds a never-mark-as-important action to the filter
+func (b *Builder) NeverImportant() *Builder {
+	b.filter.NeverImportant = true
+	return b
+}
+
+// Category adds an action moving messages to one of Gmail's inbox
+// categories, named as in Categories
+func (b *Builder) Category(category string) *Builder {
+	b.filter.Category = category
+	return b
+}
+
+// Forward adds an action forwarding messages to the given address
+func (b *Builder) Forward(addr string) *Builder {
+	b.filter.ForwardTo = addr
+	return b
+}
+
 // ArchiveUnlessDirectedOption represents an option for the ArchiveUnlessDirected method
 type ArchiveUnlessDirectedOption func(*Filter)
 
@@ -72,11 +200,23 @@ func WithMarkRead(markRead bool) ArchiveUnlessDirectedOption {
 	}
 }
 
-// ArchiveUnlessDirected creates a chain filter that archives messages unless they are directed to the user
+// ArchiveUnlessDirected creates a companion filter that archives messages unless they are directed to the user
 func (b *Builder) ArchiveUnlessDirected(opts ...ArchiveUnlessDirectedOption) *Builder {
 	// Create a new filter for archiving
 	archiveFilter := b.set.AddFilter()
-	archiveFilter.HasWords = b.filter.HasWords
+	if b.filter.Name != "" {
+		archiveFilter.Name = b.filter.Name + " (archive unless directed)"
+	}
+	archiveFilter.From = append(archiveFilter.From, b.filter.From...)
+	archiveFilter.To = append(archiveFilter.To, b.filter.To...)
+	archiveFilter.Subject = append(archiveFilter.Subject, b.filter.Subject...)
+	archiveFilter.HasWords = append(archiveFilter.HasWords, b.filter.HasWords...)
+	archiveFilter.DoesNotHaveWords = append(archiveFilter.DoesNotHaveWords, b.filter.DoesNotHaveWords...)
+	archiveFilter.Condition = b.filter.Condition
+	archiveFilter.Inherited = b.filter.Inherited
+	archiveFilter.Size = b.filter.Size
+	archiveFilter.LintIgnore = append(archiveFilter.LintIgnore, b.filter.LintIgnore...)
+	archiveFilter.Source = b.filter
 	archiveFilter.Archive = true
 
 	// Add "to:" and "cc:" exclusions for each email
@@ -93,26 +233,33 @@ func (b *Builder) ArchiveUnlessDirected(opts ...ArchiveUnlessDirectedOption) *Bu
 		opt(archiveFilter)
 	}
 
-	// Add to chain
-	b.chain = append(b.chain, archiveFilter)
 	return b
 }
 
-// Otherwise starts a new filter chain branch
-func (b *Builder) Otherwise() *Builder {
-	// Create inverse conditions from the previous filter
-	notConditions := make([]string, 0)
-	for _, has := range b.filter.HasWords {
-		notConditions = append(notConditions, fmt.Sprintf("-%s", has))
+// Also starts a new filter that inherits all of the current filter's
+// conditions. Calling Otherwise on the returned builder starts a sibling
+// branch that also excludes the messages matched by the new filter, so a
+// base condition can be split into if/else-if/else branches.
+func (b *Builder) Also() *Builder {
+	newFilter := b.set.AddFilter()
+	newFilter.Inherited = and(b.filter.Inherited, b.filter.ownCondition())
+
+	return &Builder{
+		filter: newFilter,
+		set:    b.set,
 	}
+}
 
-	// Create a new filter with the inverse conditions
+// Otherwise starts a new filter that applies only to messages the current
+// filter does not match. The new filter inherits the complement of the
+// current filter's own conditions along with anything the current filter
+// inherited itself, so chained calls behave like if/else-if/else.
+func (b *Builder) Otherwise() *Builder {
 	newFilter := b.set.AddFilter()
-	newFilter.HasWords = notConditions
+	newFilter.Inherited = and(b.filter.Inherited, negate(b.filter.ownCondition()))
 
 	return &Builder{
 		filter: newFilter,
 		set:    b.set,
-		chain:  b.chain,
 	}
 }
@@ -2,10 +2,12 @@ package filter
 
 import (
 	"encoding/xml"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 // testdataPath returns an absolute path to a file in the testdata directory
@@ -154,10 +156,10 @@ func TestArchiveUnlessDirected(t *testing.T) {
 
 	// Test basic archive unless directed
 	b.Has([]string{"list:test"}).ArchiveUnlessDirected()
-	if len(b.chain) != 1 {
-		t.Fatal("ArchiveUnlessDirected() did not create chain filter")
+	if len(set.Filters) != 2 || set.Filters[1].Source != b.filter {
+		t.Fatal("ArchiveUnlessDirected() did not create a companion filter")
 	}
-	archiveFilter := b.chain[0]
+	archiveFilter := set.Filters[1]
 	if !archiveFilter.Archive {
 		t.Error("ArchiveUnlessDirected() did not set archive flag")
 	}
@@ -168,12 +170,442 @@ func TestArchiveUnlessDirected(t *testing.T) {
 	// Test with mark read option
 	b = NewBuilder(set)
 	b.Has([]string{"list:test"}).ArchiveUnlessDirected(WithMarkRead(true))
-	archiveFilter = b.chain[0]
+	archiveFilter = set.Filters[len(set.Filters)-1]
 	if !archiveFilter.MarkRead {
 		t.Error("ArchiveUnlessDirected() did not set mark_read flag")
 	}
 }
 
+func TestStructuredConditions(t *testing.T) {
+	set := NewFilterSet([]string{"me@example.com"})
+	NewBuilder(set).
+		From([]string{"mom@example.com", "dad@example.com"}).
+		Subject([]string{"Monthly Statement"}).
+		List([]string{"robots@bigco.com"}).
+		Cc([]string{"a@example.com", "b@example.com"}).
+		Label("test-label")
+
+	got, err := set.ToXML()
+	if err != nil {
+		t.Fatalf("ToXML() error = %v", err)
+	}
+
+	want := map[string]string{
+		"from":       "mom@example.com OR dad@example.com",
+		"subject":    `"Monthly Statement"`,
+		"hasTheWord": "list:robots@bigco.com AND (cc:a@example.com OR cc:b@example.com)",
+	}
+	var feed struct {
+		Entries []struct {
+			Properties []Property `xml:"property"`
+		} `xml:"entry"`
+	}
+	if err := xml.Unmarshal(got, &feed); err != nil {
+		t.Fatalf("failed to parse generated XML: %v", err)
+	}
+	if len(feed.Entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(feed.Entries))
+	}
+	props := make(map[string]string)
+	for _, p := range feed.Entries[0].Properties {
+		props[p.Name] = p.Value
+	}
+	for name, value := range want {
+		if props[name] != value {
+			t.Errorf("property %q = %q, want %q", name, props[name], value)
+		}
+	}
+}
+
+func TestConditionString(t *testing.T) {
+	tests := []struct {
+		name string
+		cond Condition
+		want string
+	}{
+		{
+			name: "single term",
+			cond: Term("from:a@example.com"),
+			want: "from:a@example.com",
+		},
+		{
+			name: "any of terms",
+			cond: Any{Term("from:a"), Term("from:b"), Term("from:c")},
+			want: "from:a OR from:b OR from:c",
+		},
+		{
+			name: "any nested in all",
+			cond: All{Term("list:robots"), Any{Term("subject:a"), Term("subject:b")}},
+			want: "list:robots AND (subject:a OR subject:b)",
+		},
+		{
+			name: "all nested in any",
+			cond: Any{All{Term("a"), Term("b")}, Term("c")},
+			want: "(a AND b) OR c",
+		},
+		{
+			name: "negated group",
+			cond: Not{Condition: Any{Term("subject:a"), Term("subject:b")}},
+			want: "-(subject:a OR subject:b)",
+		},
+		{
+			name: "negated single child group",
+			cond: Not{Condition: All{Term("subject:a")}},
+			want: "-subject:a",
+		},
+		{
+			name: "negated single child wrapping a group",
+			cond: Not{Condition: All{Any{Term("a"), Term("b")}}},
+			want: "-(a OR b)",
+		},
+		{
+			name: "deep nesting",
+			cond: All{Term("a"), Any{Term("b"), Not{Condition: All{Term("c"), Any{Term("d"), Term("e")}}}}},
+			want: "a AND (b OR -(c AND (d OR e)))",
+		},
+		{
+			name: "negated multi-word term",
+			cond: Not{Condition: Term("a b")},
+			want: "-(a b)",
+		},
+		{
+			name: "negated OR term",
+			cond: Not{Condition: Term("a OR b")},
+			want: "-(a OR b)",
+		},
+		{
+			name: "multi-word term in any",
+			cond: Any{Term("a b"), Term("c")},
+			want: "(a b) OR c",
+		},
+		{
+			name: "negated phrase term",
+			cond: Not{Condition: Term(`"a b"`)},
+			want: `-"a b"`,
+		},
+		{
+			name: "negated term already grouped",
+			cond: Not{Condition: Term("(a OR b)")},
+			want: "-(a OR b)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cond.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOtherwiseMultiWordHas(t *testing.T) {
+	tests := []struct {
+		name string
+		has  string
+		want string
+	}{
+		{
+			name: "parsed",
+			has:  "cheap pills",
+			want: "-cheap OR -pills",
+		},
+		{
+			// A term that cannot be parsed is negated as a whole, grouped so
+			// the negation covers every word
+			name: "unparsed",
+			has:  "cheap (pills",
+			want: "-(cheap (pills)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := NewFilterSet([]string{"me@example.com"})
+			NewBuilder(set).Has([]string{tt.has}).Trash().
+				Otherwise().Label("inbox")
+			if got := set.Filters[1].hasTheWord(); got != tt.want {
+				t.Errorf("otherwise hasTheWord = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMultiWordHasNotXML(t *testing.T) {
+	set := NewFilterSet([]string{"me@example.com"})
+	NewBuilder(set).From([]string{"deals@example.com"}).
+		HasNot([]string{"cheap pills", "urgent"}).
+		Trash()
+
+	data, err := set.ToXML()
+	if err != nil {
+		t.Fatalf("ToXML() error = %v", err)
+	}
+	// Gmail would read cheap pills OR urgent as cheap AND (pills OR urgent)
+	want := `<apps:property name="doesNotHaveWord" value="(cheap pills) OR urgent">`
+	if !strings.Contains(string(data), want) {
+		t.Errorf("ToXML() missing %s:\n%s", want, data)
+	}
+}
+
+func TestOtherwise(t *testing.T) {
+	set := NewFilterSet([]string{"me@example.com"})
+	important := NewBuilder(set).
+		Has([]string{"list:robots@bigco.com", `subject:"Very Important"`}).
+		HasNot([]string{"from:boss@bigco.com"}).
+		Label("important")
+	chunder := important.Otherwise().Has([]string{"subject:Chunder"}).Label("chunder")
+	chunder.Otherwise().Label("meh")
+
+	want := []string{
+		`list:robots@bigco.com subject:"Very Important" -from:boss@bigco.com`,
+		`(-list:robots@bigco.com OR -subject:"Very Important" OR from:boss@bigco.com) subject:Chunder`,
+		`(-list:robots@bigco.com OR -subject:"Very Important" OR from:boss@bigco.com) -subject:Chunder`,
+	}
+	if len(set.Filters) != len(want) {
+		t.Fatalf("got %d filters, want %d", len(set.Filters), len(want))
+	}
+	for i, f := range set.Filters {
+		q, err := f.Query()
+		if err != nil {
+			t.Fatalf("Query() error = %v", err)
+		}
+		if got := q.String(); got != want[i] {
+			t.Errorf("filter %d query = %q, want %q", i, got, want[i])
+		}
+	}
+
+	if got := set.Filters[2].hasTheWord(); got != `(-list:robots@bigco.com OR -subject:"Very Important" OR from:boss@bigco.com) AND -subject:Chunder` {
+		t.Errorf("otherwise hasTheWord = %q", got)
+	}
+}
+
+func TestAlso(t *testing.T) {
+	set := NewFilterSet([]string{"me@example.com"})
+	base := NewBuilder(set).Has([]string{"list:robots"})
+	first := base.Also().Has([]string{"subject:a"}).Label("a")
+	first.Otherwise().Has([]string{"subject:b"}).Label("b").Otherwise().Label("rest")
+
+	want := []string{
+		"list:robots",
+		"list:robots subject:a",
+		"list:robots -subject:a subject:b",
+		"list:robots -subject:a -subject:b",
+	}
+	if len(set.Filters) != len(want) {
+		t.Fatalf("got %d filters, want %d", len(set.Filters), len(want))
+	}
+	for i, f := range set.Filters {
+		q, err := f.Query()
+		if err != nil {
+			t.Fatalf("Query() error = %v", err)
+		}
+		if got := q.String(); got != want[i] {
+			t.Errorf("filter %d query = %q, want %q", i, got, want[i])
+		}
+	}
+
+	set.RemoveFilter(base.Filter())
+	if len(set.Filters) != 3 || set.Filters[0] != first.Filter() {
+		t.Error("RemoveFilter() did not remove the base filter")
+	}
+}
+
+func TestParseXML(t *testing.T) {
+	set := NewFilterSet([]string{"me@example.com"})
+	NewBuilder(set).
+		From([]string{"mom@example.com", "dad@example.com"}).
+		Subject([]string{"Monthly Statement"}).
+		Has([]string{"list:robots@bigco.com"}).
+		HasNot([]string{"subject:Chunder", "subject:Semirelevant"}).
+		Label("test-label").
+		Archive().
+		MarkRead().
+		Star().
+		NeverSpam()
+
+	data, err := set.ToXML()
+	if err != nil {
+		t.Fatalf("ToXML() error = %v", err)
+	}
+	parsed, err := ParseXML(data)
+	if err != nil {
+		t.Fatalf("ParseXML() error = %v", err)
+	}
+
+	if len(parsed.Emails) != 1 || parsed.Emails[0] != "me@example.com" {
+		t.Errorf("Emails = %q, want [me@example.com]", parsed.Emails)
+	}
+	if len(parsed.Filters) != 1 {
+		t.Fatalf("got %d filters, want 1", len(parsed.Filters))
+	}
+
+	want, err := set.Filters[0].Query()
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	got, err := parsed.Filters[0].Query()
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if got.String() != want.String() {
+		t.Errorf("parsed query = %q, want %q", got, want)
+	}
+
+	f := parsed.Filters[0]
+	if len(f.Labels) != 1 || f.Labels[0] != "test-label" || !f.Archive || !f.MarkRead || !f.Star || !f.NeverSpam {
+		t.Errorf("actions not parsed correctly: %+v", f)
+	}
+}
+
+func TestReproducibleXML(t *testing.T) {
+	build := func(extra bool) *Set {
+		set := NewFilterSet([]string{"me@example.com"})
+		set.Updated = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+		NewBuilder(set).Has([]string{"list:a"}).Label("a")
+		if extra {
+			NewBuilder(set).Has([]string{"list:new"}).Label("new")
+		}
+		NewBuilder(set).Has([]string{"list:b"}).Label("b")
+		NewBuilder(set).Has([]string{"list:b"}).Label("b")
+		return set
+	}
+
+	first, err := build(false).ToXML()
+	if err != nil {
+		t.Fatalf("ToXML() error = %v", err)
+	}
+	second, err := build(false).ToXML()
+	if err != nil {
+		t.Fatalf("ToXML() error = %v", err)
+	}
+	if string(first) != string(second) {
+		t.Error("ToXML() output differs between runs")
+	}
+	if !strings.Contains(string(first), "<updated>2024-01-02T03:04:05Z</updated>") {
+		t.Error("ToXML() did not use the set's timestamp")
+	}
+
+	entryIDs := func(data []byte) []string {
+		var feed struct {
+			Entries []struct {
+				ID string `xml:"id"`
+			} `xml:"entry"`
+		}
+		if err := xml.Unmarshal(data, &feed); err != nil {
+			t.Fatalf("failed to parse generated XML: %v", err)
+		}
+		ids := make([]string, 0, len(feed.Entries))
+		for _, e := range feed.Entries {
+			ids = append(ids, e.ID)
+		}
+		return ids
+	}
+
+	ids := entryIDs(first)
+	if ids[1] == ids[2] {
+		t.Errorf("identical filters share the ID %q", ids[1])
+	}
+
+	withExtra, err := build(true).ToXML()
+	if err != nil {
+		t.Fatalf("ToXML() error = %v", err)
+	}
+	extraIDs := entryIDs(withExtra)
+	if extraIDs[0] != ids[0] || extraIDs[2] != ids[1] || extraIDs[3] != ids[2] {
+		t.Errorf("inserting a filter changed other IDs: %q -> %q", ids, extraIDs)
+	}
+
+	// Entries gives each filter the ID of its XML entry
+	entries, err := build(true).Entries()
+	if err != nil {
+		t.Fatalf("Entries() error = %v", err)
+	}
+	for i, e := range entries {
+		if "tag:mail.google.com,2008:filter:"+e.EntryID != extraIDs[i] {
+			t.Errorf("entry %d EntryID = %q, want the XML ID %q", i, e.EntryID, extraIDs[i])
+		}
+	}
+}
+
+func TestMultipleLabelEntries(t *testing.T) {
+	set := NewFilterSet([]string{"me@example.com"})
+	NewBuilder(set).
+		From([]string{"billing@example.com"}).
+		Label("finance").
+		Label("todo").
+		Star()
+
+	data, err := set.ToXML()
+	if err != nil {
+		t.Fatalf("ToXML() error = %v", err)
+	}
+
+	parsed, err := ParseXML(data)
+	if err != nil {
+		t.Fatalf("ParseXML() error = %v", err)
+	}
+	if len(parsed.Filters) != 2 {
+		t.Fatalf("got %d entries, want 2", len(parsed.Filters))
+	}
+	first, second := parsed.Filters[0], parsed.Filters[1]
+	if len(first.Labels) != 1 || first.Labels[0] != "finance" || !first.Star {
+		t.Errorf("first entry = labels %q, star %v", first.Labels, first.Star)
+	}
+	if len(second.Labels) != 1 || second.Labels[0] != "todo" || second.Star {
+		t.Errorf("second entry = labels %q, star %v", second.Labels, second.Star)
+	}
+	if len(second.From) != 1 || second.From[0] != "billing@example.com" {
+		t.Errorf("second entry from = %q, want the filter's conditions", second.From)
+	}
+}
+
+func TestExtendedActions(t *testing.T) {
+	set := NewFilterSet([]string{"me@example.com"})
+	NewBuilder(set).
+		Has([]string{"from:deals@example.com"}).
+		Larger(10 * 1024 * 1024).
+		Smaller(20 * 1024 * 1024).
+		Trash().
+		MarkImportant().
+		NeverImportant().
+		Category("promotions").
+		Forward("archive@example.com")
+
+	data, err := set.ToXML()
+	if err != nil {
+		t.Fatalf("ToXML() error = %v", err)
+	}
+	for _, want := range []string{
+		`name="sizeOperator" value="s_sl"`,
+		`name="sizeUnit" value="s_smb"`,
+		`name="size" value="10"`,
+		`name="hasTheWord" value="from:deals@example.com AND smaller:20M"`,
+		`name="shouldTrash" value="true"`,
+		`name="shouldAlwaysMarkAsImportant" value="true"`,
+		`name="shouldNeverMarkAsImportant" value="true"`,
+		`name="smartLabelToApply" value="^smartlabel_promo"`,
+		`name="forwardTo" value="archive@example.com"`,
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("ToXML() output missing %s", want)
+		}
+	}
+
+	parsed, err := ParseXML(data)
+	if err != nil {
+		t.Fatalf("ParseXML() error = %v", err)
+	}
+	got, want := parsed.Filters[0].Actions(), set.Filters[0].Actions()
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("parsed actions = %q, want %q", got, want)
+	}
+	size := parsed.Filters[0].Size
+	if size == nil || size.Operator != Larger || size.Bytes != 10*1024*1024 {
+		t.Errorf("parsed size = %+v", size)
+	}
+}
+
 // Helper functions
 
 func normalizeXML(data []byte) []byte {
@@ -214,3 +646,210 @@ func diffStrings(expected, actual string) string {
 
 	return diff.String()
 }
+
+func TestLimits(t *testing.T) {
+	senders := make([]string, 300)
+	for i := range senders {
+		senders[i] = fmt.Sprintf("sender%03d@spam.example.com", i)
+	}
+	set := NewFilterSet([]string{"me@example.com"})
+	NewBuilder(set).Name("Blocked").From(senders).Label("blocked").Label("spam-ish").Trash()
+	NewBuilder(set).Name("Small").From([]string{"boss@example.com"}).Star()
+
+	errs := set.CheckLimits()
+	if len(errs) != 1 || errs[0].Filter != 1 || errs[0].Length <= MaxQueryLength {
+		t.Fatalf("CheckLimits() = %v, want the Blocked filter over the query limit", errs)
+	}
+	if _, err := set.ToXML(); err != nil {
+		t.Errorf("ToXML() with the default policy error = %v", err)
+	}
+
+	set.Limits = LimitFail
+	if _, err := set.ToXML(); err == nil || !strings.Contains(err.Error(), `filter "Blocked"`) {
+		t.Errorf("ToXML() with LimitFail error = %v, want the Blocked filter reported", err)
+	}
+
+	set.Limits = LimitSplit
+	if errs := set.CheckLimits(); len(errs) != 0 {
+		t.Errorf("CheckLimits() after splitting = %v", errs)
+	}
+	data, err := set.ToXML()
+	if err != nil {
+		t.Fatalf("ToXML() with LimitSplit error = %v", err)
+	}
+	parsed, err := ParseXML(data)
+	if err != nil {
+		t.Fatalf("ParseXML() error = %v", err)
+	}
+
+	// Every sender appears exactly once across the parts, each of which
+	// keeps all of the actions
+	seen := make(map[string]int)
+	parts := 0
+	for _, f := range parsed.Filters {
+		if len(f.From) == 1 && f.From[0] == "boss@example.com" {
+			continue
+		}
+		if f.queryLength() > MaxQueryLength {
+			t.Errorf("part has %d characters of criteria", f.queryLength())
+		}
+		for _, from := range f.From {
+			seen[from]++
+		}
+		if len(f.Labels) == 1 && f.Labels[0] == "blocked" {
+			parts++
+			if !f.Trash {
+				t.Errorf("part %d does not trash messages", parts)
+			}
+		}
+	}
+	if parts < 2 {
+		t.Errorf("Blocked was written as %d parts, want several", parts)
+	}
+	for _, s := range senders {
+		if seen[s] != 2 {
+			t.Errorf("sender %s appears in %d entries, want 2 (one per label)", s, seen[s])
+			break
+		}
+	}
+}
+
+func TestLimitsFilterCount(t *testing.T) {
+	set := NewFilterSet([]string{"me@example.com"})
+	for i := 0; i < MaxFilters; i++ {
+		NewBuilder(set).From([]string{fmt.Sprintf("sender%d@example.com", i)}).Label("a").Label("b")
+	}
+	errs := set.CheckLimits()
+	if len(errs) != 1 || errs[0].Filter != 0 || errs[0].Count != 2*MaxFilters {
+		t.Errorf("CheckLimits() = %v, want the filter count reported", errs)
+	}
+}
+
+func TestSplitAnyCondition(t *testing.T) {
+	terms := make(Any, 0, 200)
+	for i := 0; i < 200; i++ {
+		terms = append(terms, Term(fmt.Sprintf("subject:\"weekly digest %d\"", i)))
+	}
+	f := &Filter{Condition: terms, Archive: true}
+
+	parts := f.split(MaxQueryLength)
+	if len(parts) < 2 {
+		t.Fatalf("split() returned %d parts", len(parts))
+	}
+	total := 0
+	for _, p := range parts {
+		if p.queryLength() > MaxQueryLength || !p.Archive {
+			t.Errorf("part %q", p.hasTheWord())
+		}
+		total += len(p.Condition.(Any))
+	}
+	if total != len(terms) {
+		t.Errorf("parts hold %d terms, want %d", total, len(terms))
+	}
+}
+
+func TestOptimize(t *testing.T) {
+	set := NewFilterSet([]string{"me@example.com"})
+	NewBuilder(set).Name("Alice").From([]string{"alice@example.com"}).Label("friends").Archive()
+	NewBuilder(set).Name("Bob").From([]string{"bob@example.com"}).Label("friends").Archive()
+	NewBuilder(set).Name("Bob again").From([]string{"Bob@example.com"}).Label("friends").Archive()
+	NewBuilder(set).Name("Party").Subject([]string{"party"}).Label("friends").Archive()
+	NewBuilder(set).Name("Boss").From([]string{"boss@example.com"}).Label("work")
+
+	report := set.Optimize()
+	want := OptimizeReport{FiltersBefore: 5, FiltersAfter: 2, EntriesBefore: 5, EntriesAfter: 2}
+	if report != want {
+		t.Errorf("Optimize() = %+v, want %+v", report, want)
+	}
+
+	friends := set.Filters[0]
+	if got := friends.hasTheWord(); got != "from:alice@example.com OR from:bob@example.com OR subject:party" {
+		t.Errorf("merged query = %q", got)
+	}
+	if got := strings.Join(friends.Actions(), ","); got != "archive,label:friends" {
+		t.Errorf("merged actions = %q", got)
+	}
+	if friends.Name != "Alice, Bob, Bob again, Party" {
+		t.Errorf("merged name = %q", friends.Name)
+	}
+	if set.Filters[1].Name != "Boss" {
+		t.Errorf("second filter = %q, want Boss unchanged", set.Filters[1].Name)
+	}
+}
+
+func TestOptimizeLengthLimit(t *testing.T) {
+	set := NewFilterSet([]string{"me@example.com"})
+	for i := 0; i < 300; i++ {
+		NewBuilder(set).From([]string{fmt.Sprintf("sender%03d@spam.example.com", i)}).Trash()
+	}
+
+	report := set.Optimize()
+	if report.FiltersAfter < 2 || report.FiltersAfter > 10 {
+		t.Errorf("Optimize() = %+v, want a handful of filters", report)
+	}
+	if errs := set.CheckLimits(); len(errs) != 0 {
+		t.Errorf("CheckLimits() = %v", errs)
+	}
+	senders := 0
+	for _, f := range set.Filters {
+		senders += len(f.From)
+	}
+	if senders != 300 {
+		t.Errorf("optimized filters match %d senders, want 300", senders)
+	}
+}
+
+func TestToSieve(t *testing.T) {
+	set := NewFilterSet([]string{"me@example.com"})
+	NewBuilder(set).Name("Robots").
+		List([]string{"robots@bigco.com"}).
+		HasNot([]string{"subject:important"}).
+		Label("work/robots").
+		Archive().
+		MarkRead()
+	NewBuilder(set).Name("Boss").
+		From([]string{"boss@example.com", "example.org"}).
+		Label("work").
+		Star().
+		MarkImportant()
+	NewBuilder(set).Name("Huge").
+		Larger(10 * 1024 * 1024).
+		Forward("archive@example.com").
+		Trash()
+	NewBuilder(set).Name("Unread").
+		Has([]string{"is:unread"}).
+		Label("later")
+
+	data, err := set.ToSieve()
+	if err != nil {
+		t.Fatalf("ToSieve() error = %v", err)
+	}
+	want := `# Generated by gmail-brita
+require ["copy", "fileinto", "imap4flags", "mailbox"];
+
+# Robots
+if allof (header :contains ["list-id", "list-post"] ["robots@bigco.com", "robots.bigco.com"], not header :contains "subject" "important") {
+    addflag "\\Seen";
+    fileinto :create "work/robots";
+}
+
+# Boss
+# Not translated: mark_important
+if anyof (address :is ["from", "sender"] "boss@example.com", header :contains ["from", "sender"] "example.org") {
+    addflag "\\Flagged";
+    fileinto :copy :create "work";
+}
+
+# Huge
+if size :over 10485760 {
+    redirect :copy "archive@example.com";
+    discard;
+}
+
+# Unread
+# Skipped: is:unread cannot be expressed in Sieve
+`
+	if string(data) != want {
+		t.Errorf("ToSieve() =\n%s\nwant\n%s", data, want)
+	}
+}
@@ -0,0 +1,198 @@
+package filter
+
+import (
+	"strings"
+
+	"github.com/brendanryan/gmail-brita/internal/query"
+)
+
+// Condition is a node in a filter's boolean condition expression
+type Condition interface {
+	// String renders the condition as a Gmail search query
+	String() string
+}
+
+// Term is a single Gmail search term such as "from:someone@example.com"
+type Term string
+
+// All matches when every child condition matches
+type All []Condition
+
+// Any matches when at least one child condition matches
+type Any []Condition
+
+// Not matches when its child condition does not match
+type Not struct {
+	Condition Condition
+}
+
+// String returns the search term unchanged
+func (t Term) String() string {
+	return string(t)
+}
+
+// String joins the children with AND, grouping any OR children
+func (a All) String() string {
+	return joinConditions([]Condition(a), " AND ", isAny)
+}
+
+// String joins the children with OR, grouping any AND children
+func (a Any) String() string {
+	return joinConditions([]Condition(a), " OR ", isAll)
+}
+
+// String negates the child, grouping it when it is compound
+func (n Not) String() string {
+	if n.Condition == nil {
+		return ""
+	}
+	operand := n.Condition.String()
+	if operand == "" {
+		return ""
+	}
+	if isCompound(n.Condition) {
+		return "-(" + operand + ")"
+	}
+	return "-" + operand
+}
+
+// joinConditions renders the non-empty children joined by sep, wrapping
+// those for which group reports true in parentheses when there is more
+// than one child
+func joinConditions(children []Condition, sep string, group func(Condition) bool) string {
+	rendered := make([]string, 0, len(children))
+	grouped := make([]bool, 0, len(children))
+	for _, c := range children {
+		if c == nil {
+			continue
+		}
+		s := c.String()
+		if s == "" {
+			continue
+		}
+		rendered = append(rendered, s)
+		grouped = append(grouped, group(c))
+	}
+	if len(rendered) == 1 {
+		return rendered[0]
+	}
+	for i := range rendered {
+		if grouped[i] {
+			rendered[i] = "(" + rendered[i] + ")"
+		}
+	}
+	return strings.Join(rendered, sep)
+}
+
+// isAll reports whether c renders as an AND of several conditions
+func isAll(c Condition) bool {
+	return operatorOf(c) == " AND "
+}
+
+// isAny reports whether c renders as an OR of several conditions
+func isAny(c Condition) bool {
+	return operatorOf(c) == " OR "
+}
+
+// isCompound reports whether c renders as more than a single term
+func isCompound(c Condition) bool {
+	return operatorOf(c) != ""
+}
+
+// operatorOf returns the operator joining the top level of the rendered
+// condition, looking through groups with a single child
+func operatorOf(c Condition) string {
+	var children []Condition
+	var op string
+	switch v := c.(type) {
+	case All:
+		children, op = v, " AND "
+	case Any:
+		children, op = v, " OR "
+	case Term:
+		return termOperator(v)
+	default:
+		return ""
+	}
+
+	var last Condition
+	n := 0
+	for _, child := range children {
+		if child != nil && child.String() != "" {
+			last = child
+			n++
+		}
+	}
+	switch n {
+	case 0:
+		return ""
+	case 1:
+		return operatorOf(last)
+	default:
+		return op
+	}
+}
+
+// termOperator returns the operator joining the top level of a raw search
+// term, such as " AND " for "a b" and " OR " for "a OR b". A term that
+// cannot be parsed is treated as an AND when it holds several words, so it
+// is still grouped, and one already in parentheses needs no grouping.
+func termOperator(t Term) string {
+	if enclosed(strings.TrimSpace(string(t))) {
+		return ""
+	}
+	n, err := query.Parse(string(t))
+	if err != nil {
+		if len(strings.Fields(string(t))) > 1 {
+			return " AND "
+		}
+		return ""
+	}
+	switch n.(type) {
+	case query.And:
+		return " AND "
+	case query.Or:
+		return " OR "
+	default:
+		return ""
+	}
+}
+
+// enclosed reports whether s is a single parenthesised group, ignoring
+// parentheses inside quoted phrases
+func enclosed(s string) bool {
+	if !strings.HasPrefix(s, "(") || !strings.HasSuffix(s, ")") {
+		return false
+	}
+	depth := 0
+	quoted := false
+	for i, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case quoted:
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+			if depth == 0 && i < len(s)-1 {
+				return false
+			}
+		}
+	}
+	return depth == 0
+}
+
+// and combines two conditions so that both must match
+func and(a, b Condition) Condition {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	if all, ok := a.(All); ok {
+		return append(all[:len(all):len(all)], b)
+	}
+	return All{a, b}
+}
@@ -0,0 +1,237 @@
+package filter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/brendanryan/gmail-brita/internal/query"
+)
+
+// Gmail's limits on imported filters. Gmail does not document the query
+// limit and starts rejecting filters at a little over MaxQueryLength
+// characters of search criteria.
+const (
+	// MaxQueryLength is the longest search criteria Gmail reliably accepts
+	// for a single filter
+	MaxQueryLength = 1500
+	// MaxFilters is the most filters Gmail keeps for an account
+	MaxFilters = 1000
+)
+
+// LimitPolicy decides what ToXML does with filters that exceed Gmail's
+// limits
+type LimitPolicy string
+
+// Limit policies
+const (
+	// LimitWarn writes filters unchanged, leaving CheckLimits to report
+	// those over the limits. It is the policy used when none is set.
+	LimitWarn LimitPolicy = "warn"
+	// LimitFail makes ToXML return an error when any limit is exceeded
+	LimitFail LimitPolicy = "fail"
+	// LimitSplit divides a filter whose criteria are too long at its
+	// longest OR-list into several filters with the same actions, each
+	// matching some of the alternatives. Filters that cannot be divided
+	// small enough are written as with LimitWarn.
+	LimitSplit LimitPolicy = "split"
+)
+
+// ParseLimitPolicy returns the policy named by s
+func ParseLimitPolicy(s string) (LimitPolicy, error) {
+	switch p := LimitPolicy(s); p {
+	case LimitWarn, LimitFail, LimitSplit:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown limit policy %q; use warn, fail or split", s)
+	}
+}
+
+// LimitError reports output that exceeds one of Gmail's limits
+type LimitError struct {
+	// Filter is the position of the filter in the set, starting at 1, or
+	// zero when the set as a whole has too many filters
+	Filter int
+	Name   string
+	// Length is the length of the filter's longest search criteria
+	Length int
+	// Count is the number of Gmail filters the set is written as
+	Count int
+}
+
+func (e *LimitError) Error() string {
+	if e.Filter == 0 {
+		return fmt.Sprintf("the filters are written as %d Gmail filters, more than Gmail's limit of %d", e.Count, MaxFilters)
+	}
+	name := fmt.Sprintf("filter %d", e.Filter)
+	if e.Name != "" {
+		name = fmt.Sprintf("filter %q", e.Name)
+	}
+	return fmt.Sprintf("%s: search criteria are %d characters, more than Gmail's limit of %d", name, e.Length, MaxQueryLength)
+}
+
+// LimitErrors lists every limit a filter set exceeds
+type LimitErrors []*LimitError
+
+func (e LimitErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "\n")
+}
+
+// CheckLimits reports the limits exceeded by the filters ToXML would write
+// under the set's policy
+func (s *Set) CheckLimits() LimitErrors {
+	_, errs := s.output()
+	return errs
+}
+
+// output returns the filters ToXML writes, divided according to the set's
+// policy, along with the limits they exceed
+func (s *Set) output() ([]*Filter, LimitErrors) {
+	var (
+		filters []*Filter
+		errs    LimitErrors
+	)
+	for i, f := range s.Filters {
+		parts := []*Filter{f}
+		if s.Limits == LimitSplit {
+			parts = f.split(MaxQueryLength)
+		}
+
+		longest := 0
+		for _, part := range parts {
+			if n := part.queryLength(); n > longest {
+				longest = n
+			}
+		}
+		if longest > MaxQueryLength {
+			errs = append(errs, &LimitError{Filter: i + 1, Name: f.Name, Length: longest})
+		}
+		filters = append(filters, parts...)
+	}
+
+	count := 0
+	for _, f := range filters {
+		count += len(f.entries())
+	}
+	if count > MaxFilters {
+		errs = append(errs, &LimitError{Count: count})
+	}
+	return filters, errs
+}
+
+// queryLength returns the length of the search criteria Gmail stores for
+// the filter
+func (f *Filter) queryLength() int {
+	n := 0
+	for _, p := range f.conditionProperties() {
+		switch p.Name {
+		case "from", "to", "subject", "hasTheWord", "doesNotHaveWord":
+			if n > 0 {
+				n++
+			}
+			n += len(p.Value)
+		}
+	}
+	return n
+}
+
+// alternatives is an OR-list in a filter's conditions that may be divided
+// between several filters
+type alternatives struct {
+	count  int
+	length int
+	// keep restricts a copy of the filter to the alternatives from lo up
+	// to hi
+	keep func(g *Filter, lo, hi int)
+}
+
+// alternatives returns the OR-lists in the filter's conditions: the
+// sender, recipient and subject fields, search terms that are an OR at
+// the top level and an any condition
+func (f *Filter) alternatives() []alternatives {
+	var lists []alternatives
+	field := func(values []string, set func(g *Filter, values []string)) {
+		if len(values) < 2 {
+			return
+		}
+		lists = append(lists, alternatives{
+			count:  len(values),
+			length: len(joinValues(values)),
+			keep: func(g *Filter, lo, hi int) {
+				set(g, append([]string(nil), values[lo:hi]...))
+			},
+		})
+	}
+	field(f.From, func(g *Filter, values []string) { g.From = values })
+	field(f.To, func(g *Filter, values []string) { g.To = values })
+	field(f.Subject, func(g *Filter, values []string) { g.Subject = values })
+
+	for i, word := range f.HasWords {
+		n, err := query.Parse(word)
+		if err != nil {
+			continue
+		}
+		or, ok := n.(query.Or)
+		if !ok {
+			continue
+		}
+		i := i
+		lists = append(lists, alternatives{
+			count:  len(or),
+			length: len(word),
+			keep: func(g *Filter, lo, hi int) {
+				g.HasWords = append([]string(nil), g.HasWords...)
+				g.HasWords[i] = query.NewOr(or[lo:hi]...).String()
+			},
+		})
+	}
+
+	if options, ok := f.Condition.(Any); ok && len(options) > 1 {
+		lists = append(lists, alternatives{
+			count:  len(options),
+			length: len(options.String()),
+			keep: func(g *Filter, lo, hi int) {
+				g.Condition = append(Any(nil), options[lo:hi]...)
+			},
+		})
+	}
+	return lists
+}
+
+// split divides a filter whose search criteria are longer than limit at
+// its longest OR-list, returning filters with the same actions whose
+// criteria fit and which together match the same messages. The filter is
+// returned alone when it fits or has no list to divide.
+func (f *Filter) split(limit int) []*Filter {
+	if f.queryLength() <= limit {
+		return []*Filter{f}
+	}
+	var list *alternatives
+	for _, a := range f.alternatives() {
+		a := a
+		if list == nil || a.length > list.length {
+			list = &a
+		}
+	}
+	if list == nil {
+		return []*Filter{f}
+	}
+
+	part := func(lo, hi int) *Filter {
+		g := *f
+		list.keep(&g, lo, hi)
+		return &g
+	}
+	var parts []*Filter
+	lo := 0
+	for hi := 1; hi < list.count; hi++ {
+		if part(lo, hi+1).queryLength() > limit {
+			parts = append(parts, part(lo, hi))
+			lo = hi
+		}
+	}
+	return append(parts, part(lo, list.count))
+}
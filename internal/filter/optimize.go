@@ -0,0 +1,209 @@
+package filter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// OptimizeReport counts the filters in a set before and after Optimize
+type OptimizeReport struct {
+	FiltersBefore int
+	FiltersAfter  int
+	// EntriesBefore and EntriesAfter count the Gmail filters the set is
+	// written as, with one per label
+	EntriesBefore int
+	EntriesAfter  int
+}
+
+func (r OptimizeReport) String() string {
+	return fmt.Sprintf("optimized %d filters (%d Gmail filters) into %d (%d Gmail filters)",
+		r.FiltersBefore, r.EntriesBefore, r.FiltersAfter, r.EntriesAfter)
+}
+
+// Optimize merges filters that perform the same actions into as few
+// filters as fit within Gmail's query length limit, each matching any of
+// the merged conditions. Filters that differ only in their senders are
+// merged into a single from list and identical filters are dropped. Gmail
+// applies every matching filter, so the merged set treats every message
+// the same way as the original.
+func (s *Set) Optimize() OptimizeReport {
+	report := OptimizeReport{
+		FiltersBefore: len(s.Filters),
+		EntriesBefore: s.entryCount(),
+	}
+
+	groups := make(map[string][]*Filter)
+	var order []string
+	filters := make([]*Filter, 0, len(s.Filters))
+	for _, f := range s.Filters {
+		actions := f.Actions()
+		if len(actions) == 0 {
+			filters = append(filters, f)
+			continue
+		}
+		key := strings.Join(actions, "\n")
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], f)
+	}
+	for _, key := range order {
+		filters = append(filters, merge(groups[key])...)
+	}
+	s.Filters = filters
+
+	report.FiltersAfter = len(s.Filters)
+	report.EntriesAfter = s.entryCount()
+	return report
+}
+
+// entryCount returns the number of Gmail filters ToXML writes for the set
+func (s *Set) entryCount() int {
+	filters, _ := s.output()
+	count := 0
+	for _, f := range filters {
+		count += len(f.entries())
+	}
+	return count
+}
+
+// merge combines filters with the same actions. Filters whose conditions
+// match apart from their senders are combined first, then the results are
+// joined into OR queries up to the length limit.
+func merge(group []*Filter) []*Filter {
+	var members []*Filter
+	for _, senders := range bySenders(group) {
+		members = append(members, mergeSenders(senders).split(MaxQueryLength)...)
+	}
+	if len(members) == 1 {
+		return members
+	}
+
+	var merged, batch []*Filter
+	for _, m := range members {
+		if m.fullCondition().String() == "" {
+			// A filter without conditions already matches everything the
+			// others do
+			return []*Filter{m}
+		}
+		if len(batch) > 0 && mergeAny(append(batch[:len(batch):len(batch)], m)).queryLength() > MaxQueryLength {
+			merged = append(merged, mergeAny(batch))
+			batch = nil
+		}
+		batch = append(batch, m)
+	}
+	return append(merged, mergeAny(batch))
+}
+
+// bySenders groups filters whose conditions are the same apart from their
+// from lists, keeping the order in which each group first appears
+func bySenders(filters []*Filter) [][]*Filter {
+	groups := make(map[string]int)
+	var grouped [][]*Filter
+	for _, f := range filters {
+		g := *f
+		g.From = nil
+		var key strings.Builder
+		for _, p := range g.conditionProperties() {
+			fmt.Fprintf(&key, "%s=%s\n", p.Name, p.Value)
+		}
+
+		i, ok := groups[key.String()]
+		if !ok {
+			i = len(grouped)
+			groups[key.String()] = i
+			grouped = append(grouped, nil)
+		}
+		grouped[i] = append(grouped[i], f)
+	}
+	return grouped
+}
+
+// mergeSenders combines filters that differ only in their from lists into
+// one matching every sender. A filter without a from list matches all of
+// them already and is used unchanged.
+func mergeSenders(filters []*Filter) *Filter {
+	seen := make(map[string]bool)
+	var from []string
+	for _, f := range filters {
+		if len(f.From) == 0 {
+			return f
+		}
+		for _, addr := range f.From {
+			if key := strings.ToLower(addr); !seen[key] {
+				seen[key] = true
+				from = append(from, addr)
+			}
+		}
+	}
+	if len(filters) == 1 {
+		return filters[0]
+	}
+
+	merged := *filters[0]
+	merged.Name = mergedName(filters)
+	merged.From = from
+	merged.LintIgnore = mergedLintIgnore(filters)
+	merged.Source = nil
+	return &merged
+}
+
+// mergeAny combines filters with the same actions into one matching any of
+// their conditions
+func mergeAny(filters []*Filter) *Filter {
+	if len(filters) == 1 {
+		return filters[0]
+	}
+	conditions := make(Any, 0, len(filters))
+	for _, f := range filters {
+		conditions = append(conditions, f.fullCondition())
+	}
+
+	merged := *filters[0]
+	merged.Name = mergedName(filters)
+	merged.From = nil
+	merged.To = nil
+	merged.Subject = nil
+	merged.HasWords = nil
+	merged.DoesNotHaveWords = nil
+	merged.Size = nil
+	merged.Inherited = nil
+	merged.Condition = conditions
+	merged.LintIgnore = mergedLintIgnore(filters)
+	merged.Source = nil
+	return &merged
+}
+
+// fullCondition returns the filter's complete condition as an expression,
+// including its inherited conditions
+func (f *Filter) fullCondition() Condition {
+	return and(f.Inherited, f.ownCondition())
+}
+
+// mergedName joins the distinct names of the filters
+func mergedName(filters []*Filter) string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, f := range filters {
+		if f.Name != "" && !seen[f.Name] {
+			seen[f.Name] = true
+			names = append(names, f.Name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// mergedLintIgnore returns the lint rules any of the filters ignores
+func mergedLintIgnore(filters []*Filter) []string {
+	seen := make(map[string]bool)
+	var rules []string
+	for _, f := range filters {
+		for _, r := range f.LintIgnore {
+			if !seen[r] {
+				seen[r] = true
+				rules = append(rules, r)
+			}
+		}
+	}
+	return rules
+}
@@ -0,0 +1,204 @@
+package filter
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/brendanryan/gmail-brita/internal/query"
+)
+
+// exportFeed mirrors Feed for decoding, matching elements by local name so
+// that namespace prefixes chosen by the exporter do not matter
+type exportFeed struct {
+	Author  Author        `xml:"author"`
+	Entries []exportEntry `xml:"entry"`
+}
+
+type exportEntry struct {
+	ID         string     `xml:"id"`
+	Properties []Property `xml:"property"`
+}
+
+// entryIDPrefix precedes the filter ID in an export entry's id element
+const entryIDPrefix = "tag:mail.google.com,2008:filter:"
+
+// ParseXML reads a Gmail filter export in the format written by ToXML back
+// into a filter set. Properties without an equivalent on Filter are ignored.
+func ParseXML(data []byte) (*Set, error) {
+	var feed exportFeed
+	if err := xml.Unmarshal(data, &feed); err != nil {
+		return nil, fmt.Errorf("failed to parse filter XML: %w", err)
+	}
+
+	var emails []string
+	if feed.Author.Email != "" {
+		emails = append(emails, feed.Author.Email)
+	}
+	set := NewFilterSet(emails)
+
+	for i, entry := range feed.Entries {
+		filter := set.AddFilter()
+		filter.ID = strings.TrimPrefix(entry.ID, entryIDPrefix)
+		var size sizeProperties
+		for _, p := range entry.Properties {
+			if size.set(p) {
+				continue
+			}
+			if err := filter.setProperty(p); err != nil {
+				return nil, fmt.Errorf("entry %d: %w", i+1, err)
+			}
+		}
+		if err := size.apply(filter); err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i+1, err)
+		}
+	}
+
+	return set, nil
+}
+
+// setProperty applies a single Gmail filter property to the filter
+func (f *Filter) setProperty(p Property) error {
+	var err error
+	switch p.Name {
+	case "from":
+		f.From, err = splitValues(p.Value)
+	case "to":
+		f.To, err = splitValues(p.Value)
+	case "subject":
+		f.Subject, err = splitValues(p.Value)
+	case "hasTheWord":
+		if p.Value != "" {
+			f.HasWords = append(f.HasWords, p.Value)
+		}
+	case "doesNotHaveWord", "doesNotHaveTheWord":
+		f.DoesNotHaveWords, err = splitAlternatives(p.Value)
+	case "label":
+		f.Labels = append(f.Labels, p.Value)
+	case "shouldArchive":
+		f.Archive = p.Value == "true"
+	case "shouldMarkAsRead":
+		f.MarkRead = p.Value == "true"
+	case "shouldStar":
+		f.Star = p.Value == "true"
+	case "neverSpam", "shouldNeverSpam":
+		f.NeverSpam = p.Value == "true"
+	case "shouldTrash":
+		f.Trash = p.Value == "true"
+	case "shouldAlwaysMarkAsImportant":
+		f.MarkImportant = p.Value == "true"
+	case "shouldNeverMarkAsImportant":
+		f.NeverImportant = p.Value == "true"
+	case "smartLabelToApply":
+		f.Category = categoryName(p.Value)
+		if f.Category == "" {
+			err = fmt.Errorf("unknown category %q", p.Value)
+		}
+	case "forwardTo":
+		f.ForwardTo = p.Value
+	}
+	if err != nil {
+		return fmt.Errorf("property %q: %w", p.Name, err)
+	}
+	return nil
+}
+
+// categoryName returns the category name for a smart label
+func categoryName(smartLabel string) string {
+	for name, label := range Categories {
+		if label == smartLabel {
+			return name
+		}
+	}
+	return ""
+}
+
+// sizeProperties collects the size properties of an entry, which only
+// describe a condition together. Gmail exports include the operator and
+// unit even on filters without a size.
+type sizeProperties struct {
+	operator, unit, size string
+}
+
+// set records a size property, reporting whether p was one
+func (s *sizeProperties) set(p Property) bool {
+	switch p.Name {
+	case "sizeOperator":
+		s.operator = p.Value
+	case "sizeUnit":
+		s.unit = p.Value
+	case "size":
+		s.size = p.Value
+	default:
+		return false
+	}
+	return true
+}
+
+// apply sets the filter's size condition when a size was given
+func (s *sizeProperties) apply(f *Filter) error {
+	if s.size == "" {
+		return nil
+	}
+
+	var operator SizeOperator
+	for op, value := range sizeOperators {
+		if value == s.operator {
+			operator = op
+		}
+	}
+	if operator == "" {
+		return fmt.Errorf("unknown size operator %q", s.operator)
+	}
+
+	unit, ok := sizeUnits[s.unit]
+	if !ok {
+		return fmt.Errorf("unknown size unit %q", s.unit)
+	}
+
+	value, err := strconv.ParseInt(s.size, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid size %q", s.size)
+	}
+
+	f.Size = &Size{Operator: operator, Bytes: value * unit}
+	return nil
+}
+
+// splitValues splits a field property such as from into its alternative
+// values, removing any quotes added by joinValues
+func splitValues(value string) ([]string, error) {
+	terms, err := splitAlternatives(value)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]string, 0, len(terms))
+	for _, t := range terms {
+		if len(t) >= 2 && strings.HasPrefix(t, `"`) && strings.HasSuffix(t, `"`) {
+			t = t[1 : len(t)-1]
+		}
+		values = append(values, t)
+	}
+	return values, nil
+}
+
+// splitAlternatives splits a query into the terms of its top-level OR
+func splitAlternatives(value string) ([]string, error) {
+	n, err := query.Parse(value)
+	if err != nil {
+		return nil, err
+	}
+	switch v := n.(type) {
+	case nil:
+		return make([]string, 0), nil
+	case query.Or:
+		terms := make([]string, 0, len(v))
+		for _, c := range v {
+			terms = append(terms, c.String())
+		}
+		return terms, nil
+	default:
+		return []string{n.String()}, nil
+	}
+}
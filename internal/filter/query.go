@@ -0,0 +1,144 @@
+package filter
+
+import (
+	"github.com/brendanryan/gmail-brita/internal/query"
+)
+
+// Query returns the filter's complete search condition, including the
+// sender, recipient and subject fields, the negative terms and any
+// conditions inherited from earlier filters in a chain
+func (f *Filter) Query() (query.Node, error) {
+	own, err := toQuery(f.ownCondition())
+	if err != nil {
+		return nil, err
+	}
+	inherited, err := toQuery(f.Inherited)
+	if err != nil {
+		return nil, err
+	}
+	return query.NewAnd(inherited, own), nil
+}
+
+// ownCondition returns the conditions set on the filter itself, excluding
+// those inherited from earlier filters in a chain
+func (f *Filter) ownCondition() Condition {
+	all := make(All, 0)
+	if len(f.From) > 0 {
+		all = append(all, fieldCondition("from", f.From))
+	}
+	if len(f.To) > 0 {
+		all = append(all, fieldCondition("to", f.To))
+	}
+	if len(f.Subject) > 0 {
+		all = append(all, fieldCondition("subject", f.Subject))
+	}
+	for _, word := range f.HasWords {
+		all = append(all, Term(word))
+	}
+	if f.Condition != nil {
+		all = append(all, f.Condition)
+	}
+	if f.Size != nil {
+		all = append(all, Term(f.Size.word().String()))
+	}
+	if len(f.DoesNotHaveWords) > 0 {
+		all = append(all, Not{Condition: f.excluded()})
+	}
+	return all
+}
+
+// excluded returns the alternatives the filter's DoesNotHaveWords exclude.
+// Gmail's doesNotHaveWord property is written from the same condition, so
+// multi-word terms are grouped alike in both.
+func (f *Filter) excluded() Any {
+	excluded := make(Any, 0, len(f.DoesNotHaveWords))
+	for _, word := range f.DoesNotHaveWords {
+		excluded = append(excluded, Term(word))
+	}
+	return excluded
+}
+
+// fieldCondition expresses a Gmail filter field as operator search terms
+func fieldCondition(op string, values []string) Condition {
+	terms := make(Any, 0, len(values))
+	for _, v := range values {
+		terms = append(terms, Term(op+":"+quoteValue(v)))
+	}
+	return terms
+}
+
+// FromQuery converts a parsed query into a condition expression
+func FromQuery(n query.Node) Condition {
+	switch v := n.(type) {
+	case query.Word:
+		return Term(v.String())
+	case query.And:
+		all := make(All, 0, len(v))
+		for _, c := range v {
+			all = append(all, FromQuery(c))
+		}
+		return all
+	case query.Or:
+		alternatives := make(Any, 0, len(v))
+		for _, c := range v {
+			alternatives = append(alternatives, FromQuery(c))
+		}
+		return alternatives
+	case query.Not:
+		return Not{Condition: FromQuery(v.X)}
+	default:
+		return nil
+	}
+}
+
+// toQuery converts a condition expression into a parsed query, parsing
+// each search term
+func toQuery(c Condition) (query.Node, error) {
+	switch v := c.(type) {
+	case Term:
+		return query.Parse(string(v))
+	case All:
+		nodes := make([]query.Node, 0, len(v))
+		for _, child := range v {
+			n, err := toQuery(child)
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, n)
+		}
+		return query.NewAnd(nodes...), nil
+	case Any:
+		nodes := make([]query.Node, 0, len(v))
+		for _, child := range v {
+			n, err := toQuery(child)
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, n)
+		}
+		return query.NewOr(nodes...), nil
+	case Not:
+		n, err := toQuery(v.Condition)
+		if err != nil || n == nil {
+			return nil, err
+		}
+		return query.Not{X: n}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// negate returns the logical complement of a condition. Search terms are
+// parsed so that negation reaches into groups and phrases; a condition that
+// cannot be parsed is negated as a whole, which Not groups in parentheses
+// whenever it holds more than one word.
+func negate(c Condition) Condition {
+	n, err := toQuery(c)
+	if err != nil {
+		return Not{Condition: c}
+	}
+	if n == nil {
+		return nil
+	}
+	return FromQuery(query.Negate(n))
+}
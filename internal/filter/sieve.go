@@ -0,0 +1,236 @@
+package filter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/brendanryan/gmail-brita/internal/query"
+)
+
+// sieveExtensions lists the Sieve extensions the script may require, in
+// the order they are declared
+var sieveExtensions = []string{"body", "copy", "fileinto", "imap4flags", "mailbox"}
+
+// sieveHeaders maps Gmail's address operators to the headers they search
+var sieveHeaders = map[string][]string{
+	"from":        {"from", "sender"},
+	"to":          {"to", "cc"},
+	"cc":          {"cc"},
+	"bcc":         {"bcc"},
+	"deliveredto": {"delivered-to"},
+}
+
+// ToSieve renders the filter set as a Sieve script (RFC 5228) for servers
+// such as Fastmail and Dovecot. Labels become folders, filed into with
+// :copy unless the filter archives, so messages stay in the inbox as they
+// do in Gmail. Stars and read marks become IMAP flags, deleting discards
+// and forwarding redirects a copy. Filters using search operators that
+// depend on Gmail's mailbox state, such as is:, in:, label:, category: and
+// has:, or on attachments and dates, cannot be translated and are written
+// as comments, as are actions with no Sieve equivalent.
+func (s *Set) ToSieve() ([]byte, error) {
+	w := &sieveWriter{require: make(map[string]bool)}
+	for _, f := range s.Filters {
+		if err := w.filter(f); err != nil {
+			return nil, err
+		}
+	}
+
+	var out strings.Builder
+	out.WriteString("# Generated by gmail-brita\n")
+	var required []string
+	for _, ext := range sieveExtensions {
+		if w.require[ext] {
+			required = append(required, sieveString(ext))
+		}
+	}
+	if len(required) > 0 {
+		fmt.Fprintf(&out, "require [%s];\n", strings.Join(required, ", "))
+	}
+	out.WriteString(w.b.String())
+	return []byte(out.String()), nil
+}
+
+// sieveWriter accumulates the rules of a Sieve script along with the
+// extensions they use
+type sieveWriter struct {
+	b       strings.Builder
+	require map[string]bool
+}
+
+// filter writes the rule for a single filter
+func (w *sieveWriter) filter(f *Filter) error {
+	name := f.Name
+	if name == "" {
+		name = "(unnamed)"
+	}
+	w.b.WriteString("\n# " + strings.ReplaceAll(name, "\n", " ") + "\n")
+
+	q, err := f.Query()
+	if err != nil {
+		return fmt.Errorf("filter %q: %w", f.Name, err)
+	}
+	test := "true"
+	if q != nil {
+		var unsupported []string
+		test = w.test(q, &unsupported)
+		if len(unsupported) > 0 {
+			fmt.Fprintf(&w.b, "# Skipped: %s cannot be expressed in Sieve\n", strings.Join(unsupported, ", "))
+			return nil
+		}
+	}
+
+	commands, skipped := w.actions(f)
+	if len(skipped) > 0 {
+		fmt.Fprintf(&w.b, "# Not translated: %s\n", strings.Join(skipped, ", "))
+	}
+	if len(commands) == 0 {
+		return nil
+	}
+	fmt.Fprintf(&w.b, "if %s {\n", test)
+	for _, c := range commands {
+		w.b.WriteString("    " + c + ";\n")
+	}
+	w.b.WriteString("}\n")
+	return nil
+}
+
+// test translates a query into a Sieve test, collecting the terms that
+// cannot be translated in unsupported
+func (w *sieveWriter) test(n query.Node, unsupported *[]string) string {
+	switch v := n.(type) {
+	case query.And:
+		return w.group("allof", v, unsupported)
+	case query.Or:
+		return w.group("anyof", v, unsupported)
+	case query.Not:
+		return "not " + w.test(v.X, unsupported)
+	case query.Word:
+		test, ok := w.word(v)
+		if !ok {
+			*unsupported = append(*unsupported, v.String())
+		}
+		return test
+	default:
+		return "false"
+	}
+}
+
+// group joins tests with allof or anyof
+func (w *sieveWriter) group(name string, nodes []query.Node, unsupported *[]string) string {
+	tests := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		tests = append(tests, w.test(n, unsupported))
+	}
+	return name + " (" + strings.Join(tests, ", ") + ")"
+}
+
+// word translates a single search term, reporting whether it could be
+func (w *sieveWriter) word(v query.Word) (string, bool) {
+	op := strings.ToLower(v.Op)
+	value := v.Value
+	switch op {
+	case "":
+		w.require["body"] = true
+		return fmt.Sprintf("anyof (header :contains \"subject\" %s, body :text :contains %s)",
+			sieveString(value), sieveString(value)), true
+	case "subject":
+		return "header :contains \"subject\" " + sieveString(value), true
+	case "from", "to", "cc", "bcc", "deliveredto":
+		headers := sieveList(sieveHeaders[op])
+		if strings.Contains(value, "@") && !strings.HasPrefix(value, "@") {
+			return fmt.Sprintf("address :is %s %s", headers, sieveString(value)), true
+		}
+		return fmt.Sprintf("header :contains %s %s", headers, sieveString(value)), true
+	case "list":
+		values := []string{value}
+		if at := strings.LastIndex(value, "@"); at > 0 {
+			// List-Id holds the address with its @ replaced by a dot
+			values = append(values, value[:at]+"."+value[at+1:])
+		}
+		return fmt.Sprintf("header :contains [\"list-id\", \"list-post\"] %s", sieveList(values)), true
+	case "rfc822msgid":
+		return "header :contains \"message-id\" " + sieveString(value), true
+	case "larger", "size", "smaller":
+		size, err := query.ParseSize(value)
+		if err != nil {
+			return "", false
+		}
+		comparison := ":over"
+		if op == "smaller" {
+			comparison = ":under"
+		}
+		return fmt.Sprintf("size %s %d", comparison, size), true
+	default:
+		return "false", false
+	}
+}
+
+// actions translates the filter's actions into Sieve commands, returning
+// those that have no equivalent separately
+func (w *sieveWriter) actions(f *Filter) (commands, skipped []string) {
+	if f.MarkRead {
+		w.require["imap4flags"] = true
+		commands = append(commands, `addflag "\\Seen"`)
+	}
+	if f.Star {
+		w.require["imap4flags"] = true
+		commands = append(commands, `addflag "\\Flagged"`)
+	}
+
+	folders := f.Labels
+	if f.Archive && len(folders) == 0 {
+		folders = []string{"Archive"}
+	}
+	for _, folder := range folders {
+		w.require["fileinto"] = true
+		w.require["mailbox"] = true
+		command := "fileinto :create "
+		if !f.Archive {
+			w.require["copy"] = true
+			command = "fileinto :copy :create "
+		}
+		commands = append(commands, command+sieveString(folder))
+	}
+
+	if f.ForwardTo != "" {
+		w.require["copy"] = true
+		commands = append(commands, "redirect :copy "+sieveString(f.ForwardTo))
+	}
+	if f.Trash {
+		commands = append(commands, "discard")
+	}
+
+	if f.NeverSpam {
+		skipped = append(skipped, "never_spam")
+	}
+	if f.MarkImportant {
+		skipped = append(skipped, "mark_important")
+	}
+	if f.NeverImportant {
+		skipped = append(skipped, "never_important")
+	}
+	if f.Category != "" {
+		skipped = append(skipped, "category "+f.Category)
+	}
+	return commands, skipped
+}
+
+// sieveString quotes a value as a Sieve string
+func sieveString(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
+
+// sieveList renders values as a Sieve string list, or a single string
+func sieveList(values []string) string {
+	if len(values) == 1 {
+		return sieveString(values[0])
+	}
+	quoted := make([]string, 0, len(values))
+	for _, v := range values {
+		quoted = append(quoted, sieveString(v))
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
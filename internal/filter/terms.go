@@ -0,0 +1,41 @@
+package filter
+
+import (
+	"strings"
+)
+
+// quoteValue quotes a search value when Gmail would otherwise split it into
+// separate terms or read part of it as query syntax. Gmail cannot escape a
+// quote inside a quoted term, so embedded quotes are dropped; configs
+// containing them are rejected by validation before they get here.
+func quoteValue(value string) string {
+	if len(value) >= 2 && strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`) {
+		return value
+	}
+	if value == "" || strings.HasPrefix(value, "-") || strings.ContainsAny(value, " \t\"(){}") {
+		return `"` + strings.ReplaceAll(value, `"`, "") + `"`
+	}
+	return value
+}
+
+// joinValues quotes each value and joins them as Gmail alternatives
+func joinValues(values []string) string {
+	quoted := make([]string, 0, len(values))
+	for _, v := range values {
+		quoted = append(quoted, quoteValue(v))
+	}
+	return strings.Join(quoted, " OR ")
+}
+
+// operatorTerm renders values as a single search term using the given
+// operator, matching any of the values
+func operatorTerm(op string, values []string) string {
+	terms := make([]string, 0, len(values))
+	for _, v := range values {
+		terms = append(terms, op+":"+quoteValue(v))
+	}
+	if len(terms) == 1 {
+		return terms[0]
+	}
+	return "(" + strings.Join(terms, " OR ") + ")"
+}
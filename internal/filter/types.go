@@ -1,29 +1,106 @@
 package filter
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/xml"
 	"fmt"
-	"strings"
+	"sort"
+	"strconv"
 	"time"
+
+	"github.com/brendanryan/gmail-brita/internal/query"
 )
 
 // Set represents a collection of Gmail filters
 type Set struct {
 	Emails  []string
 	Filters []*Filter
+
+	// Updated is the timestamp written to the generated XML. The current
+	// time is used when it is zero.
+	Updated time.Time
+
+	// Limits decides what ToXML does with filters that exceed Gmail's
+	// limits; LimitWarn is used when it is empty
+	Limits LimitPolicy
 }
 
 // Filter represents a Gmail filter
 type Filter struct {
+	Name             string
+	From             []string
+	To               []string
+	Subject          []string
 	HasWords         []string
 	DoesNotHaveWords []string
+	Condition        Condition
+	Inherited        Condition
+	Size             *Size
 	Labels           []string
 	Archive          bool
 	MarkRead         bool
 	Star             bool
 	NeverSpam        bool
+	Trash            bool
+	MarkImportant    bool
+	NeverImportant   bool
+	Category         string
+	ForwardTo        string
+
+	// ID is the Gmail filter ID of a filter read from an export; it is
+	// empty for filters built from a config
+	ID string
+	// EntryID is the ID derived from the filter's content that Entries
+	// gives each filter it returns, matching the ID of the entry ToXML
+	// writes for it; it is empty for other filters
+	EntryID string
+
+	// LintIgnore lists lint rules that are not reported for this filter
+	LintIgnore []string
+	// Source is the filter that a generated companion filter, such as the
+	// one added by ArchiveUnlessDirected, was derived from
+	Source *Filter
+}
+
+// Size is a condition on the size of a message
+type Size struct {
+	Operator SizeOperator
+	Bytes    int64
 }
 
+// SizeOperator compares a message's size with a Size
+type SizeOperator string
+
+// Size operators supported by Gmail filters
+const (
+	Larger  SizeOperator = "larger"
+	Smaller SizeOperator = "smaller"
+)
+
+// Categories maps Gmail's inbox category names to the smart labels used
+// in filter exports
+var Categories = map[string]string{
+	"primary":    "^smartlabel_personal",
+	"social":     "^smartlabel_social",
+	"updates":    "^smartlabel_notification",
+	"forums":     "^smartlabel_group",
+	"promotions": "^smartlabel_promo",
+}
+
+// sizeProperties maps size operators and units to their export values
+var (
+	sizeOperators = map[SizeOperator]string{
+		Larger:  "s_sl",
+		Smaller: "s_ss",
+	}
+	sizeUnits = map[string]int64{
+		"s_sb":  1,
+		"s_skb": query.Kilobyte,
+		"s_smb": query.Megabyte,
+	}
+)
+
 // NewFilterSet creates a new filter set with the given email addresses
 func NewFilterSet(emails []string) *Set {
 	return &Set{
@@ -35,6 +112,9 @@ func NewFilterSet(emails []string) *Set {
 // AddFilter adds a new filter to the set
 func (s *Set) AddFilter() *Filter {
 	filter := &Filter{
+		From:             make([]string, 0),
+		To:               make([]string, 0),
+		Subject:          make([]string, 0),
 		HasWords:         make([]string, 0),
 		DoesNotHaveWords: make([]string, 0),
 		Labels:           make([]string, 0),
@@ -43,15 +123,94 @@ func (s *Set) AddFilter() *Filter {
 	return filter
 }
 
-// ToXML converts the filter set to Gmail's XML format
+// RemoveFilter removes a filter from the set
+func (s *Set) RemoveFilter(filter *Filter) {
+	for i, f := range s.Filters {
+		if f == filter {
+			s.Filters = append(s.Filters[:i], s.Filters[i+1:]...)
+			return
+		}
+	}
+}
+
+// Actions describes the filter's actions as a sorted list such as
+// "archive" or "label:work", for comparing what filters do
+func (f *Filter) Actions() []string {
+	actions := make([]string, 0, len(f.Labels)+4)
+	for _, label := range f.Labels {
+		actions = append(actions, "label:"+label)
+	}
+	if f.Archive {
+		actions = append(actions, "archive")
+	}
+	if f.MarkRead {
+		actions = append(actions, "mark_read")
+	}
+	if f.Star {
+		actions = append(actions, "star")
+	}
+	if f.NeverSpam {
+		actions = append(actions, "never_spam")
+	}
+	if f.Trash {
+		actions = append(actions, "trash")
+	}
+	if f.MarkImportant {
+		actions = append(actions, "mark_important")
+	}
+	if f.NeverImportant {
+		actions = append(actions, "never_important")
+	}
+	if f.Category != "" {
+		actions = append(actions, "category:"+f.Category)
+	}
+	if f.ForwardTo != "" {
+		actions = append(actions, "forward:"+f.ForwardTo)
+	}
+	sort.Strings(actions)
+	return actions
+}
+
+// hasTheWord renders the search terms and condition expression as a single query
+func (f *Filter) hasTheWord() string {
+	all := make(All, 0, len(f.HasWords)+2)
+	if f.Inherited != nil {
+		all = append(all, f.Inherited)
+	}
+	for _, word := range f.HasWords {
+		all = append(all, Term(word))
+	}
+	if f.Condition != nil {
+		all = append(all, f.Condition)
+	}
+	return all.String()
+}
+
+// ToXML converts the filter set to Gmail's XML format. Gmail only applies
+// one label per entry, so filters with several labels are written as one
+// entry per label, and filters that exceed Gmail's limits are handled as
+// the set's Limits policy decides. Entry IDs are derived from each filter's
+// content, so they stay the same when other filters are added or removed,
+// and every timestamp is Updated when it is set, making the output
+// reproducible.
 func (s *Set) ToXML() ([]byte, error) {
+	filters, errs := s.output()
+	if s.Limits == LimitFail && len(errs) > 0 {
+		return nil, errs
+	}
+
+	updated := s.Updated
+	if updated.IsZero() {
+		updated = time.Now()
+	}
+
 	feed := &Feed{
 		XMLName:  xml.Name{Space: "http://www.w3.org/2005/Atom", Local: "feed"},
 		XMLNS:    "http://www.w3.org/2005/Atom",
 		XMLNSApp: "http://schemas.google.com/apps/2006",
 		Title:    "Mail Filters",
 		ID:       fmt.Sprintf("tag:mail.google.com,2008:filters:%s", s.Emails[0]),
-		Updated:  time.Now().UTC().Format("2006-01-02T15:04:05Z"),
+		Updated:  updated.UTC().Format("2006-01-02T15:04:05Z"),
 		Author: Author{
 			Name:  s.Emails[0],
 			Email: s.Emails[0],
@@ -59,70 +218,256 @@ func (s *Set) ToXML() ([]byte, error) {
 		Entries: make([]Entry, 0),
 	}
 
-	for i, filter := range s.Filters {
-		entry := Entry{
-			Category: Category{Term: "filter"},
-			Title:    "Mail Filter",
-			ID:       fmt.Sprintf("tag:mail.google.com,2008:filter:%d", i+1),
-			Updated:  feed.Updated,
-			Content:  "",
-		}
-
-		if len(filter.HasWords) > 0 {
-			entry.Properties = append(entry.Properties, Property{
-				Name:  "hasTheWord",
-				Value: strings.Join(filter.HasWords, " AND "),
+	ids := make(map[string]int)
+	for _, filter := range filters {
+		for _, properties := range filter.entries() {
+			feed.Entries = append(feed.Entries, Entry{
+				Category:   Category{Term: "filter"},
+				Title:      "Mail Filter",
+				ID:         entryIDPrefix + entryID(properties, ids),
+				Updated:    feed.Updated,
+				Content:    "",
+				Properties: properties,
 			})
 		}
+	}
 
-		if len(filter.DoesNotHaveWords) > 0 {
-			entry.Properties = append(entry.Properties, Property{
-				Name:  "doesNotHaveWord",
-				Value: strings.Join(filter.DoesNotHaveWords, " OR "),
-			})
+	return xml.MarshalIndent(feed, "", "  ")
+}
+
+// Entries returns the filters as Gmail stores them: divided as the set's
+// Limits policy decides and with at most one label each, and with the
+// EntryID of the entry ToXML writes. It fails like ToXML when the policy is
+// LimitFail and a limit is exceeded.
+func (s *Set) Entries() ([]*Filter, error) {
+	filters, errs := s.output()
+	if s.Limits == LimitFail && len(errs) > 0 {
+		return nil, errs
+	}
+
+	var entries []*Filter
+	ids := make(map[string]int)
+	for _, f := range filters {
+		properties := f.entries()
+		for i, part := range f.byLabel() {
+			e := *part
+			e.EntryID = entryID(properties[i], ids)
+			entries = append(entries, &e)
 		}
+	}
+	return entries, nil
+}
+
+// byLabel divides a filter with several labels into one filter per label,
+// the first of which also carries the remaining actions
+func (f *Filter) byLabel() []*Filter {
+	if len(f.Labels) <= 1 {
+		return []*Filter{f}
+	}
 
-		if len(filter.Labels) > 0 {
-			for _, label := range filter.Labels {
-				entry.Properties = append(entry.Properties, Property{
-					Name:  "label",
-					Value: label,
-				})
+	filters := make([]*Filter, 0, len(f.Labels))
+	for i, label := range f.Labels {
+		g := *f
+		if i > 0 {
+			g = Filter{
+				Name:             f.Name,
+				From:             f.From,
+				To:               f.To,
+				Subject:          f.Subject,
+				HasWords:         f.HasWords,
+				DoesNotHaveWords: f.DoesNotHaveWords,
+				Condition:        f.Condition,
+				Inherited:        f.Inherited,
+				Size:             f.Size,
 			}
 		}
+		g.Labels = []string{label}
+		filters = append(filters, &g)
+	}
+	return filters
+}
 
-		if filter.Archive {
-			entry.Properties = append(entry.Properties, Property{
-				Name:  "shouldArchive",
-				Value: "true",
+// entries returns the properties of each Gmail filter entry needed to
+// express the filter. Every entry carries the filter's conditions and one
+// label; the first also carries the remaining actions.
+func (f *Filter) entries() [][]Property {
+	parts := f.byLabel()
+	entries := make([][]Property, 0, len(parts))
+	for _, g := range parts {
+		properties := g.conditionProperties()
+		for _, label := range g.Labels {
+			properties = append(properties, Property{
+				Name:  "label",
+				Value: label,
 			})
 		}
+		entries = append(entries, append(properties, g.actionProperties()...))
+	}
+	return entries
+}
 
-		if filter.MarkRead {
-			entry.Properties = append(entry.Properties, Property{
-				Name:  "shouldMarkAsRead",
-				Value: "true",
-			})
-		}
+// Criteria returns the properties describing the filter's conditions as
+// written to Gmail's XML export
+func (f *Filter) Criteria() []Property {
+	return f.conditionProperties()
+}
 
-		if filter.Star {
-			entry.Properties = append(entry.Properties, Property{
-				Name:  "shouldStar",
-				Value: "true",
-			})
-		}
+// conditionProperties returns the Gmail filter properties describing the
+// filter's conditions
+func (f *Filter) conditionProperties() []Property {
+	var properties []Property
 
-		if filter.NeverSpam {
-			entry.Properties = append(entry.Properties, Property{
-				Name:  "neverSpam",
-				Value: "true",
-			})
-		}
+	if len(f.From) > 0 {
+		properties = append(properties, Property{
+			Name:  "from",
+			Value: joinValues(f.From),
+		})
+	}
 
-		feed.Entries = append(feed.Entries, entry)
+	if len(f.To) > 0 {
+		properties = append(properties, Property{
+			Name:  "to",
+			Value: joinValues(f.To),
+		})
 	}
 
-	return xml.MarshalIndent(feed, "", "  ")
+	if len(f.Subject) > 0 {
+		properties = append(properties, Property{
+			Name:  "subject",
+			Value: joinValues(f.Subject),
+		})
+	}
+
+	if hasTheWord := f.hasTheWord(); hasTheWord != "" {
+		properties = append(properties, Property{
+			Name:  "hasTheWord",
+			Value: hasTheWord,
+		})
+	}
+
+	if len(f.DoesNotHaveWords) > 0 {
+		properties = append(properties, Property{
+			Name:  "doesNotHaveWord",
+			Value: f.excluded().String(),
+		})
+	}
+
+	if f.Size != nil {
+		properties = append(properties, f.Size.properties()...)
+	}
+
+	return properties
+}
+
+// actionProperties returns the Gmail filter properties describing the
+// filter's actions other than its labels
+func (f *Filter) actionProperties() []Property {
+	var properties []Property
+
+	if f.Archive {
+		properties = append(properties, Property{
+			Name:  "shouldArchive",
+			Value: "true",
+		})
+	}
+
+	if f.MarkRead {
+		properties = append(properties, Property{
+			Name:  "shouldMarkAsRead",
+			Value: "true",
+		})
+	}
+
+	if f.Star {
+		properties = append(properties, Property{
+			Name:  "shouldStar",
+			Value: "true",
+		})
+	}
+
+	if f.NeverSpam {
+		properties = append(properties, Property{
+			Name:  "neverSpam",
+			Value: "true",
+		})
+	}
+
+	if f.Trash {
+		properties = append(properties, Property{
+			Name:  "shouldTrash",
+			Value: "true",
+		})
+	}
+
+	if f.MarkImportant {
+		properties = append(properties, Property{
+			Name:  "shouldAlwaysMarkAsImportant",
+			Value: "true",
+		})
+	}
+
+	if f.NeverImportant {
+		properties = append(properties, Property{
+			Name:  "shouldNeverMarkAsImportant",
+			Value: "true",
+		})
+	}
+
+	if f.Category != "" {
+		properties = append(properties, Property{
+			Name:  "smartLabelToApply",
+			Value: Categories[f.Category],
+		})
+	}
+
+	if f.ForwardTo != "" {
+		properties = append(properties, Property{
+			Name:  "forwardTo",
+			Value: f.ForwardTo,
+		})
+	}
+
+	return properties
+}
+
+// properties returns the Gmail filter properties describing the size
+// condition, using the largest unit that represents it exactly
+func (s *Size) properties() []Property {
+	unit := "s_sb"
+	value := s.Bytes
+	switch {
+	case value != 0 && value%query.Megabyte == 0:
+		unit, value = "s_smb", value/query.Megabyte
+	case value != 0 && value%query.Kilobyte == 0:
+		unit, value = "s_skb", value/query.Kilobyte
+	}
+
+	return []Property{
+		{Name: "sizeOperator", Value: sizeOperators[s.Operator]},
+		{Name: "sizeUnit", Value: unit},
+		{Name: "size", Value: strconv.FormatInt(value, 10)},
+	}
+}
+
+// word returns the search term equivalent to the size condition
+func (s *Size) word() query.Word {
+	return query.Word{Op: string(s.Operator), Value: query.FormatSize(s.Bytes)}
+}
+
+// entryID derives a stable ID from a filter's properties. Filters with
+// identical properties are numbered in order through seen.
+func entryID(properties []Property, seen map[string]int) string {
+	h := sha256.New()
+	for _, p := range properties {
+		fmt.Fprintf(h, "%s=%s\n", p.Name, p.Value)
+	}
+	id := hex.EncodeToString(h.Sum(nil))[:16]
+
+	seen[id]++
+	if n := seen[id]; n > 1 {
+		return fmt.Sprintf("%s-%d", id, n)
+	}
+	return id
 }
 
 // Feed represents the root element of Gmail's filter XML
@@ -0,0 +1,135 @@
+package gmail
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// DefaultBaseURL is the Gmail API endpoint for the authorized user
+const DefaultBaseURL = "https://gmail.googleapis.com/gmail/v1/users/me"
+
+// Doer sends HTTP requests. *http.Client satisfies it.
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Client calls the Gmail API's label and filter methods
+type Client struct {
+	doer    Doer
+	baseURL string
+	token   string
+}
+
+// NewClient creates a client sending requests through doer to the API at
+// baseURL, authorized with an OAuth access token when one is given
+func NewClient(doer Doer, baseURL, token string) *Client {
+	return &Client{doer: doer, baseURL: baseURL, token: token}
+}
+
+// APIError is an error response from the Gmail API
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("gmail: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// Labels lists the user's labels
+func (c *Client) Labels(ctx context.Context) ([]Label, error) {
+	var resp struct {
+		Labels []Label `json:"labels"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/labels", nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Labels, nil
+}
+
+// CreateLabel creates a label, returning it with its ID
+func (c *Client) CreateLabel(ctx context.Context, label Label) (Label, error) {
+	var created Label
+	err := c.do(ctx, http.MethodPost, "/labels", label, &created)
+	return created, err
+}
+
+// Filters lists the user's filters
+func (c *Client) Filters(ctx context.Context) ([]Filter, error) {
+	var resp struct {
+		Filters []Filter `json:"filter"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/settings/filters", nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Filters, nil
+}
+
+// CreateFilter creates a filter, returning it with its ID
+func (c *Client) CreateFilter(ctx context.Context, f Filter) (Filter, error) {
+	var created Filter
+	err := c.do(ctx, http.MethodPost, "/settings/filters", f, &created)
+	return created, err
+}
+
+// DeleteFilter deletes the filter with the given ID
+func (c *Client) DeleteFilter(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/settings/filters/"+url.PathEscape(id), nil, nil)
+}
+
+// do sends a request with body encoded as JSON, decoding the response into
+// out unless it is nil
+func (c *Client) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.doer.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var e struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+		message := string(bytes.TrimSpace(data))
+		if json.Unmarshal(data, &e) == nil && e.Error.Message != "" {
+			message = e.Error.Message
+		}
+		return &APIError{StatusCode: resp.StatusCode, Message: message}
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("gmail: decoding %s %s response: %w", method, path, err)
+	}
+	return nil
+}
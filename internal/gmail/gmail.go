@@ -0,0 +1,236 @@
+// Package gmail talks to the Gmail REST API to manage a user's labels and
+// filters, and converts filter sets into the API's representation.
+package gmail
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/brendanryan/gmail-brita/internal/filter"
+)
+
+// Label is a Gmail label as returned by users.labels
+type Label struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name"`
+	// Type is "system" for Gmail's own labels and "user" for the rest
+	Type string `json:"type,omitempty"`
+}
+
+// Filter is a Gmail filter as used by users.settings.filters
+type Filter struct {
+	ID       string   `json:"id,omitempty"`
+	Criteria Criteria `json:"criteria"`
+	Action   Action   `json:"action"`
+}
+
+// Criteria are the conditions of a Gmail filter
+type Criteria struct {
+	From         string `json:"from,omitempty"`
+	To           string `json:"to,omitempty"`
+	Subject      string `json:"subject,omitempty"`
+	Query        string `json:"query,omitempty"`
+	NegatedQuery string `json:"negatedQuery,omitempty"`
+	// HasAttachment limits the filter to messages with attachments
+	HasAttachment bool `json:"hasAttachment,omitempty"`
+	// Size is a message size in bytes, compared as SizeComparison says
+	Size           int64  `json:"size,omitempty"`
+	SizeComparison string `json:"sizeComparison,omitempty"`
+}
+
+// Action is what a Gmail filter does to the messages it matches
+type Action struct {
+	AddLabelIDs    []string `json:"addLabelIds,omitempty"`
+	RemoveLabelIDs []string `json:"removeLabelIds,omitempty"`
+	Forward        string   `json:"forward,omitempty"`
+}
+
+// IDs of the system labels that filter actions add or remove
+const (
+	LabelInbox     = "INBOX"
+	LabelUnread    = "UNREAD"
+	LabelStarred   = "STARRED"
+	LabelTrash     = "TRASH"
+	LabelSpam      = "SPAM"
+	LabelImportant = "IMPORTANT"
+)
+
+// CategoryLabels maps Gmail's inbox category names to their label IDs
+var CategoryLabels = map[string]string{
+	"primary":    "CATEGORY_PERSONAL",
+	"social":     "CATEGORY_SOCIAL",
+	"updates":    "CATEGORY_UPDATES",
+	"forums":     "CATEGORY_FORUMS",
+	"promotions": "CATEGORY_PROMOTIONS",
+}
+
+// Convert expresses a filter with at most one label, such as those
+// returned by filter.Set.Entries, as a Gmail API filter. Label names are
+// replaced by their IDs from labelIDs, or kept as they are when missing.
+// A has:attachment search word becomes the hasAttachment criterion.
+func Convert(f *filter.Filter, labelIDs map[string]string) Filter {
+	g := Filter{ID: f.ID}
+	criteria := f
+	if words := withoutAttachment(f.HasWords); len(words) < len(f.HasWords) {
+		copied := *f
+		copied.HasWords = words
+		criteria = &copied
+		g.Criteria.HasAttachment = true
+	}
+	for _, p := range criteria.Criteria() {
+		switch p.Name {
+		case "from":
+			g.Criteria.From = p.Value
+		case "to":
+			g.Criteria.To = p.Value
+		case "subject":
+			g.Criteria.Subject = p.Value
+		case "hasTheWord":
+			g.Criteria.Query = p.Value
+		case "doesNotHaveWord":
+			g.Criteria.NegatedQuery = p.Value
+		}
+	}
+	if f.Size != nil {
+		g.Criteria.Size = f.Size.Bytes
+		g.Criteria.SizeComparison = string(f.Size.Operator)
+	}
+
+	add := func(id string) { g.Action.AddLabelIDs = append(g.Action.AddLabelIDs, id) }
+	remove := func(id string) { g.Action.RemoveLabelIDs = append(g.Action.RemoveLabelIDs, id) }
+	for _, label := range f.Labels {
+		if id, ok := labelIDs[label]; ok {
+			label = id
+		}
+		add(label)
+	}
+	if f.Star {
+		add(LabelStarred)
+	}
+	if f.Trash {
+		add(LabelTrash)
+	}
+	if f.MarkImportant {
+		add(LabelImportant)
+	}
+	if f.Category != "" {
+		add(CategoryLabels[f.Category])
+	}
+	if f.Archive {
+		remove(LabelInbox)
+	}
+	if f.MarkRead {
+		remove(LabelUnread)
+	}
+	if f.NeverSpam {
+		remove(LabelSpam)
+	}
+	if f.NeverImportant {
+		remove(LabelImportant)
+	}
+	g.Action.Forward = f.ForwardTo
+	return g
+}
+
+// withoutAttachment returns the search words other than has:attachment
+func withoutAttachment(words []string) []string {
+	out := make([]string, 0, len(words))
+	for _, w := range words {
+		if !strings.EqualFold(strings.TrimSpace(w), "has:attachment") {
+			out = append(out, w)
+		}
+	}
+	return out
+}
+
+// ConvertSet expresses every entry of a filter set as a Gmail API filter
+func ConvertSet(set *filter.Set, labelIDs map[string]string) ([]Filter, error) {
+	entries, err := set.Entries()
+	if err != nil {
+		return nil, err
+	}
+	filters := make([]Filter, 0, len(entries))
+	for _, e := range entries {
+		filters = append(filters, Convert(e, labelIDs))
+	}
+	return filters, nil
+}
+
+// ReadLabelIDs reads a map of label names to IDs, either as a JSON object
+// of names to IDs or as the response of Gmail's labels.list method
+func ReadLabelIDs(r io.Reader) (map[string]string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading label IDs: %w", err)
+	}
+
+	var ids map[string]string
+	if err := json.Unmarshal(data, &ids); err == nil {
+		return ids, nil
+	}
+	var list struct {
+		Labels []Label `json:"labels"`
+	}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("parsing label IDs: want an object of label names to IDs or a labels.list response: %w", err)
+	}
+	ids = make(map[string]string, len(list.Labels))
+	for _, l := range list.Labels {
+		ids[l.Name] = l.ID
+	}
+	return ids, nil
+}
+
+// key identifies what a filter does regardless of its ID and the order of
+// its label IDs
+func (f Filter) key() string {
+	add := append([]string(nil), f.Action.AddLabelIDs...)
+	remove := append([]string(nil), f.Action.RemoveLabelIDs...)
+	sort.Strings(add)
+	sort.Strings(remove)
+	c := f.Criteria
+	return strings.Join([]string{
+		c.From, c.To, c.Subject, c.Query, c.NegatedQuery,
+		fmt.Sprint(c.HasAttachment), fmt.Sprint(c.Size), c.SizeComparison,
+		strings.Join(add, ","), strings.Join(remove, ","), f.Action.Forward,
+	}, "\x00")
+}
+
+// String summarises the filter's criteria and the labels it adds and
+// removes
+func (f Filter) String() string {
+	var parts []string
+	c := f.Criteria
+	for _, field := range []struct{ name, value string }{
+		{"from", c.From},
+		{"to", c.To},
+		{"subject", c.Subject},
+		{"query", c.Query},
+		{"negatedQuery", c.NegatedQuery},
+	} {
+		if field.value != "" {
+			parts = append(parts, fmt.Sprintf("%s=%q", field.name, field.value))
+		}
+	}
+	if c.HasAttachment {
+		parts = append(parts, "hasAttachment")
+	}
+	if c.SizeComparison != "" {
+		parts = append(parts, fmt.Sprintf("size %s than %d", c.SizeComparison, c.Size))
+	}
+
+	parts = append(parts, "=>")
+	for _, id := range f.Action.AddLabelIDs {
+		parts = append(parts, "+"+id)
+	}
+	for _, id := range f.Action.RemoveLabelIDs {
+		parts = append(parts, "-"+id)
+	}
+	if f.Action.Forward != "" {
+		parts = append(parts, "forward:"+f.Action.Forward)
+	}
+	return strings.Join(parts, " ")
+}
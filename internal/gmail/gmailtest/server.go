@@ -0,0 +1,238 @@
+// Package gmailtest provides an in-process fake of the Gmail API's label
+// and filter methods for testing code that uses the gmail package.
+package gmailtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/brendanryan/gmail-brita/internal/gmail"
+)
+
+// Token is the access token the server accepts
+const Token = "gmailtest-token"
+
+// systemLabels are the labels every mailbox starts with
+var systemLabels = []string{
+	"INBOX", "SPAM", "TRASH", "UNREAD", "STARRED", "IMPORTANT", "SENT", "DRAFT",
+	"CATEGORY_PERSONAL", "CATEGORY_SOCIAL", "CATEGORY_UPDATES", "CATEGORY_FORUMS", "CATEGORY_PROMOTIONS",
+}
+
+// Server is a fake Gmail API holding one user's labels and filters in
+// memory. Like Gmail, it rejects filters that add more than one user label
+// or refer to labels that do not exist.
+type Server struct {
+	srv *httptest.Server
+
+	mu      sync.Mutex
+	labels  []gmail.Label
+	filters []gmail.Filter
+	nextID  int
+}
+
+// NewServer starts a server whose mailbox has only the system labels
+func NewServer() *Server {
+	s := &Server{}
+	for _, id := range systemLabels {
+		s.labels = append(s.labels, gmail.Label{ID: id, Name: id, Type: "system"})
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/gmail/v1/users/me/labels", s.handleLabels)
+	mux.HandleFunc("/gmail/v1/users/me/settings/filters", s.handleFilters)
+	mux.HandleFunc("/gmail/v1/users/me/settings/filters/", s.handleFilter)
+	s.srv = httptest.NewServer(s.authorize(mux))
+	return s
+}
+
+// Close shuts the server down
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// URL returns the base URL to pass to gmail.NewClient
+func (s *Server) URL() string {
+	return s.srv.URL + "/gmail/v1/users/me"
+}
+
+// Client returns a client for the server
+func (s *Server) Client() *gmail.Client {
+	return gmail.NewClient(s.srv.Client(), s.URL(), Token)
+}
+
+// AddLabel creates a user label directly, returning it with its ID
+func (s *Server) AddLabel(name string) gmail.Label {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addLabel(name)
+}
+
+// AddFilter creates a filter directly, returning it with its ID
+func (s *Server) AddFilter(f gmail.Filter) gmail.Filter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addFilter(f)
+}
+
+// Labels returns the labels in the mailbox
+func (s *Server) Labels() []gmail.Label {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]gmail.Label(nil), s.labels...)
+}
+
+// Filters returns the filters in the mailbox
+func (s *Server) Filters() []gmail.Filter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]gmail.Filter(nil), s.filters...)
+}
+
+func (s *Server) addLabel(name string) gmail.Label {
+	s.nextID++
+	l := gmail.Label{ID: fmt.Sprintf("Label_%d", s.nextID), Name: name, Type: "user"}
+	s.labels = append(s.labels, l)
+	return l
+}
+
+func (s *Server) addFilter(f gmail.Filter) gmail.Filter {
+	s.nextID++
+	f.ID = fmt.Sprintf("filter%d", s.nextID)
+	s.filters = append(s.filters, f)
+	return f
+}
+
+// authorize rejects requests without the server's token
+func (s *Server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+Token {
+			writeError(w, http.StatusUnauthorized, "Request had invalid authentication credentials.")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleLabels(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, map[string][]gmail.Label{"labels": s.labels})
+	case http.MethodPost:
+		var l gmail.Label
+		if err := json.NewDecoder(r.Body).Decode(&l); err != nil || l.Name == "" {
+			writeError(w, http.StatusBadRequest, "Invalid label name")
+			return
+		}
+		for _, existing := range s.labels {
+			if strings.EqualFold(existing.Name, l.Name) {
+				writeError(w, http.StatusConflict, "Label name exists or conflicts")
+				return
+			}
+		}
+		writeJSON(w, s.addLabel(l.Name))
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func (s *Server) handleFilters(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+		// Gmail leaves the list out entirely when there are no filters
+		resp := map[string][]gmail.Filter{}
+		if len(s.filters) > 0 {
+			resp["filter"] = s.filters
+		}
+		writeJSON(w, resp)
+	case http.MethodPost:
+		var f gmail.Filter
+		if err := json.NewDecoder(r.Body).Decode(&f); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON payload")
+			return
+		}
+		if msg := s.check(f); msg != "" {
+			writeError(w, http.StatusBadRequest, msg)
+			return
+		}
+		writeJSON(w, s.addFilter(f))
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func (s *Server) handleFilter(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := strings.TrimPrefix(r.URL.Path, "/gmail/v1/users/me/settings/filters/")
+	for i, f := range s.filters {
+		if f.ID != id {
+			continue
+		}
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, f)
+		case http.MethodDelete:
+			s.filters = append(s.filters[:i], s.filters[i+1:]...)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		}
+		return
+	}
+	writeError(w, http.StatusNotFound, "Requested entity was not found.")
+}
+
+// check returns why Gmail would reject the filter, or an empty string
+func (s *Server) check(f gmail.Filter) string {
+	if f.Criteria == (gmail.Criteria{}) {
+		return "Filter doesn't have any criteria"
+	}
+	a := f.Action
+	if len(a.AddLabelIDs) == 0 && len(a.RemoveLabelIDs) == 0 && a.Forward == "" {
+		return "Filter doesn't have any actions"
+	}
+
+	userLabels := 0
+	for _, id := range append(append([]string(nil), a.AddLabelIDs...), a.RemoveLabelIDs...) {
+		var label *gmail.Label
+		for i := range s.labels {
+			if s.labels[i].ID == id {
+				label = &s.labels[i]
+			}
+		}
+		if label == nil {
+			return fmt.Sprintf("Invalid label %s in AddLabelIds", id)
+		}
+		if label.Type == "user" {
+			userLabels++
+		}
+	}
+	if userLabels > 1 {
+		return "Only one user label may be added per filter"
+	}
+	return ""
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{"code": status, "message": message},
+	})
+}
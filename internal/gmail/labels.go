@@ -0,0 +1,114 @@
+package gmail
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// labelMap resolves label names to IDs for one mailbox, creating labels
+// that do not exist yet
+type labelMap struct {
+	client *Client
+	ids    map[string]string
+	names  map[string]string
+	dryRun bool
+	// created lists the labels created, or that would be in a dry run
+	created []string
+}
+
+// loadLabels lists the mailbox's labels. With dryRun, missing labels are
+// only recorded as created and resolve to their names.
+func loadLabels(ctx context.Context, c *Client, dryRun bool) (*labelMap, error) {
+	labels, err := c.Labels(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing labels: %w", err)
+	}
+	m := &labelMap{
+		client: c,
+		ids:    make(map[string]string, len(labels)),
+		names:  make(map[string]string, len(labels)),
+		dryRun: dryRun,
+	}
+	for _, l := range labels {
+		m.ids[l.Name] = l.ID
+		m.names[l.ID] = l.Name
+	}
+	return m, nil
+}
+
+// ensure creates the label, and each parent of a nested label, when they
+// do not exist
+func (m *labelMap) ensure(ctx context.Context, label string) error {
+	for _, name := range withParents(label) {
+		if _, ok := m.ids[name]; ok {
+			continue
+		}
+		m.created = append(m.created, name)
+		if m.dryRun {
+			m.ids[name] = name
+			continue
+		}
+		created, err := m.client.CreateLabel(ctx, Label{Name: name})
+		if err != nil {
+			return fmt.Errorf("creating label %q: %w", name, err)
+		}
+		m.ids[name] = created.ID
+		m.names[created.ID] = name
+	}
+	return nil
+}
+
+// resolve replaces the label names in a filter's actions with label IDs,
+// creating the labels that are missing. Gmail's system labels are named
+// by their IDs, so they resolve to themselves.
+func (m *labelMap) resolve(ctx context.Context, f Filter) (Filter, error) {
+	var err error
+	ids := func(names []string) []string {
+		if len(names) == 0 {
+			return nil
+		}
+		out := make([]string, 0, len(names))
+		for _, name := range names {
+			if err == nil {
+				err = m.ensure(ctx, name)
+			}
+			out = append(out, m.ids[name])
+		}
+		return out
+	}
+	f.Action.AddLabelIDs = ids(f.Action.AddLabelIDs)
+	f.Action.RemoveLabelIDs = ids(f.Action.RemoveLabelIDs)
+	return f, err
+}
+
+// named replaces the label IDs in a filter's actions with label names
+func (m *labelMap) named(f Filter) Filter {
+	names := func(ids []string) []string {
+		if len(ids) == 0 {
+			return nil
+		}
+		out := make([]string, 0, len(ids))
+		for _, id := range ids {
+			if name, ok := m.names[id]; ok {
+				id = name
+			}
+			out = append(out, id)
+		}
+		return out
+	}
+	f.Action.AddLabelIDs = names(f.Action.AddLabelIDs)
+	f.Action.RemoveLabelIDs = names(f.Action.RemoveLabelIDs)
+	return f
+}
+
+// withParents returns a nested label name preceded by each of its parents,
+// such as "work", "work/robots" for "work/robots"
+func withParents(label string) []string {
+	segments := strings.Split(label, "/")
+	names := make([]string, 0, len(segments))
+	for i := range segments {
+		names = append(names, strings.Join(segments[:i+1], "/"))
+	}
+	return names
+}
@@ -0,0 +1,359 @@
+package gmail
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/brendanryan/gmail-brita/internal/filter"
+)
+
+// OperationKind is the change an operation makes to a Gmail filter
+type OperationKind string
+
+// Operation kinds
+const (
+	// OpCreate creates a filter
+	OpCreate OperationKind = "create"
+	// OpUpdate replaces a managed filter that no longer matches the config
+	// filter with its stable ID, such as after one of its labels was
+	// renamed in Gmail. Gmail filters cannot be edited, so the new filter
+	// is created before the old one is deleted.
+	OpUpdate OperationKind = "update"
+	// OpDelete deletes a managed filter that is no longer in the config
+	OpDelete OperationKind = "delete"
+	// OpAdopt records an unmanaged filter identical to one in the config
+	// in the state instead of creating a duplicate
+	OpAdopt OperationKind = "adopt"
+)
+
+// Operation is a single change in a plan. Filters refer to labels by name.
+type Operation struct {
+	Kind OperationKind `json:"kind"`
+	// ID is the filter's stable ID
+	ID string `json:"id"`
+	// Name is the name of the config filter, when it has one
+	Name string `json:"name,omitempty"`
+	// GmailID is the existing filter that is replaced, deleted or adopted
+	GmailID string `json:"gmail_id,omitempty"`
+	// Filter is the filter the config describes
+	Filter *Filter `json:"filter,omitempty"`
+	// Current is the existing filter that is replaced or deleted
+	Current *Filter `json:"current,omitempty"`
+}
+
+// Plan lists the operations that bring the managed filters in line with a
+// config
+type Plan struct {
+	Operations []Operation `json:"operations"`
+	Unchanged  int         `json:"unchanged"`
+	// Unmanaged counts the existing filters the plan leaves alone
+	Unmanaged int `json:"unmanaged"`
+	// FromExport is set when the current filters were read from a filter
+	// export. Export entry IDs are not Gmail API filter IDs, so such a plan
+	// is only for review and Apply refuses it.
+	FromExport bool `json:"from_export,omitempty"`
+	// Fingerprint identifies the state and the current filters the plan
+	// was made from, and Apply refuses the plan once they change
+	Fingerprint string `json:"fingerprint"`
+}
+
+// Errors returned by Apply for plans that cannot be applied
+var (
+	// ErrPlanFromExport is returned for a plan made from an export
+	ErrPlanFromExport = errors.New("the plan was made from a filter export, whose IDs are not Gmail filter IDs; plan against the Gmail API to apply it")
+	// ErrStalePlan is returned for a plan made before the state or the
+	// Gmail filters last changed
+	ErrStalePlan = errors.New("the state or the Gmail filters changed since the plan was made; plan again")
+)
+
+// Empty reports whether the plan changes nothing
+func (p *Plan) Empty() bool {
+	return len(p.Operations) == 0
+}
+
+// Managed is a filter described by a config along with its stable ID
+type Managed struct {
+	ID     string
+	Name   string
+	Filter Filter
+}
+
+// Desired converts a filter set to Gmail filters that refer to labels by
+// name. Each filter's stable ID is the EntryID derived from its content,
+// so adding, removing, reordering or renaming other filters leaves it
+// alone, while changing the filter itself replaces it.
+func Desired(set *filter.Set) ([]Managed, error) {
+	entries, err := set.Entries()
+	if err != nil {
+		return nil, err
+	}
+
+	managed := make([]Managed, 0, len(entries))
+	for _, e := range entries {
+		f := Convert(e, nil)
+		f.ID = ""
+		managed = append(managed, Managed{ID: e.EntryID, Name: e.Name, Filter: f})
+	}
+	return managed, nil
+}
+
+// Current fetches the user's filters, referring to labels by name
+func Current(ctx context.Context, c *Client) ([]Filter, error) {
+	labels, err := loadLabels(ctx, c, true)
+	if err != nil {
+		return nil, err
+	}
+	filters, err := c.Filters(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing filters: %w", err)
+	}
+	for i := range filters {
+		filters[i] = labels.named(filters[i])
+	}
+	return filters, nil
+}
+
+// CurrentFromExport returns the filters in a Gmail filter export, each
+// with the ID recorded in the export. These are not Gmail API filter IDs,
+// so plans made from them must set FromExport.
+func CurrentFromExport(set *filter.Set) []Filter {
+	filters := make([]Filter, 0, len(set.Filters))
+	for _, f := range set.Filters {
+		filters = append(filters, Convert(f, nil))
+	}
+	return filters
+}
+
+// NewPlan compares the filters a config describes with the current ones.
+// Filters recorded in the state are updated or deleted to match the
+// config, config filters missing from the state are created, or adopted
+// when an identical unmanaged filter exists, and every other existing
+// filter is left alone.
+func NewPlan(desired []Managed, current []Filter, state *State) *Plan {
+	plan := &Plan{
+		Operations:  make([]Operation, 0),
+		Fingerprint: Fingerprint(current, state),
+	}
+
+	byID := make(map[string]Filter, len(current))
+	for _, f := range current {
+		byID[f.ID] = f
+	}
+	managed := make(map[string]bool, len(state.Filters))
+	for _, gmailID := range state.Filters {
+		managed[gmailID] = true
+	}
+	unmanaged := make(map[string][]Filter)
+	for _, f := range current {
+		if !managed[f.ID] {
+			unmanaged[f.key()] = append(unmanaged[f.key()], f)
+			plan.Unmanaged++
+		}
+	}
+
+	wanted := make(map[string]bool, len(desired))
+	for _, d := range desired {
+		wanted[d.ID] = true
+		f := d.Filter
+
+		if gmailID, ok := state.Filters[d.ID]; ok {
+			if cur, ok := byID[gmailID]; ok {
+				if cur.key() == f.key() {
+					plan.Unchanged++
+				} else {
+					plan.Operations = append(plan.Operations, Operation{Kind: OpUpdate, ID: d.ID, Name: d.Name, GmailID: gmailID, Filter: &f, Current: &cur})
+				}
+				continue
+			}
+			// The filter was deleted outside this tool, so it is created
+			// again below
+		}
+
+		if matches := unmanaged[f.key()]; len(matches) > 0 {
+			unmanaged[f.key()] = matches[1:]
+			plan.Unmanaged--
+			plan.Operations = append(plan.Operations, Operation{Kind: OpAdopt, ID: d.ID, Name: d.Name, GmailID: matches[0].ID, Filter: &f})
+			continue
+		}
+		plan.Operations = append(plan.Operations, Operation{Kind: OpCreate, ID: d.ID, Name: d.Name, Filter: &f})
+	}
+
+	for _, id := range state.ids() {
+		if wanted[id] {
+			continue
+		}
+		op := Operation{Kind: OpDelete, ID: id, GmailID: state.Filters[id]}
+		if cur, ok := byID[op.GmailID]; ok {
+			op.Current = &cur
+		}
+		plan.Operations = append(plan.Operations, op)
+	}
+
+	return plan
+}
+
+// Fingerprint derives an ID from the state and the current filters that
+// changes whenever either does, regardless of the order of the filters
+func Fingerprint(current []Filter, state *State) string {
+	lines := make([]string, 0, len(current))
+	for _, f := range current {
+		lines = append(lines, f.ID+"\x00"+f.key())
+	}
+	sort.Strings(lines)
+
+	h := sha256.New()
+	for _, id := range state.ids() {
+		fmt.Fprintf(h, "state %s %s\n", id, state.Filters[id])
+	}
+	for _, line := range lines {
+		fmt.Fprintf(h, "filter %s\n", line)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ApplyResult describes the changes Apply made
+type ApplyResult struct {
+	CreatedLabels []string
+	Applied       int
+}
+
+// Apply carries out a plan's operations in order, recording each in the
+// state as it succeeds, so the state stays accurate when an operation
+// fails part way. Filters that are already gone when they are deleted are
+// only removed from the state. Plans made from an export are refused with
+// ErrPlanFromExport, and plans whose fingerprint no longer matches the
+// state and the user's filters with ErrStalePlan.
+func Apply(ctx context.Context, c *Client, plan *Plan, state *State) (*ApplyResult, error) {
+	if plan.FromExport {
+		return nil, ErrPlanFromExport
+	}
+	current, err := Current(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	if Fingerprint(current, state) != plan.Fingerprint {
+		return nil, ErrStalePlan
+	}
+
+	labels, err := loadLabels(ctx, c, false)
+	if err != nil {
+		return nil, err
+	}
+	result := &ApplyResult{}
+
+	for _, op := range plan.Operations {
+		if err := apply(ctx, c, labels, op, state); err != nil {
+			result.CreatedLabels = labels.created
+			return result, fmt.Errorf("%s %s: %w", op.Kind, op.ID, err)
+		}
+		result.Applied++
+	}
+	result.CreatedLabels = labels.created
+	return result, nil
+}
+
+// apply carries out a single operation
+func apply(ctx context.Context, c *Client, labels *labelMap, op Operation, state *State) error {
+	switch op.Kind {
+	case OpCreate, OpUpdate:
+		if op.Filter == nil {
+			return errors.New("operation has no filter")
+		}
+		f, err := labels.resolve(ctx, *op.Filter)
+		if err != nil {
+			return err
+		}
+		created, err := c.CreateFilter(ctx, f)
+		if err != nil {
+			return err
+		}
+		state.Filters[op.ID] = created.ID
+		if op.Kind == OpUpdate {
+			return deleteFilter(ctx, c, op.GmailID)
+		}
+	case OpDelete:
+		if err := deleteFilter(ctx, c, op.GmailID); err != nil {
+			return err
+		}
+		delete(state.Filters, op.ID)
+	case OpAdopt:
+		state.Filters[op.ID] = op.GmailID
+	default:
+		return fmt.Errorf("unknown operation %q", op.Kind)
+	}
+	return nil
+}
+
+// deleteFilter deletes a filter, treating one that no longer exists as
+// deleted
+func deleteFilter(ctx context.Context, c *Client, id string) error {
+	err := c.DeleteFilter(ctx, id)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
+
+// WriteText writes the operations one per line followed by a summary
+func (p *Plan) WriteText(w io.Writer) error {
+	var b strings.Builder
+	counts := make(map[OperationKind]int)
+	for _, op := range p.Operations {
+		counts[op.Kind]++
+		name := op.ID
+		if op.Name != "" {
+			name = op.Name + " " + op.ID
+		}
+		switch op.Kind {
+		case OpCreate:
+			fmt.Fprintf(&b, "+ %s: %s\n", name, op.Filter)
+		case OpUpdate:
+			fmt.Fprintf(&b, "~ %s (%s): %s\n    was: %s\n", name, op.GmailID, op.Filter, op.Current)
+		case OpDelete:
+			if op.Current != nil {
+				fmt.Fprintf(&b, "- %s (%s): %s\n", name, op.GmailID, op.Current)
+			} else {
+				fmt.Fprintf(&b, "- %s (%s): already deleted in Gmail\n", name, op.GmailID)
+			}
+		case OpAdopt:
+			fmt.Fprintf(&b, "= %s (%s): %s\n", name, op.GmailID, op.Filter)
+		}
+	}
+
+	if p.Empty() {
+		b.WriteString("No changes.\n")
+	}
+	if p.FromExport {
+		b.WriteString("Planned against a filter export: review only, apply will refuse this plan.\n")
+	}
+	fmt.Fprintf(&b, "Plan: %d to create, %d to update, %d to delete, %d to adopt; %d unchanged, %d unmanaged left alone\n",
+		counts[OpCreate], counts[OpUpdate], counts[OpDelete], counts[OpAdopt], p.Unchanged, p.Unmanaged)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteJSON writes the plan as indented JSON, which ReadPlan reads back
+func (p *Plan) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(p)
+}
+
+// ReadPlan reads a plan written by WriteJSON
+func ReadPlan(r io.Reader) (*Plan, error) {
+	var p Plan
+	if err := json.NewDecoder(r).Decode(&p); err != nil {
+		return nil, fmt.Errorf("reading plan: %w", err)
+	}
+	return &p, nil
+}
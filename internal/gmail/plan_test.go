@@ -0,0 +1,253 @@
+package gmail_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/brendanryan/gmail-brita/internal/filter"
+	"github.com/brendanryan/gmail-brita/internal/gmail"
+	"github.com/brendanryan/gmail-brita/internal/gmail/gmailtest"
+)
+
+// kinds lists the plan's operations by kind and filter name, or stable ID
+// for filters with no name
+func kinds(p *gmail.Plan) string {
+	var got []string
+	for _, op := range p.Operations {
+		name := op.Name
+		if name == "" {
+			name = op.ID
+		}
+		got = append(got, string(op.Kind)+" "+name)
+	}
+	return strings.Join(got, ", ")
+}
+
+// deleted lists delete operations for the IDs in the order plans give
+// them
+func deleted(ids ...string) string {
+	sorted := append([]string(nil), ids...)
+	sort.Strings(sorted)
+	for i, id := range sorted {
+		sorted[i] = "delete " + id
+	}
+	return strings.Join(sorted, ", ")
+}
+
+// stableIDs returns the stable IDs of the filters in a set
+func stableIDs(t *testing.T, set *filter.Set) []string {
+	t.Helper()
+	desired, err := gmail.Desired(set)
+	if err != nil {
+		t.Fatalf("Desired() error = %v", err)
+	}
+	ids := make([]string, 0, len(desired))
+	for _, d := range desired {
+		ids = append(ids, d.ID)
+	}
+	return ids
+}
+
+func plan(t *testing.T, srv *gmailtest.Server, set *filter.Set, state *gmail.State) *gmail.Plan {
+	t.Helper()
+	desired, err := gmail.Desired(set)
+	if err != nil {
+		t.Fatalf("Desired() error = %v", err)
+	}
+	current, err := gmail.Current(context.Background(), srv.Client())
+	if err != nil {
+		t.Fatalf("Current() error = %v", err)
+	}
+	return gmail.NewPlan(desired, current, state)
+}
+
+func TestPlanApply(t *testing.T) {
+	srv := gmailtest.NewServer()
+	defer srv.Close()
+	ctx := context.Background()
+
+	// A filter managed by hand and one identical to the Deals filter
+	manual := srv.AddFilter(gmail.Filter{
+		Criteria: gmail.Criteria{From: "boss@example.com"},
+		Action:   gmail.Action{AddLabelIDs: []string{gmail.LabelStarred}},
+	})
+	deals := srv.AddFilter(gmail.Filter{
+		Criteria: gmail.Criteria{Subject: "sale", Size: 5 * 1024 * 1024, SizeComparison: "larger"},
+		Action: gmail.Action{
+			AddLabelIDs:    []string{"CATEGORY_PROMOTIONS"},
+			RemoveLabelIDs: []string{gmail.LabelUnread},
+		},
+	})
+
+	state := gmail.NewState()
+	p := plan(t, srv, testSet(), state)
+	if got, want := kinds(p), "create Robots, create Robots, adopt Deals"; got != want {
+		t.Fatalf("plan = %s, want %s", got, want)
+	}
+	if p.Unmanaged != 1 {
+		t.Errorf("Unmanaged = %d, want 1", p.Unmanaged)
+	}
+
+	// The plan survives a round trip through its file
+	var buf bytes.Buffer
+	if err := p.WriteJSON(&buf); err != nil {
+		t.Fatalf("WriteJSON() error = %v", err)
+	}
+	p, err := gmail.ReadPlan(&buf)
+	if err != nil {
+		t.Fatalf("ReadPlan() error = %v", err)
+	}
+
+	result, err := gmail.Apply(ctx, srv.Client(), p, state)
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if result.Applied != 3 || strings.Join(result.CreatedLabels, ",") != "work,work/robots,todo" {
+		t.Errorf("Apply() = %+v", result)
+	}
+	ids := stableIDs(t, testSet())
+	if len(state.Filters) != 3 || state.Filters[ids[2]] != deals.ID {
+		t.Errorf("state = %v", state.Filters)
+	}
+	if len(srv.Filters()) != 4 {
+		t.Errorf("server has %d filters, want 4", len(srv.Filters()))
+	}
+
+	// Applying the same config again plans nothing
+	if p := plan(t, srv, testSet(), state); !p.Empty() || p.Unchanged != 3 {
+		t.Errorf("second plan = %s with %d unchanged", kinds(p), p.Unchanged)
+	}
+
+	// Inserting, reordering and renaming filters leaves the others alone
+	reordered := filter.NewFilterSet([]string{"me@example.com"})
+	filter.NewBuilder(reordered).Name("Bargains").
+		Subject([]string{"sale"}).
+		Larger(5 * 1024 * 1024).
+		Category("promotions").
+		MarkRead()
+	filter.NewBuilder(reordered).Name("Boss").
+		From([]string{"boss@example.com"}).
+		Label("boss")
+	filter.NewBuilder(reordered).Name("Robots").
+		From([]string{"robots@bigco.com"}).
+		Label("work/robots").
+		Label("todo").
+		Archive()
+	if p := plan(t, srv, reordered, state); kinds(p) != "create Boss" || p.Unchanged != 3 {
+		t.Errorf("reordered plan = %s with %d unchanged", kinds(p), p.Unchanged)
+	}
+
+	// Dropping Robots and changing Deals deletes and replaces only those
+	changed := filter.NewFilterSet([]string{"me@example.com"})
+	filter.NewBuilder(changed).Name("Deals").
+		Subject([]string{"sale"}).
+		Label("deals")
+	p = plan(t, srv, changed, state)
+	if got, want := kinds(p), "create Deals, "+deleted(ids...); got != want {
+		t.Fatalf("plan = %s, want %s", got, want)
+	}
+
+	var out bytes.Buffer
+	if err := p.WriteText(&out); err != nil {
+		t.Fatalf("WriteText() error = %v", err)
+	}
+	newID := stableIDs(t, changed)[0]
+	for _, want := range []string{
+		`+ Deals ` + newID + `: subject="sale" => +deals`,
+		`- ` + ids[2] + ` (` + deals.ID + `): subject="sale"`,
+		"Plan: 1 to create, 0 to update, 3 to delete, 0 to adopt; 0 unchanged, 1 unmanaged left alone",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("WriteText() output missing %q:\n%s", want, out.String())
+		}
+	}
+
+	if _, err := gmail.Apply(ctx, srv.Client(), p, state); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	filters := srv.Filters()
+	if len(filters) != 2 || filters[0].ID != manual.ID {
+		t.Errorf("server filters = %+v, want the manual filter and the new Deals", filters)
+	}
+	if len(state.Filters) != 1 || state.Filters[newID] != filters[1].ID {
+		t.Errorf("state = %v", state.Filters)
+	}
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := state.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	loaded, err := gmail.LoadState(path)
+	if err != nil {
+		t.Fatalf("LoadState() error = %v", err)
+	}
+	if loaded.Filters[newID] != state.Filters[newID] {
+		t.Errorf("loaded state = %v", loaded.Filters)
+	}
+}
+
+func TestApplyStalePlan(t *testing.T) {
+	srv := gmailtest.NewServer()
+	defer srv.Close()
+	ctx := context.Background()
+
+	state := gmail.NewState()
+	p := plan(t, srv, testSet(), state)
+
+	// A filter made by hand since the plan
+	srv.AddFilter(gmail.Filter{
+		Criteria: gmail.Criteria{From: "boss@example.com"},
+		Action:   gmail.Action{AddLabelIDs: []string{gmail.LabelStarred}},
+	})
+	if _, err := gmail.Apply(ctx, srv.Client(), p, state); !errors.Is(err, gmail.ErrStalePlan) {
+		t.Errorf("Apply() error = %v, want ErrStalePlan", err)
+	}
+
+	// A state changed since the plan
+	p = plan(t, srv, testSet(), state)
+	state.Filters["gone"] = "z0000000001"
+	if _, err := gmail.Apply(ctx, srv.Client(), p, state); !errors.Is(err, gmail.ErrStalePlan) {
+		t.Errorf("Apply() error = %v, want ErrStalePlan", err)
+	}
+	if len(srv.Filters()) != 1 {
+		t.Errorf("server has %d filters, want the stale plans not applied", len(srv.Filters()))
+	}
+}
+
+func TestCurrentFromExport(t *testing.T) {
+	data := `<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom" xmlns:apps="http://schemas.google.com/apps/2006">
+  <entry>
+    <id>tag:mail.google.com,2008:filter:z0000001687</id>
+    <apps:property name="from" value="boss@example.com"/>
+    <apps:property name="shouldStar" value="true"/>
+  </entry>
+</feed>`
+	set, err := filter.ParseXML([]byte(data))
+	if err != nil {
+		t.Fatalf("ParseXML() error = %v", err)
+	}
+
+	current := gmail.CurrentFromExport(set)
+	state := &gmail.State{Filters: map[string]string{"Boss": "z0000001687"}}
+	p := gmail.NewPlan(nil, current, state)
+	if got := kinds(p); got != "delete Boss" || p.Operations[0].Current == nil {
+		t.Errorf("plan = %s, want the exported filter deleted", got)
+	}
+
+	// The export's IDs are not API filter IDs, so the plan is not applied
+	srv := gmailtest.NewServer()
+	defer srv.Close()
+	p.FromExport = true
+	if _, err := gmail.Apply(context.Background(), srv.Client(), p, state); !errors.Is(err, gmail.ErrPlanFromExport) {
+		t.Errorf("Apply() error = %v, want ErrPlanFromExport", err)
+	}
+	if len(state.Filters) != 1 {
+		t.Errorf("state = %v, want it unchanged", state.Filters)
+	}
+}
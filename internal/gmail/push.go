@@ -0,0 +1,109 @@
+package gmail
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/brendanryan/gmail-brita/internal/filter"
+)
+
+// PushResult describes the changes Push made, or would make in a dry run
+type PushResult struct {
+	CreatedLabels  []string
+	CreatedFilters []Filter
+	DeletedFilters []Filter
+	Unchanged      int
+	// Kept counts the Gmail filters not in the set that were left alone
+	Kept int
+}
+
+// Push adds the filter set to the user's Gmail filters. It creates the
+// labels the filters apply that do not exist yet, along with their parent
+// labels, and creates the filters missing from Gmail. Push cannot tell the
+// filters it created before from those made by hand, so other Gmail
+// filters are left alone unless prune is set, when every Gmail filter that
+// is not in the set is deleted. New filters are created before stale ones
+// are deleted, so a failure part way leaves mail filtered. With dryRun,
+// nothing is changed and the result lists what would be.
+func Push(ctx context.Context, c *Client, set *filter.Set, dryRun, prune bool) (*PushResult, error) {
+	result := &PushResult{}
+
+	entries, err := set.Entries()
+	if err != nil {
+		return nil, err
+	}
+	labels, err := loadLabels(ctx, c, dryRun)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := c.Filters(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing filters: %w", err)
+	}
+	stale := make(map[string][]Filter, len(existing))
+	for _, f := range existing {
+		stale[f.key()] = append(stale[f.key()], f)
+	}
+
+	for _, e := range entries {
+		f, err := labels.resolve(ctx, Convert(e, nil))
+		result.CreatedLabels = labels.created
+		if err != nil {
+			return result, err
+		}
+		if matches := stale[f.key()]; len(matches) > 0 {
+			stale[f.key()] = matches[1:]
+			result.Unchanged++
+			continue
+		}
+		result.CreatedFilters = append(result.CreatedFilters, f)
+		if dryRun {
+			continue
+		}
+		if _, err := c.CreateFilter(ctx, f); err != nil {
+			return result, fmt.Errorf("creating filter %s: %w", f, err)
+		}
+	}
+
+	for _, f := range existing {
+		matches := stale[f.key()]
+		if len(matches) == 0 || matches[0].ID != f.ID {
+			continue
+		}
+		stale[f.key()] = matches[1:]
+		if !prune {
+			result.Kept++
+			continue
+		}
+		result.DeletedFilters = append(result.DeletedFilters, f)
+		if dryRun {
+			continue
+		}
+		if err := c.DeleteFilter(ctx, f.ID); err != nil {
+			return result, fmt.Errorf("deleting filter %s: %w", f.ID, err)
+		}
+	}
+
+	return result, nil
+}
+
+// WriteText writes the changes one per line followed by a summary
+func (r *PushResult) WriteText(w io.Writer) error {
+	var b strings.Builder
+	for _, name := range r.CreatedLabels {
+		fmt.Fprintf(&b, "+ label %s\n", name)
+	}
+	for _, f := range r.CreatedFilters {
+		fmt.Fprintf(&b, "+ filter %s\n", f)
+	}
+	for _, f := range r.DeletedFilters {
+		fmt.Fprintf(&b, "- filter %s %s\n", f.ID, f)
+	}
+	fmt.Fprintf(&b, "%d labels created, %d filters created, %d deleted, %d unchanged, %d left alone\n",
+		len(r.CreatedLabels), len(r.CreatedFilters), len(r.DeletedFilters), r.Unchanged, r.Kept)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,167 @@
+package gmail_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/brendanryan/gmail-brita/internal/filter"
+	"github.com/brendanryan/gmail-brita/internal/gmail"
+	"github.com/brendanryan/gmail-brita/internal/gmail/gmailtest"
+)
+
+func testSet() *filter.Set {
+	set := filter.NewFilterSet([]string{"me@example.com"})
+	filter.NewBuilder(set).Name("Robots").
+		From([]string{"robots@bigco.com"}).
+		Label("work/robots").
+		Label("todo").
+		Archive()
+	filter.NewBuilder(set).Name("Deals").
+		Subject([]string{"sale"}).
+		Larger(5 * 1024 * 1024).
+		Category("promotions").
+		MarkRead()
+	return set
+}
+
+func TestConvert(t *testing.T) {
+	entries, err := testSet().Entries()
+	if err != nil {
+		t.Fatalf("Entries() error = %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want 3", len(entries))
+	}
+
+	f := gmail.Convert(entries[0], map[string]string{"work/robots": "Label_7"})
+	if f.Criteria.From != "robots@bigco.com" {
+		t.Errorf("From = %q", f.Criteria.From)
+	}
+	if got := strings.Join(f.Action.AddLabelIDs, ","); got != "Label_7" {
+		t.Errorf("AddLabelIDs = %q", got)
+	}
+	if got := strings.Join(f.Action.RemoveLabelIDs, ","); got != "INBOX" {
+		t.Errorf("RemoveLabelIDs = %q", got)
+	}
+
+	// Labels missing from the map keep their names
+	if got := gmail.Convert(entries[1], nil).Action.AddLabelIDs; len(got) != 1 || got[0] != "todo" {
+		t.Errorf("AddLabelIDs = %q, want the label name", got)
+	}
+
+	deals := gmail.Convert(entries[2], nil)
+	if deals.Criteria.Size != 5*1024*1024 || deals.Criteria.SizeComparison != "larger" {
+		t.Errorf("Criteria = %+v", deals.Criteria)
+	}
+	if got := strings.Join(deals.Action.AddLabelIDs, ","); got != "CATEGORY_PROMOTIONS" {
+		t.Errorf("AddLabelIDs = %q", got)
+	}
+}
+
+func TestReadLabelIDs(t *testing.T) {
+	for name, data := range map[string]string{
+		"object":      `{"work/robots": "Label_7", "todo": "Label_8"}`,
+		"labels.list": `{"labels": [{"id": "Label_7", "name": "work/robots", "type": "user"}, {"id": "Label_8", "name": "todo"}]}`,
+	} {
+		ids, err := gmail.ReadLabelIDs(strings.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: ReadLabelIDs() error = %v", name, err)
+		}
+		if len(ids) != 2 || ids["work/robots"] != "Label_7" || ids["todo"] != "Label_8" {
+			t.Errorf("%s: ReadLabelIDs() = %v", name, ids)
+		}
+	}
+
+	if _, err := gmail.ReadLabelIDs(strings.NewReader(`["Label_7"]`)); err == nil {
+		t.Error("ReadLabelIDs() of a list succeeded")
+	}
+}
+
+func TestPush(t *testing.T) {
+	srv := gmailtest.NewServer()
+	defer srv.Close()
+	ctx := context.Background()
+
+	work := srv.AddLabel("work")
+	stale := srv.AddFilter(gmail.Filter{
+		Criteria: gmail.Criteria{From: "old@example.com"},
+		Action:   gmail.Action{AddLabelIDs: []string{work.ID}},
+	})
+
+	result, err := gmail.Push(ctx, srv.Client(), testSet(), true, false)
+	if err != nil {
+		t.Fatalf("Push() dry run error = %v", err)
+	}
+	if len(result.CreatedFilters) != 3 || len(srv.Filters()) != 1 {
+		t.Errorf("dry run created %d filters, server has %d", len(result.CreatedFilters), len(srv.Filters()))
+	}
+
+	result, err = gmail.Push(ctx, srv.Client(), testSet(), false, false)
+	if err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+	if got := strings.Join(result.CreatedLabels, ","); got != "work/robots,todo" {
+		t.Errorf("CreatedLabels = %q, want the missing labels only", got)
+	}
+	if len(result.CreatedFilters) != 3 || len(result.DeletedFilters) != 0 || result.Kept != 1 {
+		t.Errorf("result = %+v", result)
+	}
+	if len(srv.Filters()) != 4 {
+		t.Fatalf("server has %d filters, want 4", len(srv.Filters()))
+	}
+
+	// Pushing again changes nothing and leaves the other filter alone
+	result, err = gmail.Push(ctx, srv.Client(), testSet(), false, false)
+	if err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+	var out bytes.Buffer
+	if err := result.WriteText(&out); err != nil {
+		t.Fatalf("WriteText() error = %v", err)
+	}
+	if want := "0 labels created, 0 filters created, 0 deleted, 3 unchanged, 1 left alone\n"; out.String() != want {
+		t.Errorf("WriteText() = %q, want %q", out.String(), want)
+	}
+
+	// Pruning deletes every filter not in the set
+	result, err = gmail.Push(ctx, srv.Client(), testSet(), false, true)
+	if err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+	if len(result.DeletedFilters) != 1 || result.DeletedFilters[0].ID != stale.ID || result.Kept != 0 {
+		t.Errorf("result = %+v", result)
+	}
+	filters := srv.Filters()
+	if len(filters) != 3 {
+		t.Fatalf("server has %d filters, want 3", len(filters))
+	}
+	for _, f := range filters {
+		if f.ID == stale.ID {
+			t.Errorf("stale filter %s was not deleted", f.ID)
+		}
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	srv := gmailtest.NewServer()
+	defer srv.Close()
+
+	client := gmail.NewClient(http.DefaultClient, srv.URL(), "wrong")
+	_, err := client.Labels(context.Background())
+	var apiErr *gmail.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Labels() error = %v, want an unauthorized APIError", err)
+	}
+
+	_, err = srv.Client().CreateFilter(context.Background(), gmail.Filter{
+		Criteria: gmail.Criteria{From: "a@example.com"},
+		Action:   gmail.Action{AddLabelIDs: []string{"Label_404"}},
+	})
+	if !errors.As(err, &apiErr) || !strings.Contains(apiErr.Message, "Invalid label") {
+		t.Errorf("CreateFilter() error = %v, want an invalid label APIError", err)
+	}
+}
@@ -0,0 +1,78 @@
+package gmail
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// State records the Gmail filters created from a config, mapping each
+// filter's stable ID to its Gmail filter ID. Filters missing from the
+// state are not managed and plans leave them alone.
+type State struct {
+	Filters map[string]string `json:"filters"`
+}
+
+// NewState returns a state managing no filters
+func NewState() *State {
+	return &State{Filters: make(map[string]string)}
+}
+
+// LoadState reads a state file, returning an empty state when the file
+// does not exist yet
+func LoadState(path string) (*State, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return NewState(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading state: %w", err)
+	}
+
+	state := NewState()
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("parsing state %s: %w", path, err)
+	}
+	if state.Filters == nil {
+		state.Filters = make(map[string]string)
+	}
+	return state, nil
+}
+
+// Save writes the state file, replacing it only once it is fully written
+func (s *State) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".state-*")
+	if err != nil {
+		return fmt.Errorf("writing state: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing state: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("writing state: %w", err)
+	}
+	return nil
+}
+
+// ids returns the stable IDs in the state in order
+func (s *State) ids() []string {
+	ids := make([]string, 0, len(s.Filters))
+	for id := range s.Filters {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,314 @@
+// Package lint analyses a filter set for filters that duplicate, contradict
+// or make each other redundant, and for conditions that can never match.
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/brendanryan/gmail-brita/internal/filter"
+	"github.com/brendanryan/gmail-brita/internal/lintrule"
+	"github.com/brendanryan/gmail-brita/internal/query"
+)
+
+// Rule identifies a lint check. Rules can be suppressed for a filter by
+// listing them in its lint_ignore key.
+type Rule = lintrule.Rule
+
+// Lint rules, described in package lintrule
+const (
+	RuleDuplicate          = lintrule.Duplicate
+	RuleConflictingActions = lintrule.ConflictingActions
+	RuleUnsatisfiable      = lintrule.Unsatisfiable
+	RuleRedundant          = lintrule.Redundant
+)
+
+// Rules lists every lint rule
+var Rules = lintrule.All
+
+// Finding is a problem found in a filter
+type Finding struct {
+	Rule Rule `json:"rule"`
+	// Filter is the position of the filter the finding is about, starting
+	// at 1
+	Filter int    `json:"filter"`
+	Name   string `json:"name,omitempty"`
+	// Related is the position of the other filter involved, or zero
+	Related int    `json:"related,omitempty"`
+	Message string `json:"message"`
+}
+
+// Report lists the findings for a filter set in filter order
+type Report struct {
+	Findings []Finding `json:"findings"`
+}
+
+// Empty reports whether nothing was found
+func (r *Report) Empty() bool {
+	return len(r.Findings) == 0
+}
+
+// analyzed is a filter prepared for comparison. A filter matches a message
+// when every one of its terms does.
+type analyzed struct {
+	index   int
+	filter  *filter.Filter
+	terms   []query.Node
+	keys    map[string]bool
+	actions []string
+}
+
+// Run checks every filter in the set against every rule
+func Run(set *filter.Set) (*Report, error) {
+	filters := make([]*analyzed, 0, len(set.Filters))
+	for i, f := range set.Filters {
+		a, err := analyze(i, f)
+		if err != nil {
+			return nil, fmt.Errorf("filter %d: %w", i+1, err)
+		}
+		filters = append(filters, a)
+	}
+
+	l := &linter{report: &Report{Findings: make([]Finding, 0)}}
+	for i, a := range filters {
+		l.checkUnsatisfiable(a)
+		for _, earlier := range filters[:i] {
+			l.checkPair(earlier, a)
+		}
+	}
+	return l.report, nil
+}
+
+// analyze splits a filter's normalized query into its top-level terms
+func analyze(index int, f *filter.Filter) (*analyzed, error) {
+	q, err := f.Query()
+	if err != nil {
+		return nil, err
+	}
+
+	a := &analyzed{
+		index:   index,
+		filter:  f,
+		keys:    make(map[string]bool),
+		actions: f.Actions(),
+	}
+	switch n := query.Normalize(q).(type) {
+	case nil:
+	case query.And:
+		a.terms = n
+	default:
+		a.terms = []query.Node{n}
+	}
+	for _, t := range a.terms {
+		a.keys[key(t)] = true
+	}
+	return a, nil
+}
+
+// key identifies a term for comparison; Gmail searches ignore case
+func key(n query.Node) string {
+	return strings.ToLower(n.String())
+}
+
+// narrower reports whether every message matched by a is also matched by
+// b, judged by a having all of b's terms
+func narrower(a, b *analyzed) bool {
+	for k := range b.keys {
+		if !a.keys[k] {
+			return false
+		}
+	}
+	return true
+}
+
+// overlap reports whether a and b may match the same message: one is
+// narrower than the other, or they share a term and do not contradict
+// each other
+func overlap(a, b *analyzed) bool {
+	if narrower(a, b) || narrower(b, a) {
+		return true
+	}
+	shared := false
+	for k := range a.keys {
+		if b.keys[k] {
+			shared = true
+			break
+		}
+	}
+	return shared && !contradicts(a.terms, b.keys)
+}
+
+// contradicts reports whether any of the terms is negated by a term in keys
+func contradicts(terms []query.Node, keys map[string]bool) bool {
+	for _, t := range terms {
+		if not, ok := t.(query.Not); ok {
+			if keys[key(not.X)] {
+				return true
+			}
+		} else if keys[key(query.Not{X: t})] {
+			return true
+		}
+	}
+	return false
+}
+
+// isSubset reports whether every entry of a is in b
+func isSubset(a, b []string) bool {
+	in := make(map[string]bool, len(b))
+	for _, s := range b {
+		in[s] = true
+	}
+	for _, s := range a {
+		if !in[s] {
+			return false
+		}
+	}
+	return true
+}
+
+// linter collects findings, leaving out those the filters suppress
+type linter struct {
+	report *Report
+}
+
+func (l *linter) add(rule Rule, a, related *analyzed, format string, args ...interface{}) {
+	if ignores(a.filter, rule) || (related != nil && ignores(related.filter, rule)) {
+		return
+	}
+	finding := Finding{
+		Rule:    rule,
+		Filter:  a.index + 1,
+		Name:    a.filter.Name,
+		Message: fmt.Sprintf(format, args...),
+	}
+	if related != nil {
+		finding.Related = related.index + 1
+	}
+	l.report.Findings = append(l.report.Findings, finding)
+}
+
+// ignores reports whether the filter suppresses the rule
+func ignores(f *filter.Filter, rule Rule) bool {
+	for _, r := range f.LintIgnore {
+		if Rule(r) == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// checkUnsatisfiable reports conditions that require a term together with
+// its negation, or sizes that exclude each other
+func (l *linter) checkUnsatisfiable(a *analyzed) {
+	for _, t := range a.terms {
+		if not, ok := t.(query.Not); ok && a.keys[key(not.X)] {
+			l.add(RuleUnsatisfiable, a, nil, "requires both %s and %s, so it can never match", not.X, t)
+			return
+		}
+	}
+
+	var larger, smaller *int64
+	for _, t := range a.terms {
+		w, ok := t.(query.Word)
+		if !ok {
+			continue
+		}
+		size, err := query.ParseSize(w.Value)
+		if err != nil {
+			continue
+		}
+		switch w.Op {
+		case string(filter.Larger), "size":
+			if larger == nil || size > *larger {
+				larger = &size
+			}
+		case string(filter.Smaller):
+			if smaller == nil || size < *smaller {
+				smaller = &size
+			}
+		}
+	}
+	if larger != nil && smaller != nil && *smaller <= *larger+1 {
+		l.add(RuleUnsatisfiable, a, nil, "requires a size larger than %s and smaller than %s, so it can never match",
+			query.FormatSize(*larger), query.FormatSize(*smaller))
+	}
+}
+
+// checkPair compares a filter with an earlier one
+func (l *linter) checkPair(earlier, a *analyzed) {
+	if narrower(a, earlier) && narrower(earlier, a) && strings.Join(a.actions, ",") == strings.Join(earlier.actions, ",") {
+		l.add(RuleDuplicate, a, earlier, "has the same conditions and actions as %s", describe(earlier))
+		return
+	}
+
+	if !overlap(a, earlier) {
+		return
+	}
+	if conflicts := conflictingActions(earlier.filter, a.filter); len(conflicts) > 0 {
+		l.add(RuleConflictingActions, a, earlier, "can match the same messages as %s but %s", describe(earlier), strings.Join(conflicts, "; "))
+	}
+
+	// Either filter may be the redundant one, whichever is narrower
+	for _, pair := range [][2]*analyzed{{a, earlier}, {earlier, a}} {
+		narrow, broad := pair[0], pair[1]
+		if len(narrow.actions) > 0 && narrower(narrow, broad) && isSubset(narrow.actions, broad.actions) {
+			l.add(RuleRedundant, narrow, broad, "only matches messages that %s already matches and handles the same way", describe(broad))
+			return
+		}
+	}
+}
+
+// conflictingActions describes the actions of a and b that contradict each
+// other
+func conflictingActions(a, b *filter.Filter) []string {
+	var conflicts []string
+	if (a.MarkImportant && b.NeverImportant) || (a.NeverImportant && b.MarkImportant) {
+		conflicts = append(conflicts, "one marks them important and the other never does")
+	}
+	if a.Category != "" && b.Category != "" && a.Category != b.Category {
+		conflicts = append(conflicts, fmt.Sprintf("they file them under both %s and %s", a.Category, b.Category))
+	}
+	if keeps := func(f *filter.Filter) bool {
+		return len(f.Labels) > 0 || f.Star || f.MarkImportant || f.ForwardTo != ""
+	}; (a.Trash && keeps(b)) || (b.Trash && keeps(a)) {
+		conflicts = append(conflicts, "one deletes them while the other labels, stars or forwards them")
+	}
+	return conflicts
+}
+
+// describe identifies a filter in messages
+func describe(a *analyzed) string {
+	name := a.filter.Name
+	if name == "" && a.filter.Source != nil {
+		name = "archive unless directed"
+	}
+	if name == "" {
+		return fmt.Sprintf("filter %d", a.index+1)
+	}
+	return fmt.Sprintf("filter %d (%s)", a.index+1, name)
+}
+
+// WriteText writes the findings one per line
+func (r *Report) WriteText(w io.Writer) error {
+	var b strings.Builder
+	for _, f := range r.Findings {
+		name := f.Name
+		if name == "" {
+			name = "(unnamed)"
+		}
+		fmt.Fprintf(&b, "filter %d %s: %s [%s]\n", f.Filter, name, f.Message, f.Rule)
+	}
+	fmt.Fprintf(&b, "%d findings\n", len(r.Findings))
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteJSON writes the report as indented JSON
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
@@ -0,0 +1,116 @@
+package lint
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/brendanryan/gmail-brita/internal/filter"
+	"github.com/brendanryan/gmail-brita/internal/query"
+)
+
+func rules(r *Report) string {
+	var got []string
+	for _, f := range r.Findings {
+		got = append(got, string(f.Rule))
+	}
+	return strings.Join(got, ",")
+}
+
+func TestRun(t *testing.T) {
+	set := filter.NewFilterSet([]string{"me@example.com"})
+	filter.NewBuilder(set).Name("Robots").
+		Has([]string{"list:robots@bigco.com"}).
+		Label("robots")
+	filter.NewBuilder(set).Name("Robots again").
+		Has([]string{"list:robots@bigco.com"}).
+		Label("robots")
+	filter.NewBuilder(set).Name("Robot alerts").
+		Has([]string{"list:robots@bigco.com", "subject:alert"}).
+		Label("robots")
+	filter.NewBuilder(set).Name("Robot spam").
+		Has([]string{"list:robots@bigco.com", "subject:offer"}).
+		Trash()
+	filter.NewBuilder(set).Name("Nobody").
+		Has([]string{"from:a@example.com", "-from:a@example.com"}).
+		Label("never")
+	filter.NewBuilder(set).Name("Sizes").
+		Has([]string{"larger:5M"}).
+		Smaller(query.Megabyte).
+		Label("never")
+
+	report, err := Run(set)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	// Robot spam conflicts with each of the three filters labelling robots
+	want := "duplicate,redundant,redundant,conflicting-actions,conflicting-actions,conflicting-actions,unsatisfiable,unsatisfiable"
+	if got := rules(report); got != want {
+		t.Fatalf("rules = %s, want %s", got, want)
+	}
+
+	if f := report.Findings[0]; f.Filter != 2 || f.Related != 1 {
+		t.Errorf("duplicate finding = %+v", f)
+	}
+	if f := report.Findings[3]; f.Filter != 4 || !strings.Contains(f.Message, "deletes") {
+		t.Errorf("conflicting-actions finding = %+v", f)
+	}
+	if f := report.Findings[6]; f.Filter != 5 || !strings.Contains(f.Message, "-from:a@example.com") {
+		t.Errorf("unsatisfiable finding = %+v", f)
+	}
+
+	var out bytes.Buffer
+	if err := report.WriteText(&out); err != nil {
+		t.Fatalf("WriteText() error = %v", err)
+	}
+	for _, want := range []string{
+		"filter 2 Robots again: has the same conditions and actions as filter 1 (Robots) [duplicate]",
+		"8 findings\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("WriteText() output missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestRunArchiveUnlessDirected(t *testing.T) {
+	set := filter.NewFilterSet([]string{"me@example.com"})
+	filter.NewBuilder(set).Name("Robots").
+		Has([]string{"list:robots@bigco.com"}).
+		Label("robots").
+		ArchiveUnlessDirected()
+	filter.NewBuilder(set).Name("Robot builds").
+		Has([]string{"list:robots@bigco.com", "subject:build", "-(to:me@example.com OR cc:me@example.com)"}).
+		Archive()
+
+	report, err := Run(set)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if len(report.Findings) != 1 {
+		t.Fatalf("Findings = %+v, want one", report.Findings)
+	}
+	f := report.Findings[0]
+	if f.Rule != RuleRedundant || f.Filter != 3 || !strings.Contains(f.Message, "Robots (archive unless directed)") {
+		t.Errorf("finding = %+v", f)
+	}
+}
+
+func TestRunLintIgnore(t *testing.T) {
+	set := filter.NewFilterSet([]string{"me@example.com"})
+	filter.NewBuilder(set).Name("Robots").
+		Has([]string{"list:robots@bigco.com"}).
+		Label("robots")
+	filter.NewBuilder(set).Name("Robots again").
+		LintIgnore(string(RuleDuplicate)).
+		Has([]string{"list:robots@bigco.com"}).
+		Label("robots")
+
+	report, err := Run(set)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if !report.Empty() {
+		t.Errorf("Findings = %+v, want none", report.Findings)
+	}
+}
@@ -0,0 +1,37 @@
+// Package lintrule names the lint rules, so that packages such as config
+// can check rule names without depending on the lint analysis itself.
+package lintrule
+
+// Rule identifies a lint check. Rules can be suppressed for a filter by
+// listing them in its lint_ignore key.
+type Rule string
+
+// Lint rules
+const (
+	// Duplicate reports a filter with the same conditions and actions as an
+	// earlier one
+	Duplicate Rule = "duplicate"
+	// ConflictingActions reports filters that can match the same message
+	// but whose actions contradict each other
+	ConflictingActions Rule = "conflicting-actions"
+	// Unsatisfiable reports conditions that no message can match, such as
+	// from:a -from:a
+	Unsatisfiable Rule = "unsatisfiable"
+	// Redundant reports a filter whose messages are all matched by a
+	// broader filter that already performs its actions, including the
+	// companions added by archive_unless_directed
+	Redundant Rule = "redundant"
+)
+
+// All lists every lint rule
+var All = []Rule{Duplicate, ConflictingActions, Unsatisfiable, Redundant}
+
+// Known reports whether name is a lint rule
+func Known(name string) bool {
+	for _, r := range All {
+		if string(r) == name {
+			return true
+		}
+	}
+	return false
+}
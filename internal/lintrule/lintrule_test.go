@@ -0,0 +1,14 @@
+package lintrule
+
+import "testing"
+
+func TestKnown(t *testing.T) {
+	for _, r := range All {
+		if !Known(string(r)) {
+			t.Errorf("Known(%q) = false, want true", r)
+		}
+	}
+	if Known("duplicates") {
+		t.Error(`Known("duplicates") = true, want false`)
+	}
+}
@@ -0,0 +1,142 @@
+package query
+
+import (
+	"strings"
+)
+
+// Node is a node in a parsed Gmail search query
+type Node interface {
+	// String renders the node in canonical Gmail search syntax
+	String() string
+	node()
+}
+
+// Word is a single search term, optionally qualified by an operator such as
+// "from" or "larger"
+type Word struct {
+	// Op is the operator without its trailing colon, empty for plain words
+	Op string
+	// Value is the unquoted search value
+	Value string
+	// Phrase reports whether the value was written as a quoted phrase
+	Phrase bool
+}
+
+// And matches when every child matches
+type And []Node
+
+// Or matches when at least one child matches
+type Or []Node
+
+// Not matches when its child does not match
+type Not struct {
+	X Node
+}
+
+func (Word) node() {}
+func (And) node()  {}
+func (Or) node()   {}
+func (Not) node()  {}
+
+// String renders the word, quoting the value when required
+func (w Word) String() string {
+	value := w.Value
+	if w.Phrase || needsQuotes(value) {
+		value = `"` + value + `"`
+	}
+	if w.Op == "" {
+		return value
+	}
+	return w.Op + ":" + value
+}
+
+// String joins the children with implicit AND, grouping OR children
+func (a And) String() string {
+	parts := make([]string, 0, len(a))
+	for _, n := range a {
+		s := n.String()
+		if _, ok := n.(Or); ok && len(a) > 1 {
+			s = "(" + s + ")"
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, " ")
+}
+
+// String joins the children with OR, grouping AND children
+func (o Or) String() string {
+	parts := make([]string, 0, len(o))
+	for _, n := range o {
+		s := n.String()
+		if _, ok := n.(And); ok && len(o) > 1 {
+			s = "(" + s + ")"
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, " OR ")
+}
+
+// String negates the child, grouping it when it is compound
+func (n Not) String() string {
+	switch n.X.(type) {
+	case And, Or:
+		return "-(" + n.X.String() + ")"
+	default:
+		return "-" + n.X.String()
+	}
+}
+
+// needsQuotes reports whether a value has to be quoted to be read back as a
+// single term
+func needsQuotes(value string) bool {
+	if value == "" || value == "OR" || value == "AND" || strings.HasPrefix(value, "-") {
+		return true
+	}
+	return strings.ContainsAny(value, " \t\r\n(){}\"")
+}
+
+// NewAnd combines nodes so that all of them must match, flattening nested
+// ANDs and dropping nil nodes. A single node is returned unchanged and no
+// nodes yield nil.
+func NewAnd(nodes ...Node) Node {
+	flat := make(And, 0, len(nodes))
+	for _, n := range nodes {
+		switch v := n.(type) {
+		case nil:
+		case And:
+			flat = append(flat, v...)
+		default:
+			flat = append(flat, n)
+		}
+	}
+	switch len(flat) {
+	case 0:
+		return nil
+	case 1:
+		return flat[0]
+	}
+	return flat
+}
+
+// NewOr combines nodes so that any of them may match, flattening nested ORs
+// and dropping nil nodes. A single node is returned unchanged and no nodes
+// yield nil.
+func NewOr(nodes ...Node) Node {
+	flat := make(Or, 0, len(nodes))
+	for _, n := range nodes {
+		switch v := n.(type) {
+		case nil:
+		case Or:
+			flat = append(flat, v...)
+		default:
+			flat = append(flat, n)
+		}
+	}
+	switch len(flat) {
+	case 0:
+		return nil
+	case 1:
+		return flat[0]
+	}
+	return flat
+}
@@ -0,0 +1,55 @@
+package query
+
+// operators lists the search operators Gmail understands
+var operators = map[string]bool{
+	"after":       true,
+	"bcc":         true,
+	"before":      true,
+	"category":    true,
+	"cc":          true,
+	"deliveredto": true,
+	"filename":    true,
+	"from":        true,
+	"has":         true,
+	"in":          true,
+	"is":          true,
+	"label":       true,
+	"larger":      true,
+	"list":        true,
+	"newer":       true,
+	"newer_than":  true,
+	"older":       true,
+	"older_than":  true,
+	"rfc822msgid": true,
+	"size":        true,
+	"smaller":     true,
+	"subject":     true,
+	"to":          true,
+}
+
+// KnownOperator reports whether op is a Gmail search operator
+func KnownOperator(op string) bool {
+	return operators[op]
+}
+
+// Walk calls fn for every word in n in query order
+func Walk(n Node, fn func(w Word, negated bool)) {
+	walk(n, false, fn)
+}
+
+func walk(n Node, negated bool, fn func(w Word, negated bool)) {
+	switch v := n.(type) {
+	case Word:
+		fn(v, negated)
+	case And:
+		for _, c := range v {
+			walk(c, negated, fn)
+		}
+	case Or:
+		for _, c := range v {
+			walk(c, negated, fn)
+		}
+	case Not:
+		walk(v.X, !negated, fn)
+	}
+}
@@ -0,0 +1,302 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// SyntaxError reports a malformed query and the byte offset at which the
+// problem was found
+type SyntaxError struct {
+	Offset int
+	Msg    string
+}
+
+// Error implements the error interface
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("query: position %d: %s", e.Offset, e.Msg)
+}
+
+// Parse parses a Gmail search query. Terms separated by whitespace or AND
+// must all match, OR binds more tightly than AND, {a b} is shorthand for
+// a OR b, a leading - negates a term or group, and an operator may be
+// applied to a group as in subject:(dinner movie). An empty query yields
+// a nil node.
+func Parse(s string) (Node, error) {
+	p := &parser{lex: lexer{src: s}}
+	p.next()
+	n, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %s", p.tok)
+	}
+	return n, nil
+}
+
+type parser struct {
+	lex lexer
+	tok token
+}
+
+func (p *parser) next() {
+	p.tok = p.lex.next()
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return &SyntaxError{Offset: p.tok.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// parseAnd parses a sequence of OR expressions up to the end of the
+// enclosing group
+func (p *parser) parseAnd() (Node, error) {
+	var nodes []Node
+	for {
+		switch p.tok.kind {
+		case tokEOF, tokRParen, tokRBrace:
+			return NewAnd(nodes...), nil
+		case tokAnd:
+			p.next()
+			continue
+		case tokError:
+			return nil, p.errorf("%s", p.tok.text)
+		}
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+	}
+}
+
+// parseOr parses unary expressions joined by OR
+func (p *parser) parseOr() (Node, error) {
+	n, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	nodes := []Node{n}
+	for p.tok.kind == tokOr {
+		p.next()
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+	}
+	return NewOr(nodes...), nil
+}
+
+// parseUnary parses an optionally negated primary expression
+func (p *parser) parseUnary() (Node, error) {
+	if p.tok.kind == tokMinus {
+		p.next()
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return Not{X: n}, nil
+	}
+	return p.parsePrimary("")
+}
+
+// parsePrimary parses a word or a group, applying op to any words without
+// an operator of their own
+func (p *parser) parsePrimary(op string) (Node, error) {
+	switch p.tok.kind {
+	case tokWord:
+		w := Word{Op: p.tok.op, Value: p.tok.text, Phrase: p.tok.phrase}
+		p.next()
+		if w.Op == "" {
+			w.Op = op
+		}
+		return w, nil
+	case tokOperator:
+		inner, text := p.tok.op, p.tok.text
+		p.next()
+		if p.tok.kind != tokLParen && p.tok.kind != tokLBrace {
+			// A trailing colon without a value is an ordinary word
+			return Word{Op: op, Value: text}, nil
+		}
+		return p.parsePrimary(inner)
+	case tokLParen:
+		p.next()
+		n, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokRParen {
+			return nil, p.errorf("missing closing parenthesis")
+		}
+		p.next()
+		if n == nil {
+			return nil, p.errorf("empty group")
+		}
+		return WithOperator(n, op), nil
+	case tokLBrace:
+		p.next()
+		var nodes []Node
+		for p.tok.kind != tokRBrace {
+			if p.tok.kind == tokEOF {
+				return nil, p.errorf("missing closing brace")
+			}
+			if p.tok.kind == tokOr {
+				p.next()
+				continue
+			}
+			n, err := p.parseUnary()
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, n)
+		}
+		p.next()
+		if len(nodes) == 0 {
+			return nil, p.errorf("empty group")
+		}
+		return WithOperator(NewOr(nodes...), op), nil
+	case tokError:
+		return nil, p.errorf("%s", p.tok.text)
+	default:
+		return nil, p.errorf("unexpected %s", p.tok)
+	}
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokError
+	tokWord
+	tokOperator
+	tokOr
+	tokAnd
+	tokMinus
+	tokLParen
+	tokRParen
+	tokLBrace
+	tokRBrace
+)
+
+type token struct {
+	kind   tokenKind
+	pos    int
+	op     string
+	text   string
+	phrase bool
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of query"
+	case tokOperator:
+		return fmt.Sprintf("operator %s:", t.op)
+	case tokWord:
+		return fmt.Sprintf("%q", Word{Op: t.op, Value: t.text, Phrase: t.phrase}.String())
+	default:
+		return fmt.Sprintf("%q", t.text)
+	}
+}
+
+type lexer struct {
+	src string
+	pos int
+}
+
+func (l *lexer) next() token {
+	for l.pos < len(l.src) && isSpace(l.src[l.pos]) {
+		l.pos++
+	}
+	start := l.pos
+	if l.pos >= len(l.src) {
+		return token{kind: tokEOF, pos: start}
+	}
+
+	switch c := l.src[l.pos]; c {
+	case '(':
+		l.pos++
+		return token{kind: tokLParen, pos: start, text: "("}
+	case ')':
+		l.pos++
+		return token{kind: tokRParen, pos: start, text: ")"}
+	case '{':
+		l.pos++
+		return token{kind: tokLBrace, pos: start, text: "{"}
+	case '}':
+		l.pos++
+		return token{kind: tokRBrace, pos: start, text: "}"}
+	case '-':
+		if l.pos+1 < len(l.src) && !isSpace(l.src[l.pos+1]) {
+			l.pos++
+			return token{kind: tokMinus, pos: start, text: "-"}
+		}
+	case '"':
+		text, ok := l.phrase()
+		if !ok {
+			return token{kind: tokError, pos: start, text: "unterminated quoted phrase"}
+		}
+		return token{kind: tokWord, pos: start, text: text, phrase: true}
+	}
+
+	end := l.pos
+	for end < len(l.src) && !isSpace(l.src[end]) && !strings.ContainsRune(`(){}"`, rune(l.src[end])) {
+		end++
+	}
+	text := l.src[l.pos:end]
+	l.pos = end
+
+	switch text {
+	case "OR":
+		return token{kind: tokOr, pos: start, text: text}
+	case "AND":
+		return token{kind: tokAnd, pos: start, text: text}
+	}
+
+	op, value, ok := splitOperator(text)
+	if !ok {
+		return token{kind: tokWord, pos: start, text: text}
+	}
+	if value != "" {
+		return token{kind: tokWord, pos: start, op: op, text: value}
+	}
+	if l.pos < len(l.src) && l.src[l.pos] == '"' {
+		phrase, ok := l.phrase()
+		if !ok {
+			return token{kind: tokError, pos: start, text: "unterminated quoted phrase"}
+		}
+		return token{kind: tokWord, pos: start, op: op, text: phrase, phrase: true}
+	}
+	return token{kind: tokOperator, pos: start, op: op, text: text}
+}
+
+// phrase consumes a quoted phrase starting at the current position
+func (l *lexer) phrase() (string, bool) {
+	end := strings.IndexByte(l.src[l.pos+1:], '"')
+	if end < 0 {
+		return "", false
+	}
+	text := l.src[l.pos+1 : l.pos+1+end]
+	l.pos += end + 2
+	return text, true
+}
+
+// splitOperator splits "op:value" when op looks like a search operator
+func splitOperator(text string) (op, value string, ok bool) {
+	i := strings.IndexByte(text, ':')
+	if i <= 0 {
+		return "", "", false
+	}
+	for _, r := range text[:i] {
+		if r != '_' && !unicode.IsLetter(r) {
+			return "", "", false
+		}
+	}
+	return strings.ToLower(text[:i]), text[i+1:], true
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
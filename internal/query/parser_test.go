@@ -0,0 +1,285 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  Node
+	}{
+		{
+			name:  "empty query",
+			query: "   ",
+			want:  nil,
+		},
+		{
+			name:  "operator",
+			query: "from:someone@example.com",
+			want:  Word{Op: "from", Value: "someone@example.com"},
+		},
+		{
+			name:  "implicit and",
+			query: "list:robots@bigco.com subject:Important",
+			want: And{
+				Word{Op: "list", Value: "robots@bigco.com"},
+				Word{Op: "subject", Value: "Important"},
+			},
+		},
+		{
+			name:  "explicit and",
+			query: "a AND b",
+			want:  And{Word{Value: "a"}, Word{Value: "b"}},
+		},
+		{
+			name:  "or binds tighter than and",
+			query: "a b OR c",
+			want:  And{Word{Value: "a"}, Or{Word{Value: "b"}, Word{Value: "c"}}},
+		},
+		{
+			name:  "braces",
+			query: "{from:a from:b}",
+			want:  Or{Word{Op: "from", Value: "a"}, Word{Op: "from", Value: "b"}},
+		},
+		{
+			name:  "negation",
+			query: "-subject:Chunder",
+			want:  Not{X: Word{Op: "subject", Value: "Chunder"}},
+		},
+		{
+			name:  "negated group",
+			query: "-(a OR b)",
+			want:  Not{X: Or{Word{Value: "a"}, Word{Value: "b"}}},
+		},
+		{
+			name:  "quoted phrase",
+			query: `subject:"Monthly Statement" "hello world"`,
+			want: And{
+				Word{Op: "subject", Value: "Monthly Statement", Phrase: true},
+				Word{Value: "hello world", Phrase: true},
+			},
+		},
+		{
+			name:  "operator applied to group",
+			query: "subject:(dinner -movie)",
+			want: And{
+				Word{Op: "subject", Value: "dinner"},
+				Not{X: Word{Op: "subject", Value: "movie"}},
+			},
+		},
+		{
+			name:  "operator applied to braces",
+			query: "from:{a b}",
+			want:  Or{Word{Op: "from", Value: "a"}, Word{Op: "from", Value: "b"}},
+		},
+		{
+			name:  "size and age operators",
+			query: "larger:10M older_than:2d",
+			want: And{
+				Word{Op: "larger", Value: "10M"},
+				Word{Op: "older_than", Value: "2d"},
+			},
+		},
+		{
+			name:  "operator case is normalised",
+			query: "From:a",
+			want:  Word{Op: "from", Value: "a"},
+		},
+		{
+			name:  "inner operator wins",
+			query: "subject:(a from:b)",
+			want: And{
+				Word{Op: "subject", Value: "a"},
+				Word{Op: "from", Value: "b"},
+			},
+		},
+		{
+			name:  "trailing colon is a word",
+			query: "Re: hello",
+			want:  And{Word{Value: "Re:"}, Word{Value: "hello"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []string{
+		"(a b",
+		"a b)",
+		"{a b",
+		`subject:"unterminated`,
+		"a OR",
+		"OR a",
+		"()",
+	}
+
+	for _, q := range tests {
+		t.Run(q, func(t *testing.T) {
+			if _, err := Parse(q); err == nil {
+				t.Errorf("Parse(%q) expected error", q)
+			}
+		})
+	}
+}
+
+func TestStringRoundTrip(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"from:a", "from:a"},
+		{"a AND b", "a b"},
+		{"a b OR c", "a (b OR c)"},
+		{"(a b) OR c", "(a b) OR c"},
+		{"{a b} c", "(a OR b) c"},
+		{"-(a OR b)", "-(a OR b)"},
+		{`subject:"Monthly Statement"`, `subject:"Monthly Statement"`},
+		{"subject:(dinner movie)", "subject:dinner subject:movie"},
+		{"list:(a OR b) -{c d}", "(list:a OR list:b) -(c OR d)"},
+		{`"OR"`, `"OR"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			n, err := Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			got := n.String()
+			if got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+
+			again, err := Parse(got)
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", got, err)
+			}
+			if !reflect.DeepEqual(again, n) {
+				t.Errorf("round trip of %q = %#v, want %#v", got, again, n)
+			}
+		})
+	}
+}
+
+func TestNewAndOr(t *testing.T) {
+	a, b, c := Word{Value: "a"}, Word{Value: "b"}, Word{Value: "c"}
+
+	if got := NewAnd(); got != nil {
+		t.Errorf("NewAnd() = %#v, want nil", got)
+	}
+	if got := NewAnd(nil, a); !reflect.DeepEqual(got, a) {
+		t.Errorf("NewAnd(nil, a) = %#v, want a", got)
+	}
+	if got := NewAnd(And{a, b}, c); !reflect.DeepEqual(got, And{a, b, c}) {
+		t.Errorf("NewAnd() did not flatten: %#v", got)
+	}
+	if got := NewOr(a, Or{b, c}); !reflect.DeepEqual(got, Or{a, b, c}) {
+		t.Errorf("NewOr() did not flatten: %#v", got)
+	}
+}
+
+func TestNegate(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"a", "-a"},
+		{"-a", "a"},
+		{"a b", "-a OR -b"},
+		{"a OR b", "-a -b"},
+		{`list:robots subject:"Important stuff"`, `-list:robots OR -subject:"Important stuff"`},
+		{"a (b OR -c)", "-a OR (-b c)"},
+		{"-(a b) c", "(a b) OR -c"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			n, err := Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if got := Negate(n).String(); got != tt.want {
+				t.Errorf("Negate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if Negate(nil) != nil {
+		t.Error("Negate(nil) should be nil")
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		a, b string
+	}{
+		{"a b", "b a"},
+		{"a a b", "b a"},
+		{"a (b c)", "c b a"},
+		{"{a b} c", "c {b a}"},
+		{"--a", "a"},
+		{"-(b OR a)", "-(a OR b)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a, func(t *testing.T) {
+			a, err := Parse(tt.a)
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.a, err)
+			}
+			b, err := Parse(tt.b)
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.b, err)
+			}
+			if got, want := Normalize(a).String(), Normalize(b).String(); got != want {
+				t.Errorf("Normalize(%q) = %q, Normalize(%q) = %q", tt.a, got, tt.b, want)
+			}
+		})
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{in: "10M", want: 10 * Megabyte},
+		{in: "10mb", want: 10 * Megabyte},
+		{in: "500K", want: 500 * Kilobyte},
+		{in: "2048", want: 2048},
+		{in: "ten", wantErr: true},
+		{in: "-1M", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseSize(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseSize() = %d, want %d", got, tt.want)
+			}
+			if !tt.wantErr {
+				if again, _ := ParseSize(FormatSize(got)); again != got {
+					t.Errorf("FormatSize(%d) = %q does not round trip", got, FormatSize(got))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Size units understood by the larger, smaller and size operators
+const (
+	Kilobyte int64 = 1024
+	Megabyte int64 = 1024 * Kilobyte
+)
+
+// ParseSize parses a message size such as "10M", "500K" or "2048" into a
+// number of bytes
+func ParseSize(s string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	value = strings.TrimSuffix(value, "B")
+
+	unit := int64(1)
+	switch {
+	case strings.HasSuffix(value, "M"):
+		unit, value = Megabyte, strings.TrimSuffix(value, "M")
+	case strings.HasSuffix(value, "K"):
+		unit, value = Kilobyte, strings.TrimSuffix(value, "K")
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * unit, nil
+}
+
+// FormatSize formats a number of bytes using the largest unit that
+// represents it exactly
+func FormatSize(bytes int64) string {
+	switch {
+	case bytes != 0 && bytes%Megabyte == 0:
+		return fmt.Sprintf("%dM", bytes/Megabyte)
+	case bytes != 0 && bytes%Kilobyte == 0:
+		return fmt.Sprintf("%dK", bytes/Kilobyte)
+	default:
+		return strconv.FormatInt(bytes, 10)
+	}
+}
@@ -0,0 +1,121 @@
+package query
+
+import (
+	"sort"
+)
+
+// WithOperator applies op to every word in n that has no operator of its
+// own, as Gmail does for subject:(dinner movie)
+func WithOperator(n Node, op string) Node {
+	if op == "" {
+		return n
+	}
+	switch v := n.(type) {
+	case Word:
+		if v.Op == "" {
+			v.Op = op
+		}
+		return v
+	case And:
+		out := make(And, len(v))
+		for i, c := range v {
+			out[i] = WithOperator(c, op)
+		}
+		return out
+	case Or:
+		out := make(Or, len(v))
+		for i, c := range v {
+			out[i] = WithOperator(c, op)
+		}
+		return out
+	case Not:
+		return Not{X: WithOperator(v.X, op)}
+	default:
+		return n
+	}
+}
+
+// Negate returns the logical complement of n with negations pushed down to
+// individual words using De Morgan's laws. Negating a nil node yields nil.
+func Negate(n Node) Node {
+	switch v := n.(type) {
+	case Word:
+		return Not{X: v}
+	case Not:
+		return v.X
+	case And:
+		negated := make([]Node, 0, len(v))
+		for _, c := range v {
+			negated = append(negated, Negate(c))
+		}
+		return NewOr(negated...)
+	case Or:
+		negated := make([]Node, 0, len(v))
+		for _, c := range v {
+			negated = append(negated, Negate(c))
+		}
+		return NewAnd(negated...)
+	default:
+		return nil
+	}
+}
+
+// Normalize returns an equivalent node in a canonical form, so that queries
+// differing only in the order or repetition of terms print identically.
+// Groups are flattened, double negations removed, and the children of each
+// AND and OR sorted and deduplicated.
+func Normalize(n Node) Node {
+	switch v := n.(type) {
+	case Not:
+		x := Normalize(v.X)
+		if inner, ok := x.(Not); ok {
+			return inner.X
+		}
+		return Not{X: x}
+	case And:
+		var children []Node
+		for _, c := range v {
+			c = Normalize(c)
+			if and, ok := c.(And); ok {
+				children = append(children, and...)
+			} else if c != nil {
+				children = append(children, c)
+			}
+		}
+		return NewAnd(sortUnique(children)...)
+	case Or:
+		var children []Node
+		for _, c := range v {
+			c = Normalize(c)
+			if or, ok := c.(Or); ok {
+				children = append(children, or...)
+			} else if c != nil {
+				children = append(children, c)
+			}
+		}
+		return NewOr(sortUnique(children)...)
+	default:
+		return n
+	}
+}
+
+// sortUnique returns the nodes sorted by their printed form with
+// duplicates removed
+func sortUnique(nodes []Node) []Node {
+	byString := make(map[string]Node, len(nodes))
+	keys := make([]string, 0, len(nodes))
+	for _, c := range nodes {
+		key := c.String()
+		if _, seen := byString[key]; !seen {
+			keys = append(keys, key)
+			byString[key] = c
+		}
+	}
+	sort.Strings(keys)
+
+	out := make([]Node, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, byString[k])
+	}
+	return out
+}
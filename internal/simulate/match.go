@@ -0,0 +1,195 @@
+package simulate
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/brendanryan/gmail-brita/internal/query"
+)
+
+// headerOperators maps search operators to the headers they search
+var headerOperators = map[string][]string{
+	"from":        {"From", "Sender"},
+	"to":          {"To", "Cc"},
+	"cc":          {"Cc"},
+	"bcc":         {"Bcc"},
+	"deliveredto": {"Delivered-To", "X-Original-To"},
+	"list":        {"List-Id", "List-Post"},
+	"rfc822msgid": {"Message-Id"},
+}
+
+// Unsupported reports an error for every search term in n that cannot be
+// evaluated locally, such as is:unread, which depends on mailbox state
+func Unsupported(n query.Node) []error {
+	var errs []error
+	query.Walk(n, func(w query.Word, _ bool) {
+		if err := checkWord(w); err != nil {
+			errs = append(errs, err)
+		}
+	})
+	return errs
+}
+
+func checkWord(w query.Word) error {
+	switch w.Op {
+	case "", "subject", "filename":
+		return nil
+	case "has":
+		if strings.EqualFold(w.Value, "attachment") {
+			return nil
+		}
+	case "larger", "smaller", "size":
+		if _, err := query.ParseSize(w.Value); err != nil {
+			return fmt.Errorf("%s: %w", w, err)
+		}
+		return nil
+	case "after", "before", "older", "newer":
+		if _, err := parseDate(w.Value); err != nil {
+			return fmt.Errorf("%s: %w", w, err)
+		}
+		return nil
+	default:
+		if _, ok := headerOperators[w.Op]; ok {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s cannot be evaluated locally", w)
+}
+
+// Match reports whether the message matches the query. A nil query
+// matches every message. Terms rejected by Check never match.
+func Match(n query.Node, m *Message) bool {
+	switch v := n.(type) {
+	case nil:
+		return true
+	case query.Word:
+		return matchWord(v, m)
+	case query.And:
+		for _, c := range v {
+			if !Match(c, m) {
+				return false
+			}
+		}
+		return true
+	case query.Or:
+		for _, c := range v {
+			if Match(c, m) {
+				return true
+			}
+		}
+		return false
+	case query.Not:
+		return !Match(v.X, m)
+	default:
+		return false
+	}
+}
+
+// matchWord evaluates a single search term against the message
+func matchWord(w query.Word, m *Message) bool {
+	switch w.Op {
+	case "":
+		return containsWords(m.text(), w.Value)
+	case "subject":
+		return containsWords(m.Subject(), w.Value)
+	case "filename":
+		for _, name := range m.Attachments {
+			if containsWords(name, w.Value) {
+				return true
+			}
+		}
+		return false
+	case "has":
+		return strings.EqualFold(w.Value, "attachment") && len(m.Attachments) > 0
+	case "larger", "size":
+		size, err := query.ParseSize(w.Value)
+		return err == nil && m.Size > size
+	case "smaller":
+		size, err := query.ParseSize(w.Value)
+		return err == nil && m.Size < size
+	case "after", "newer":
+		return compareDate(m, w.Value, func(sent, date time.Time) bool { return !sent.Before(date) })
+	case "before", "older":
+		return compareDate(m, w.Value, func(sent, date time.Time) bool { return sent.Before(date) })
+	}
+
+	for _, name := range headerOperators[w.Op] {
+		for _, value := range m.Header[name] {
+			if containsWords(decodeHeader(value), w.Value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// text returns the parts of the message searched by plain words
+func (m *Message) text() string {
+	parts := []string{m.Subject(), m.Body}
+	for _, name := range []string{"From", "To", "Cc"} {
+		parts = append(parts, decodeHeader(m.Header.Get(name)))
+	}
+	parts = append(parts, m.Attachments...)
+	return strings.Join(parts, "\n")
+}
+
+// compareDate compares the message's Date header with a search date
+func compareDate(m *Message, value string, cmp func(sent, date time.Time) bool) bool {
+	date, err := parseDate(value)
+	if err != nil {
+		return false
+	}
+	sent, err := m.Header.Date()
+	if err != nil {
+		return false
+	}
+	return cmp(sent, date)
+}
+
+// parseDate parses a search date, written as 2004/04/16 or as seconds
+// since the epoch
+func parseDate(value string) (time.Time, error) {
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	for _, layout := range []string{"2006/01/02", "2006-01-02", "01/02/2006"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", value)
+}
+
+// containsWords reports whether the words of value appear in text in order
+// and next to each other, ignoring case and punctuation, as Gmail matches
+// search terms. Values without any words are matched as substrings.
+func containsWords(text, value string) bool {
+	want := tokenize(value)
+	if len(want) == 0 {
+		return value != "" && strings.Contains(strings.ToLower(text), strings.ToLower(value))
+	}
+	have := tokenize(text)
+	for i := 0; i+len(want) <= len(have); i++ {
+		found := true
+		for j, word := range want {
+			if have[i+j] != word {
+				found = false
+				break
+			}
+		}
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenize splits text into lower case words
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
@@ -0,0 +1,305 @@
+package simulate
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Message is an email message in the form needed to evaluate filters
+type Message struct {
+	// Source identifies where the message was read from, such as a file
+	// name, for reporting
+	Source string
+
+	Header mail.Header
+	// Body is the decoded text of the message's text parts
+	Body string
+	// Attachments lists the file names of the message's attachments
+	Attachments []string
+	// Size is the size of the raw message in bytes
+	Size int64
+}
+
+// Subject returns the message's decoded subject
+func (m *Message) Subject() string {
+	return decodeHeader(m.Header.Get("Subject"))
+}
+
+// NewMessage builds a message from header fields and a plain text body.
+// Its size is that of the message written out with these headers.
+func NewMessage(headers map[string]string, body string, attachments []string) *Message {
+	m := &Message{
+		Header:      make(mail.Header, len(headers)),
+		Body:        body,
+		Attachments: attachments,
+	}
+	for name, value := range headers {
+		key := textproto.CanonicalMIMEHeaderKey(name)
+		m.Header[key] = append(m.Header[key], value)
+		m.Size += int64(len(name) + len(value) + 4)
+	}
+	m.Size += int64(len(body) + 2)
+	return m
+}
+
+// ParseMessage reads an RFC 5322 message
+func ParseMessage(r io.Reader) (*Message, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse message: %w", err)
+	}
+
+	m := &Message{
+		Header: msg.Header,
+		Size:   int64(len(data)),
+	}
+	var body strings.Builder
+	if err := readPart(msg.Header, msg.Body, &body, &m.Attachments); err != nil {
+		return nil, fmt.Errorf("failed to parse message body: %w", err)
+	}
+	m.Body = body.String()
+	return m, nil
+}
+
+// ReadMbox reads every message in an mbox file. Lines quoted as ">From "
+// are unquoted in the process.
+func ReadMbox(r io.Reader) ([]*Message, error) {
+	var (
+		messages []*Message
+		current  bytes.Buffer
+		started  bool
+	)
+	flush := func() error {
+		if !started {
+			return nil
+		}
+		m, err := ParseMessage(bytes.NewReader(current.Bytes()))
+		if err != nil {
+			return fmt.Errorf("message %d: %w", len(messages)+1, err)
+		}
+		messages = append(messages, m)
+		current.Reset()
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "From ") {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			started = true
+			continue
+		}
+		if !started {
+			return nil, fmt.Errorf("not an mbox file: missing From line")
+		}
+		if unquoted := strings.TrimLeft(line, ">"); len(unquoted) < len(line) && strings.HasPrefix(unquoted, "From ") {
+			line = line[1:]
+		}
+		current.WriteString(line)
+		current.WriteString("\r\n")
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// ReadPath reads the messages in a file or directory. A Maildir is read
+// from its cur and new folders; any other directory is searched for
+// message and mbox files, skipping hidden entries. Files in a directory
+// that cannot be read as mail, such as a mail server's index files, are
+// skipped and returned as warnings rather than failing the whole corpus.
+func ReadPath(path string) ([]*Message, []error, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !info.IsDir() {
+		messages, err := ReadFile(path)
+		return messages, nil, err
+	}
+
+	roots := []string{path}
+	if isMaildir(path) {
+		roots = []string{filepath.Join(path, "cur"), filepath.Join(path, "new")}
+	}
+
+	var (
+		messages []*Message
+		skipped  []error
+	)
+	for _, root := range roots {
+		err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if p != root && strings.HasPrefix(d.Name(), ".") {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			found, err := ReadFile(p)
+			if err != nil {
+				skipped = append(skipped, fmt.Errorf("skipping %w", err))
+				return nil
+			}
+			messages = append(messages, found...)
+			return nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return messages, skipped, nil
+}
+
+// isMaildir reports whether dir has the cur and new folders of a Maildir
+func isMaildir(dir string) bool {
+	for _, sub := range []string{"cur", "new"} {
+		info, err := os.Stat(filepath.Join(dir, sub))
+		if err != nil || !info.IsDir() {
+			return false
+		}
+	}
+	return true
+}
+
+// ReadFile reads the messages in a file holding either a single message
+// or an mbox. Each message's Source is set to the file name, followed by
+// the message's position for an mbox.
+func ReadFile(path string) ([]*Message, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.HasPrefix(data, []byte("From ")) {
+		m, err := ParseMessage(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		m.Source = path
+		return []*Message{m}, nil
+	}
+
+	messages, err := ReadMbox(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for i, m := range messages {
+		m.Source = fmt.Sprintf("%s:%d", path, i+1)
+	}
+	return messages, nil
+}
+
+// partHeader is the subset of a MIME header needed to read a part
+type partHeader interface {
+	Get(key string) string
+}
+
+// readPart appends the text of a MIME part to body and the names of any
+// attachments to attachments, descending into multipart containers
+func readPart(h partHeader, r io.Reader, body *strings.Builder, attachments *[]string) error {
+	mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", nil
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(r, params["boundary"])
+		for {
+			p, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := readPart(p.Header, p, body, attachments); err != nil {
+				return err
+			}
+		}
+	}
+
+	if name := attachmentName(h, params); name != "" {
+		*attachments = append(*attachments, name)
+		return nil
+	}
+	if !strings.HasPrefix(mediaType, "text/") {
+		return nil
+	}
+
+	data, err := io.ReadAll(decodeTransfer(h.Get("Content-Transfer-Encoding"), r))
+	if err != nil {
+		return err
+	}
+	body.Write(data)
+	body.WriteString("\n")
+	return nil
+}
+
+// attachmentName returns the file name of a part that is an attachment
+func attachmentName(h partHeader, contentParams map[string]string) string {
+	disposition, params, err := mime.ParseMediaType(h.Get("Content-Disposition"))
+	if err == nil && params["filename"] != "" {
+		return decodeHeader(params["filename"])
+	}
+	if contentParams["name"] != "" {
+		return decodeHeader(contentParams["name"])
+	}
+	if disposition == "attachment" {
+		return "attachment"
+	}
+	return ""
+}
+
+// decodeTransfer undoes a part's content transfer encoding
+func decodeTransfer(encoding string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		// The decoder skips the line breaks that wrap encoded content
+		return base64.NewDecoder(base64.StdEncoding, r)
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	default:
+		return r
+	}
+}
+
+// decodeHeader decodes RFC 2047 encoded words, returning the value
+// unchanged when it cannot be decoded
+func decodeHeader(value string) string {
+	decoded, err := new(mime.WordDecoder).DecodeHeader(value)
+	if err != nil {
+		return value
+	}
+	return decoded
+}
@@ -0,0 +1,247 @@
+// Package simulate evaluates Gmail filters against email messages locally,
+// showing what a filter set would do before it is imported.
+package simulate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/brendanryan/gmail-brita/internal/filter"
+	"github.com/brendanryan/gmail-brita/internal/query"
+)
+
+// Simulator applies a filter set to messages
+type Simulator struct {
+	filters []*filter.Filter
+	queries []query.Node
+	// skipped holds the filters that are not evaluated, by index
+	skipped map[int]Skipped
+}
+
+// Skipped is a filter left out of the simulation because its search
+// condition uses terms that cannot be evaluated without a mailbox
+type Skipped struct {
+	// Index is the filter's position in the set, starting at 1
+	Index int    `json:"index"`
+	Name  string `json:"name,omitempty"`
+	// Reasons describes each term that cannot be evaluated
+	Reasons []string `json:"reasons"`
+}
+
+func (s Skipped) String() string {
+	name := fmt.Sprintf("filter %d", s.Index)
+	if s.Name != "" {
+		name = fmt.Sprintf("filter %q", s.Name)
+	}
+	return fmt.Sprintf("%s not evaluated: %s", name, strings.Join(s.Reasons, "; "))
+}
+
+// New prepares a filter set for simulation. A filter using a search term
+// that cannot be evaluated without a mailbox, such as is:unread, is left
+// out and reported by Skipped, while the other filters are still simulated.
+func New(set *filter.Set) (*Simulator, error) {
+	s := &Simulator{
+		filters: set.Filters,
+		queries: make([]query.Node, 0, len(set.Filters)),
+		skipped: make(map[int]Skipped),
+	}
+	for i, f := range set.Filters {
+		q, err := f.Query()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filterName(f, i), err)
+		}
+		if errs := Unsupported(q); len(errs) > 0 {
+			skipped := Skipped{Index: i + 1, Name: f.Name}
+			for _, err := range errs {
+				skipped.Reasons = append(skipped.Reasons, err.Error())
+			}
+			s.skipped[i] = skipped
+		}
+		s.queries = append(s.queries, q)
+	}
+	return s, nil
+}
+
+// Skipped returns the filters that are not evaluated, in set order
+func (s *Simulator) Skipped() []Skipped {
+	var skipped []Skipped
+	for i := range s.filters {
+		if sk, ok := s.skipped[i]; ok {
+			skipped = append(skipped, sk)
+		}
+	}
+	return skipped
+}
+
+// Evaluated reports whether the filter at index, starting at 1, takes part
+// in the simulation
+func (s *Simulator) Evaluated(index int) bool {
+	_, skipped := s.skipped[index-1]
+	return !skipped
+}
+
+// Result describes the filters matching a message and their combined effect
+type Result struct {
+	Source  string        `json:"source,omitempty"`
+	Subject string        `json:"subject"`
+	Matches []FilterMatch `json:"matches"`
+	State   State         `json:"state"`
+}
+
+// FilterMatch is a filter that matched a message
+type FilterMatch struct {
+	// Index is the filter's position in the set, starting at 1
+	Index   int      `json:"index"`
+	Name    string   `json:"name,omitempty"`
+	Actions []string `json:"actions"`
+}
+
+// State is the state of a message after every matching filter has been
+// applied. Gmail applies all matching filters, so their actions combine.
+type State struct {
+	Labels         []string `json:"labels"`
+	Archived       bool     `json:"archived,omitempty"`
+	Read           bool     `json:"read,omitempty"`
+	Starred        bool     `json:"starred,omitempty"`
+	Trashed        bool     `json:"trashed,omitempty"`
+	NeverSpam      bool     `json:"never_spam,omitempty"`
+	Important      bool     `json:"important,omitempty"`
+	NeverImportant bool     `json:"never_important,omitempty"`
+	Category       string   `json:"category,omitempty"`
+	ForwardedTo    []string `json:"forwarded_to,omitempty"`
+}
+
+// Run evaluates every filter against the message in order, passing over
+// the skipped ones
+func (s *Simulator) Run(m *Message) Result {
+	result := Result{
+		Source:  m.Source,
+		Subject: m.Subject(),
+		Matches: make([]FilterMatch, 0),
+		State:   State{Labels: make([]string, 0)},
+	}
+	for i, f := range s.filters {
+		if _, skipped := s.skipped[i]; skipped || !Match(s.queries[i], m) {
+			continue
+		}
+		result.Matches = append(result.Matches, FilterMatch{
+			Index:   i + 1,
+			Name:    f.Name,
+			Actions: f.Actions(),
+		})
+		result.State.apply(f)
+	}
+	return result
+}
+
+// apply adds a filter's actions to the state
+func (st *State) apply(f *filter.Filter) {
+	for _, label := range f.Labels {
+		st.Labels = appendUnique(st.Labels, label)
+	}
+	st.Archived = st.Archived || f.Archive
+	st.Read = st.Read || f.MarkRead
+	st.Starred = st.Starred || f.Star
+	st.Trashed = st.Trashed || f.Trash
+	st.NeverSpam = st.NeverSpam || f.NeverSpam
+	st.Important = st.Important || f.MarkImportant
+	st.NeverImportant = st.NeverImportant || f.NeverImportant
+	if f.Category != "" {
+		st.Category = f.Category
+	}
+	if f.ForwardTo != "" {
+		st.ForwardedTo = appendUnique(st.ForwardedTo, f.ForwardTo)
+	}
+}
+
+// Flags describes the state's actions other than labels, such as
+// "archived" or "category:social"
+func (st *State) Flags() []string {
+	var flags []string
+	for _, flag := range []struct {
+		set  bool
+		name string
+	}{
+		{st.Archived, "archived"},
+		{st.Read, "read"},
+		{st.Starred, "starred"},
+		{st.Trashed, "trashed"},
+		{st.NeverSpam, "never_spam"},
+		{st.Important, "important"},
+		{st.NeverImportant, "never_important"},
+	} {
+		if flag.set {
+			flags = append(flags, flag.name)
+		}
+	}
+	if st.Category != "" {
+		flags = append(flags, "category:"+st.Category)
+	}
+	for _, addr := range st.ForwardedTo {
+		flags = append(flags, "forwarded:"+addr)
+	}
+	return flags
+}
+
+func appendUnique(list []string, value string) []string {
+	for _, v := range list {
+		if v == value {
+			return list
+		}
+	}
+	return append(list, value)
+}
+
+// filterName identifies a filter in messages
+func filterName(f *filter.Filter, index int) string {
+	if f.Name != "" {
+		return fmt.Sprintf("filter %q", f.Name)
+	}
+	return fmt.Sprintf("filter %d", index+1)
+}
+
+// WriteText writes a human-readable summary of the results
+func WriteText(w io.Writer, results []Result) error {
+	var b strings.Builder
+	for i, r := range results {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		source := r.Source
+		if source == "" {
+			source = fmt.Sprintf("message %d", i+1)
+		}
+		fmt.Fprintf(&b, "%s: %s\n", source, r.Subject)
+		if len(r.Matches) == 0 {
+			b.WriteString("  no filters match\n")
+			continue
+		}
+		for _, m := range r.Matches {
+			name := m.Name
+			if name == "" {
+				name = "(unnamed)"
+			}
+			fmt.Fprintf(&b, "  %d. %s: %s\n", m.Index, name, strings.Join(m.Actions, ", "))
+		}
+		labels := "none"
+		if len(r.State.Labels) > 0 {
+			labels = strings.Join(r.State.Labels, ", ")
+		}
+		fmt.Fprintf(&b, "  labels: %s\n", labels)
+		if flags := r.State.Flags(); len(flags) > 0 {
+			fmt.Fprintf(&b, "  flags: %s\n", strings.Join(flags, ", "))
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteJSON writes the results as indented JSON
+func WriteJSON(w io.Writer, results []Result) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(results)
+}
@@ -0,0 +1,225 @@
+package simulate
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/brendanryan/gmail-brita/internal/filter"
+	"github.com/brendanryan/gmail-brita/internal/query"
+)
+
+func TestReadFile(t *testing.T) {
+	messages, err := ReadFile("../testdata/messages/robots.mbox")
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if len(messages) != 3 {
+		t.Fatalf("got %d messages, want 3", len(messages))
+	}
+	if got := messages[1].Subject(); got != "Chunder report" {
+		t.Errorf("Subject() = %q, want %q", got, "Chunder report")
+	}
+	if got := messages[0].Source; got != "../testdata/messages/robots.mbox:1" {
+		t.Errorf("Source = %q", got)
+	}
+	if !strings.Contains(messages[0].Body, "\nFrom here it looks bad.") {
+		t.Errorf("quoted From line not unquoted in body %q", messages[0].Body)
+	}
+
+	messages, err = ReadFile("../testdata/messages/invoice.eml")
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	m := messages[0]
+	if got := m.Subject(); got != "Your invoice – January" {
+		t.Errorf("Subject() = %q", got)
+	}
+	if len(m.Attachments) != 1 || m.Attachments[0] != "invoice-2024-01.pdf" {
+		t.Errorf("Attachments = %q", m.Attachments)
+	}
+	if !strings.Contains(m.Body, "Amount due: €42.") {
+		t.Errorf("Body = %q, want decoded quoted-printable text", m.Body)
+	}
+}
+
+func TestReadMaildir(t *testing.T) {
+	dir := t.TempDir()
+	for _, sub := range []string{"cur", "new", "tmp"} {
+		if err := os.Mkdir(filepath.Join(dir, sub), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write := func(name, subject string) {
+		data := "From: a@example.com\r\nSubject: " + subject + "\r\n\r\nbody\r\n"
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("cur/1.host:2,S", "Seen")
+	write("new/2.host", "Unseen")
+	write("tmp/3.host", "Partial delivery")
+	// An index file the mail server keeps alongside the messages
+	if err := os.WriteFile(filepath.Join(dir, "cur", "dovecot.index"), []byte{0, 1, 2, 0xff}, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	messages, skipped, err := ReadPath(dir)
+	if err != nil {
+		t.Fatalf("ReadPath() error = %v", err)
+	}
+	if len(messages) != 2 || messages[0].Subject() != "Seen" || messages[1].Subject() != "Unseen" {
+		t.Errorf("ReadPath() read %d messages", len(messages))
+	}
+	if len(skipped) != 1 || !strings.Contains(skipped[0].Error(), "dovecot.index") {
+		t.Errorf("ReadPath() skipped = %v, want the index file", skipped)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	messages, err := ReadFile("../testdata/messages/invoice.eml")
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	m := messages[0]
+
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"from:billing@example.com", true},
+		{"from:example.com", true},
+		{"from:Billing", true},
+		{"from:bill", false},
+		{"to:accounts@example.com", true},
+		{"cc:me@example.com", false},
+		{"subject:invoice", true},
+		{`subject:"invoice january"`, true},
+		{`subject:"january invoice"`, false},
+		{"monthly statement", true},
+		{`"statement monthly"`, false},
+		{"has:attachment", true},
+		{"filename:pdf", true},
+		{"filename:docx", false},
+		{"larger:100", true},
+		{"smaller:1K", true},
+		{"after:2023/12/31 before:2024/01/02", true},
+		{"before:2023/12/31", false},
+		{"from:billing -subject:invoice", false},
+		{"from:nobody OR subject:{invoice receipt}", true},
+		{"subject:(invoice -receipt)", true},
+		{"list:robots@bigco.com", false},
+	}
+
+	for _, tt := range tests {
+		n, err := query.Parse(tt.query)
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", tt.query, err)
+		}
+		if errs := Unsupported(n); len(errs) > 0 {
+			t.Fatalf("Unsupported(%q) = %v", tt.query, errs)
+		}
+		if got := Match(n, m); got != tt.want {
+			t.Errorf("Match(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestUnsupported(t *testing.T) {
+	for _, q := range []string{"is:unread", "label:work", "has:userlabels", "larger:huge"} {
+		n, err := query.Parse(q)
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", q, err)
+		}
+		if errs := Unsupported(n); len(errs) != 1 {
+			t.Errorf("Unsupported(%q) = %v, want one error", q, errs)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	set := filter.NewFilterSet([]string{"me@example.com"})
+	filter.NewBuilder(set).Name("Robots").
+		Has([]string{"list:robots@bigco.com"}).
+		Label("robots").
+		Archive()
+	filter.NewBuilder(set).Name("Important").
+		Subject([]string{"Important"}).
+		Label("important").
+		Star()
+	filter.NewBuilder(set).Name("Lunch").
+		Subject([]string{"Lunch"}).
+		Label("social")
+
+	sim, err := New(set)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	messages, err := ReadFile("../testdata/messages/robots.mbox")
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+
+	result := sim.Run(messages[0])
+	if len(result.Matches) != 2 || result.Matches[0].Name != "Robots" || result.Matches[1].Index != 2 {
+		t.Errorf("Matches = %+v", result.Matches)
+	}
+	if got := strings.Join(result.State.Labels, ","); got != "robots,important" {
+		t.Errorf("Labels = %q, want robots,important", got)
+	}
+	if !result.State.Archived || !result.State.Starred || result.State.Read {
+		t.Errorf("State = %+v", result.State)
+	}
+
+	var out bytes.Buffer
+	if err := WriteText(&out, []Result{result, sim.Run(messages[2])}); err != nil {
+		t.Fatalf("WriteText() error = %v", err)
+	}
+	for _, want := range []string{
+		"1. Robots: archive, label:robots",
+		"labels: robots, important",
+		"flags: archived, starred",
+		"Lunch?\n  3. Lunch: label:social",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("WriteText() output missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestNewSkipsUnsupportedTerms(t *testing.T) {
+	set := filter.NewFilterSet([]string{"me@example.com"})
+	filter.NewBuilder(set).Name("Unread").
+		Has([]string{"is:unread", "label:work"}).
+		Label("unread")
+	filter.NewBuilder(set).Name("Lunch").
+		Subject([]string{"Lunch"}).
+		Label("social")
+
+	sim, err := New(set)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	skipped := sim.Skipped()
+	if len(skipped) != 1 || skipped[0].Index != 1 || len(skipped[0].Reasons) != 2 {
+		t.Fatalf("Skipped() = %+v", skipped)
+	}
+	want := `filter "Unread" not evaluated: is:unread cannot be evaluated locally; label:work cannot be evaluated locally`
+	if got := skipped[0].String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if sim.Evaluated(1) || !sim.Evaluated(2) {
+		t.Errorf("Evaluated() = %t, %t, want false, true", sim.Evaluated(1), sim.Evaluated(2))
+	}
+
+	messages, err := ReadFile("../testdata/messages/robots.mbox")
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	result := sim.Run(messages[2])
+	if len(result.Matches) != 1 || result.Matches[0].Name != "Lunch" {
+		t.Errorf("Matches = %+v", result.Matches)
+	}
+}
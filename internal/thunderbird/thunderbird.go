@@ -0,0 +1,421 @@
+// Package thunderbird converts filter sets into Thunderbird's message filter
+// file, msgFilterRules.dat, for reading Gmail over IMAP.
+package thunderbird
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/brendanryan/gmail-brita/internal/filter"
+	"github.com/brendanryan/gmail-brita/internal/query"
+)
+
+// ArchiveFolder is the folder messages are moved to when a filter archives
+// them without applying a label. Over IMAP, moving a message out of the
+// inbox into All Mail archives it in Gmail.
+const ArchiveFolder = "[Gmail]/All Mail"
+
+// maxFilters bounds how many Thunderbird filters one filter may expand to
+const maxFilters = 16
+
+// filterType runs filters on new mail and when run manually
+const filterType = 17
+
+// ErrNoAccount reports filters that need folders without an IMAP account
+var ErrNoAccount = errors.New("an IMAP account URI is required for filters that apply labels or archive")
+
+// UnsupportedError reports part of a filter that has no Thunderbird
+// equivalent. A filter with unsupported conditions is left out, while
+// unsupported actions are dropped.
+type UnsupportedError struct {
+	Filter string
+	// Feature is the search term or action that was not translated
+	Feature string
+	// Skipped reports whether the whole filter was left out
+	Skipped bool
+}
+
+func (e *UnsupportedError) Error() string {
+	if e.Skipped {
+		return fmt.Sprintf("filter %q skipped: %s cannot be expressed as a Thunderbird filter", e.Filter, e.Feature)
+	}
+	return fmt.Sprintf("filter %q: %s is not translated to Thunderbird", e.Filter, e.Feature)
+}
+
+// Write renders a filter set as a msgFilterRules.dat file for the IMAP
+// account with the given URI, such as imap://me%40gmail.com@imap.gmail.com,
+// returning the parts of filters that could not be translated alongside
+// it. Labels are folders over IMAP, so they become copy to folder actions,
+// or a move for the first label when the filter archives. Thunderbird
+// conditions are a single list of terms that must all, or any, match, so
+// filters that need both are written as several filters with the same
+// actions, one for each alternative.
+func Write(set *filter.Set, account string) ([]byte, []*UnsupportedError, error) {
+	w := &writer{account: strings.TrimSuffix(account, "/")}
+	w.b.WriteString("version=\"9\"\nlogging=\"no\"\n")
+	for i, f := range set.Filters {
+		if err := w.filter(f, i); err != nil {
+			return nil, nil, err
+		}
+	}
+	return []byte(w.b.String()), w.unsupported, nil
+}
+
+// writer accumulates the filters of a msgFilterRules.dat file
+type writer struct {
+	b           strings.Builder
+	account     string
+	unsupported []*UnsupportedError
+}
+
+// action is a Thunderbird filter action and its value
+type action struct {
+	name, value string
+}
+
+// filter writes the Thunderbird filters for a single filter
+func (w *writer) filter(f *filter.Filter, index int) error {
+	name := strings.Join(strings.Fields(f.Name), " ")
+	if name == "" {
+		name = fmt.Sprintf("Filter %d", index+1)
+	}
+
+	q, err := f.Query()
+	if err != nil {
+		return fmt.Errorf("filter %q: %w", f.Name, err)
+	}
+	conditions, unsupported := conditions(q)
+	if len(unsupported) > 0 {
+		w.unsupported = append(w.unsupported, &UnsupportedError{
+			Filter:  name,
+			Feature: strings.Join(unsupported, ", "),
+			Skipped: true,
+		})
+		return nil
+	}
+	actions, err := w.actions(f, name)
+	if err != nil {
+		return err
+	}
+	if len(actions) == 0 {
+		w.unsupported = append(w.unsupported, &UnsupportedError{
+			Filter:  name,
+			Feature: "a filter with no translatable actions",
+			Skipped: true,
+		})
+		return nil
+	}
+
+	for i, condition := range conditions {
+		filterName := name
+		if len(conditions) > 1 {
+			filterName = fmt.Sprintf("%s (%d)", name, i+1)
+		}
+		w.attr("name", filterName)
+		w.attr("enabled", "yes")
+		w.attr("type", fmt.Sprint(filterType))
+		for _, a := range actions {
+			w.attr("action", a.name)
+			if a.value != "" {
+				w.attr("actionValue", a.value)
+			}
+		}
+		w.attr("condition", condition)
+	}
+	return nil
+}
+
+// actions translates the filter's actions, recording those that have no
+// equivalent. Copies come before the move, which Thunderbird runs last.
+func (w *writer) actions(f *filter.Filter, name string) ([]action, error) {
+	var actions []action
+	folders := f.Labels
+	if f.Archive && len(folders) == 0 {
+		folders = []string{ArchiveFolder}
+	}
+	if len(folders) > 0 && w.account == "" {
+		return nil, fmt.Errorf("filter %q: %w", name, ErrNoAccount)
+	}
+	copies := folders
+	if f.Archive {
+		copies = folders[1:]
+	}
+	for _, folder := range copies {
+		actions = append(actions, action{"Copy to folder", w.folderURI(folder)})
+	}
+	if f.Archive {
+		actions = append(actions, action{"Move to folder", w.folderURI(folders[0])})
+	}
+
+	if f.MarkRead {
+		actions = append(actions, action{name: "Mark read"})
+	}
+	if f.Star {
+		actions = append(actions, action{name: "Mark flagged"})
+	}
+	if f.NeverSpam {
+		actions = append(actions, action{"JunkScore", "0"})
+	}
+	if f.ForwardTo != "" {
+		actions = append(actions, action{"Forward", f.ForwardTo})
+	}
+	if f.Trash {
+		actions = append(actions, action{name: "Delete"})
+	}
+
+	var skipped []string
+	if f.MarkImportant {
+		skipped = append(skipped, "mark_important")
+	}
+	if f.NeverImportant {
+		skipped = append(skipped, "never_important")
+	}
+	if f.Category != "" {
+		skipped = append(skipped, "category "+f.Category)
+	}
+	for _, s := range skipped {
+		w.unsupported = append(w.unsupported, &UnsupportedError{Filter: name, Feature: s})
+	}
+	return actions, nil
+}
+
+// folderURI returns the URI of a folder in the account, escaping each
+// level of a nested label
+func (w *writer) folderURI(folder string) string {
+	segments := strings.Split(folder, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return w.account + "/" + strings.Join(segments, "/")
+}
+
+// attr writes a name="value" line, escaping quotes and backslashes
+func (w *writer) attr(name, value string) {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	fmt.Fprintf(&w.b, "%s=\"%s\"\n", name, value)
+}
+
+// literal is a search term that must match, or with negated must not
+type literal struct {
+	word    query.Word
+	negated bool
+}
+
+// conditions translates a query into one Thunderbird condition for each
+// filter it needs, collecting the terms that cannot be translated
+func conditions(q query.Node) ([]string, []string) {
+	if q == nil {
+		return []string{"ALL"}, nil
+	}
+	alternatives, ok := expand(q)
+	if !ok {
+		return nil, []string{fmt.Sprintf("a condition needing more than %d filters", maxFilters)}
+	}
+	if len(alternatives) == 0 {
+		return nil, []string{"a condition that never matches"}
+	}
+
+	var unsupported []string
+	seen := make(map[string]bool)
+	translate := func(l literal) string {
+		t, ok := term(l)
+		if !ok {
+			s := l.word.String()
+			if l.negated {
+				s = "-" + s
+			}
+			if !seen[s] {
+				seen[s] = true
+				unsupported = append(unsupported, s)
+			}
+		}
+		return t
+	}
+
+	// Alternatives of single terms fit one filter matching any of them
+	single := true
+	for _, a := range alternatives {
+		single = single && len(a) == 1
+	}
+	if single && len(alternatives) > 1 {
+		terms := make([]string, 0, len(alternatives))
+		for _, a := range alternatives {
+			terms = append(terms, "OR "+translate(a[0]))
+		}
+		return []string{strings.Join(terms, " ")}, unsupported
+	}
+
+	out := make([]string, 0, len(alternatives))
+	for _, a := range alternatives {
+		terms := make([]string, 0, len(a))
+		for _, l := range a {
+			terms = append(terms, "AND "+translate(l))
+		}
+		out = append(out, strings.Join(terms, " "))
+	}
+	return out, unsupported
+}
+
+// expand rewrites a query as alternatives of terms that must all match,
+// reporting false when there would be more than maxFilters of them. Plain
+// words search the subject and the body, as they do in Gmail.
+func expand(n query.Node) ([][]literal, bool) {
+	switch v := n.(type) {
+	case query.Word:
+		if v.Op == "" {
+			subject, body := v, v
+			subject.Op, body.Op = "subject", "body"
+			return [][]literal{{{word: subject}}, {{word: body}}}, true
+		}
+		return [][]literal{{{word: v}}}, true
+	case query.Not:
+		if w, ok := v.X.(query.Word); ok {
+			if w.Op == "" {
+				subject, body := w, w
+				subject.Op, body.Op = "subject", "body"
+				return [][]literal{{{word: subject, negated: true}, {word: body, negated: true}}}, true
+			}
+			return [][]literal{{{word: w, negated: true}}}, true
+		}
+		return expand(query.Negate(v.X))
+	case query.Or:
+		var out [][]literal
+		for _, c := range v {
+			alternatives, ok := expand(c)
+			if !ok || len(out)+len(alternatives) > maxFilters {
+				return nil, false
+			}
+			out = append(out, alternatives...)
+		}
+		return out, true
+	case query.And:
+		out := [][]literal{{}}
+		for _, c := range v {
+			alternatives, ok := expand(c)
+			if !ok || len(out)*len(alternatives) > maxFilters {
+				return nil, false
+			}
+			product := make([][]literal, 0, len(out)*len(alternatives))
+			for _, a := range out {
+				for _, b := range alternatives {
+					if combined, ok := combine(a, b); ok {
+						product = append(product, combined)
+					}
+				}
+			}
+			out = product
+		}
+		return out, true
+	default:
+		return nil, false
+	}
+}
+
+// combine joins two lists of terms that must all match, dropping repeated
+// terms and reporting false when the result contradicts itself. A negated
+// cc: is also dropped beside a negated to: of the same address, since
+// Gmail's to: and Thunderbird's "to or cc" already search Cc.
+func combine(a, b []literal) ([]literal, bool) {
+	key := func(w query.Word) string {
+		return strings.ToLower(w.Op) + ":" + strings.ToLower(w.Value)
+	}
+	polarity := make(map[string]bool)
+	out := make([]literal, 0, len(a)+len(b))
+	for _, l := range append(append([]literal(nil), a...), b...) {
+		k := key(l.word)
+		if negated, ok := polarity[k]; ok {
+			if negated != l.negated {
+				return nil, false
+			}
+			continue
+		}
+		polarity[k] = l.negated
+		out = append(out, l)
+	}
+
+	kept := out[:0]
+	for _, l := range out {
+		if l.negated && strings.EqualFold(l.word.Op, "cc") {
+			to := query.Word{Op: "to", Value: l.word.Value}
+			if negated, ok := polarity[key(to)]; ok && negated {
+				continue
+			}
+		}
+		kept = append(kept, l)
+	}
+	return kept, true
+}
+
+// headers maps Gmail's search operators to the Thunderbird attributes they
+// search. Quoted attributes are custom headers.
+var headers = map[string]string{
+	"from":        "from",
+	"to":          "to or cc",
+	"cc":          "cc",
+	"subject":     "subject",
+	"body":        "body",
+	"list":        `"List-Id"`,
+	"deliveredto": `"Delivered-To"`,
+	"rfc822msgid": `"Message-ID"`,
+}
+
+// term translates a single search term into a Thunderbird search term,
+// reporting whether it could be
+func term(l literal) (string, bool) {
+	op := strings.ToLower(l.word.Op)
+	value := l.word.Value
+	switch op {
+	case "has":
+		if !strings.EqualFold(value, "attachment") {
+			return "", false
+		}
+		return fmt.Sprintf("(has attachment status,is,%t)", !l.negated), true
+	case "larger", "size", "smaller":
+		size, err := query.ParseSize(value)
+		if err != nil {
+			return "", false
+		}
+		// Thunderbird compares sizes in kilobytes
+		kb := size / query.Kilobyte
+		greater := op != "smaller"
+		if l.negated {
+			greater = !greater
+			if greater {
+				kb--
+			} else {
+				kb++
+			}
+		}
+		if greater {
+			return fmt.Sprintf("(size,is greater than,%d)", kb), true
+		}
+		return fmt.Sprintf("(size,is less than,%d)", kb), true
+	}
+
+	attribute, ok := headers[op]
+	if !ok {
+		return "", false
+	}
+	if op == "list" {
+		if at := strings.LastIndex(value, "@"); at > 0 {
+			// List-Id holds the address with its @ replaced by a dot
+			value = value[:at] + "." + value[at+1:]
+		}
+	}
+	operator := "contains"
+	if l.negated {
+		operator = "doesn't contain"
+	}
+	return fmt.Sprintf("(%s,%s,%s)", attribute, operator, termValue(value)), true
+}
+
+// termValue quotes a value that would otherwise end the term early
+func termValue(value string) string {
+	if !strings.ContainsAny(value, `)"`) && strings.TrimSpace(value) == value {
+		return value
+	}
+	return `"` + strings.ReplaceAll(value, `"`, `\"`) + `"`
+}
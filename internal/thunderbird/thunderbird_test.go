@@ -0,0 +1,137 @@
+package thunderbird
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/brendanryan/gmail-brita/internal/filter"
+	"github.com/brendanryan/gmail-brita/internal/query"
+)
+
+const account = "imap://me%40gmail.com@imap.gmail.com"
+
+func TestWrite(t *testing.T) {
+	set := filter.NewFilterSet([]string{"me@gmail.com"})
+	filter.NewBuilder(set).Name("Robots").
+		List([]string{"robots@bigco.com"}).
+		HasNot([]string{"urgent"}).
+		Label("work/robot alerts").
+		Label("todo").
+		Archive().
+		MarkRead()
+	filter.NewBuilder(set).Name("Family").
+		From([]string{"mom@example.com", "dad@example.com"}).
+		Star().
+		NeverSpam()
+	filter.NewBuilder(set).Name("Big \"files\"").
+		Has([]string{"has:attachment"}).
+		Subject([]string{"scan (1)"}).
+		Larger(5 * query.Megabyte).
+		Trash()
+	filter.NewBuilder(set).Name("Unread").
+		Has([]string{"is:unread"}).
+		MarkRead()
+	filter.NewBuilder(set).Name("Deals").
+		Subject([]string{"sale"}).
+		Category("promotions").
+		MarkImportant()
+
+	data, unsupported, err := Write(set, account+"/")
+	if err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	want := `version="9"
+logging="no"
+name="Robots"
+enabled="yes"
+type="17"
+action="Copy to folder"
+actionValue="imap://me%40gmail.com@imap.gmail.com/todo"
+action="Move to folder"
+actionValue="imap://me%40gmail.com@imap.gmail.com/work/robot%20alerts"
+action="Mark read"
+condition="AND (\"List-Id\",contains,robots.bigco.com) AND (subject,doesn't contain,urgent) AND (body,doesn't contain,urgent)"
+name="Family"
+enabled="yes"
+type="17"
+action="Mark flagged"
+action="JunkScore"
+actionValue="0"
+condition="OR (from,contains,mom@example.com) OR (from,contains,dad@example.com)"
+name="Big \"files\""
+enabled="yes"
+type="17"
+action="Delete"
+condition="AND (subject,contains,\"scan (1)\") AND (has attachment status,is,true) AND (size,is greater than,5120)"
+`
+	if !strings.HasPrefix(string(data), want) {
+		t.Errorf("Write() =\n%s\nwant prefix\n%s", data, want)
+	}
+
+	var got []string
+	for _, u := range unsupported {
+		got = append(got, u.Error())
+	}
+	wantUnsupported := []string{
+		`filter "Unread" skipped: is:unread cannot be expressed as a Thunderbird filter`,
+		`filter "Deals": mark_important is not translated to Thunderbird`,
+		`filter "Deals": category promotions is not translated to Thunderbird`,
+		`filter "Deals" skipped: a filter with no translatable actions cannot be expressed as a Thunderbird filter`,
+	}
+	if strings.Join(got, "\n") != strings.Join(wantUnsupported, "\n") {
+		t.Errorf("unsupported =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(wantUnsupported, "\n"))
+	}
+}
+
+func TestWriteExpands(t *testing.T) {
+	set := filter.NewFilterSet([]string{"me@gmail.com"})
+	// Thunderbird cannot mix AND and OR, so each sender gets a filter
+	filter.NewBuilder(set).Name("Reports").
+		From([]string{"a@example.com", "b@example.com"}).
+		Subject([]string{"report"}).
+		MarkRead()
+	// The alternative contradicting list:robots is dropped, as in the
+	// filters written for otherwise
+	filter.NewBuilder(set).Name("Other robots").
+		Has([]string{"-(list:robots subject:alert)", "list:robots"}).
+		MarkRead()
+
+	data, _, err := Write(set, account)
+	if err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	for _, want := range []string{
+		"name=\"Reports (1)\"\nenabled=\"yes\"\ntype=\"17\"\naction=\"Mark read\"\ncondition=\"AND (from,contains,a@example.com) AND (subject,contains,report)\"\n",
+		"name=\"Reports (2)\"\nenabled=\"yes\"\ntype=\"17\"\naction=\"Mark read\"\ncondition=\"AND (from,contains,b@example.com) AND (subject,contains,report)\"\n",
+		"name=\"Other robots\"\nenabled=\"yes\"\ntype=\"17\"\naction=\"Mark read\"\ncondition=\"AND (subject,doesn't contain,alert) AND (\\\"List-Id\\\",contains,robots)\"\n",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("Write() missing %q:\n%s", want, data)
+		}
+	}
+
+	// Too many alternatives leave the filter out
+	words := make([]string, 0, 5)
+	for i := 0; i < 5; i++ {
+		words = append(words, "from:a"+strings.Repeat("x", i)+" OR from:b")
+	}
+	set = filter.NewFilterSet([]string{"me@gmail.com"})
+	filter.NewBuilder(set).Name("Explosive").Has(words).MarkRead()
+	_, unsupported, err := Write(set, account)
+	if err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if len(unsupported) != 1 || !strings.Contains(unsupported[0].Error(), "more than 16 filters") {
+		t.Errorf("unsupported = %v", unsupported)
+	}
+}
+
+func TestWriteNeedsAccount(t *testing.T) {
+	set := filter.NewFilterSet([]string{"me@gmail.com"})
+	filter.NewBuilder(set).Name("Archived").Has([]string{"subject:x"}).Archive()
+	if _, _, err := Write(set, ""); !errors.Is(err, ErrNoAccount) {
+		t.Errorf("Write() error = %v, want ErrNoAccount", err)
+	}
+}
@@ -1,52 +1,175 @@
 package britta
 
 import (
+	"fmt"
+
 	"github.com/brendanryan/gmail-brita/internal/config"
 	"github.com/brendanryan/gmail-brita/internal/filter"
+	"github.com/brendanryan/gmail-brita/internal/query"
 )
 
 // GenerateXML generates Gmail filter XML from a configuration
 func GenerateXML(cfg *config.Config) ([]byte, error) {
+	set, err := Build(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Generate XML
+	return set.ToXML()
+}
+
+// Build builds the filter set described by a configuration
+func Build(cfg *config.Config) (*filter.Set, error) {
 	// Create filter set
 	set := filter.NewFilterSet(cfg.Emails)
+	set.Updated = cfg.Timestamp
+	set.Limits = filter.LimitPolicy(cfg.Limits)
 
 	// Build filters
 	for _, f := range cfg.Filters {
-		builder := filter.NewBuilder(set)
+		if err := buildFilter(set, filter.NewBuilder(set), f); err != nil {
+			return nil, fmt.Errorf("filter %q: %w", f.Name, err)
+		}
+	}
 
-		// Add conditions
-		if len(f.Conditions.Has) > 0 {
-			builder.Has(f.Conditions.Has)
+	return set, nil
+}
+
+// buildFilter applies a filter's conditions and actions to the builder,
+// followed by any otherwise and chain branches
+func buildFilter(set *filter.Set, builder *filter.Builder, f config.Filter) error {
+	name := f.Name
+	if name == "" {
+		name = builder.Filter().Name
+	}
+	builder.Name(name).LintIgnore(f.LintIgnore...)
+
+	// Add conditions
+	if len(f.Conditions.Has) > 0 {
+		builder.Has(f.Conditions.Has)
+	}
+	if len(f.Conditions.HasNot) > 0 {
+		builder.HasNot(f.Conditions.HasNot)
+	}
+	builder.From(f.Conditions.From).
+		To(f.Conditions.To).
+		Subject(f.Conditions.Subject).
+		Cc(f.Conditions.Cc).
+		Bcc(f.Conditions.Bcc).
+		List(f.Conditions.List).
+		DeliveredTo(f.Conditions.DeliveredTo).
+		Filename(f.Conditions.Filename)
+	for _, c := range f.Conditions.All {
+		builder.Where(condition(c))
+	}
+	if len(f.Conditions.Any) > 0 {
+		builder.Where(anyOf(f.Conditions.Any))
+	}
+	if f.Conditions.Not != nil {
+		builder.Where(filter.Not{Condition: condition(*f.Conditions.Not)})
+	}
+	if f.Conditions.Larger != "" {
+		size, err := query.ParseSize(f.Conditions.Larger)
+		if err != nil {
+			return err
 		}
-		if len(f.Conditions.HasNot) > 0 {
-			builder.HasNot(f.Conditions.HasNot)
+		builder.Larger(size)
+	}
+	if f.Conditions.Smaller != "" {
+		size, err := query.ParseSize(f.Conditions.Smaller)
+		if err != nil {
+			return err
 		}
+		builder.Smaller(size)
+	}
 
-		// Add actions
-		if f.Actions.Label != "" {
-			builder.Label(f.Actions.Label)
-		}
-		if f.Actions.Archive {
-			builder.Archive()
+	// Add actions
+	for _, label := range f.Actions.AllLabels() {
+		builder.Label(label)
+	}
+	if f.Actions.Archive {
+		builder.Archive()
+	}
+	if f.Actions.MarkRead {
+		builder.MarkRead()
+	}
+	if f.Actions.Star {
+		builder.Star()
+	}
+	if f.Actions.NeverSpam {
+		builder.NeverSpam()
+	}
+	if f.Actions.Delete {
+		builder.Trash()
+	}
+	if f.Actions.MarkImportant {
+		builder.MarkImportant()
+	}
+	if f.Actions.NeverImportant {
+		builder.NeverImportant()
+	}
+	if f.Actions.Category != "" {
+		builder.Category(f.Actions.Category)
+	}
+	if f.Actions.Forward != "" {
+		builder.Forward(f.Actions.Forward)
+	}
+	if f.Actions.ArchiveUnlessDirected != nil {
+		var opts []filter.ArchiveUnlessDirectedOption
+		if f.Actions.ArchiveUnlessDirected.MarkRead {
+			opts = append(opts, filter.WithMarkRead(true))
 		}
-		if f.Actions.MarkRead {
-			builder.MarkRead()
+		builder.ArchiveUnlessDirected(opts...)
+	}
+
+	if f.Otherwise != nil {
+		if err := buildFilter(set, builder.Otherwise().Name(name+" (otherwise)"), *f.Otherwise); err != nil {
+			return err
 		}
-		if f.Actions.Star {
-			builder.Star()
+	}
+
+	if len(f.Chain) > 0 {
+		branch := builder.Also()
+		for i, c := range f.Chain {
+			if i > 0 {
+				branch = branch.Otherwise()
+			}
+			if err := buildFilter(set, branch.Name(fmt.Sprintf("%s (branch %d)", name, i+1)), c); err != nil {
+				return err
+			}
 		}
-		if f.Actions.NeverSpam {
-			builder.NeverSpam()
+		if f.Actions.IsEmpty() {
+			set.RemoveFilter(builder.Filter())
 		}
-		if f.Actions.ArchiveUnlessDirected != nil {
-			var opts []filter.ArchiveUnlessDirectedOption
-			if f.Actions.ArchiveUnlessDirected.MarkRead {
-				opts = append(opts, filter.WithMarkRead(true))
-			}
-			builder.ArchiveUnlessDirected(opts...)
+	}
+
+	return nil
+}
+
+// condition converts a configured condition expression into a filter condition
+func condition(c config.Condition) filter.Condition {
+	switch {
+	case c.All != nil:
+		all := make(filter.All, 0, len(c.All))
+		for _, child := range c.All {
+			all = append(all, condition(child))
 		}
+		return all
+	case c.Any != nil:
+		return anyOf(c.Any)
+	case c.Not != nil:
+		return filter.Not{Condition: condition(*c.Not)}
+	default:
+		return filter.Term(c.Term)
 	}
+}
 
-	// Generate XML
-	return set.ToXML()
+// anyOf converts configured alternatives into a filter condition
+func anyOf(conditions []config.Condition) filter.Any {
+	alternatives := make(filter.Any, 0, len(conditions))
+	for _, c := range conditions {
+		alternatives = append(alternatives, condition(c))
+	}
+	return alternatives
 }
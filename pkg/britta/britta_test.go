@@ -1,9 +1,11 @@
 package britta
 
 import (
+	"bytes"
 	"encoding/xml"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/brendanryan/gmail-brita/internal/config"
@@ -97,3 +99,235 @@ func TestFilterSetIntegration(t *testing.T) {
 		})
 	}
 }
+
+func TestConditionExpressions(t *testing.T) {
+	cfg, err := config.LoadFromFile(testdataPath("filters", "conditions.yaml"))
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	got, err := GenerateXML(cfg)
+	if err != nil {
+		t.Fatalf("GenerateXML() error = %v", err)
+	}
+
+	want := []string{
+		"from:mom@example.com OR from:dad@example.com OR from:sister@example.com",
+		"list:robots@bigco.com AND (subject:Important OR -(subject:Chunder OR subject:Semirelevant))",
+	}
+	if hasTheWord := propertyValues(t, got, "hasTheWord"); !equalStrings(hasTheWord, want) {
+		t.Errorf("hasTheWord = %q, want %q", hasTheWord, want)
+	}
+}
+
+func TestOtherwise(t *testing.T) {
+	cfg, err := config.LoadFromFile(testdataPath("filters", "otherwise.yaml"))
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	got, err := GenerateXML(cfg)
+	if err != nil {
+		t.Fatalf("GenerateXML() error = %v", err)
+	}
+
+	want := []string{
+		"list:robots@bigco.com AND subject:Important",
+		"(-list:robots@bigco.com OR -subject:Important) AND list:robots@bigco.com AND subject:Chunder",
+		"(-list:robots@bigco.com OR -subject:Important) AND (-list:robots@bigco.com OR -subject:Chunder)",
+	}
+	if hasTheWord := propertyValues(t, got, "hasTheWord"); !equalStrings(hasTheWord, want) {
+		t.Errorf("hasTheWord = %q, want %q", hasTheWord, want)
+	}
+}
+
+func TestChain(t *testing.T) {
+	cfg, err := config.LoadFromFile(testdataPath("filters", "chain.yaml"))
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	got, err := GenerateXML(cfg)
+	if err != nil {
+		t.Fatalf("GenerateXML() error = %v", err)
+	}
+
+	// The base filter has no actions, so only the branches are generated
+	want := []string{
+		"list:robots@bigco.com",
+		"list:robots@bigco.com AND -subject:Important",
+		"list:robots@bigco.com AND -subject:Important AND -subject:Chunder",
+	}
+	if hasTheWord := propertyValues(t, got, "hasTheWord"); !equalStrings(hasTheWord, want) {
+		t.Errorf("hasTheWord = %q, want %q", hasTheWord, want)
+	}
+	wantSubjects := []string{"Important", "Chunder"}
+	if subjects := propertyValues(t, got, "subject"); !equalStrings(subjects, wantSubjects) {
+		t.Errorf("subject = %q, want %q", subjects, wantSubjects)
+	}
+}
+
+func TestMultipleLabels(t *testing.T) {
+	cfg, err := config.LoadFromFile(testdataPath("filters", "labels.yaml"))
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	got, err := GenerateXML(cfg)
+	if err != nil {
+		t.Fatalf("GenerateXML() error = %v", err)
+	}
+
+	// Gmail applies one label per entry, so each label gets its own entry
+	wantLabels := []string{"finance", "finance/invoices", "todo"}
+	if labels := propertyValues(t, got, "label"); !equalStrings(labels, wantLabels) {
+		t.Errorf("label = %q, want %q", labels, wantLabels)
+	}
+	wantFrom := []string{"billing@example.com", "billing@example.com", "billing@example.com"}
+	if from := propertyValues(t, got, "from"); !equalStrings(from, wantFrom) {
+		t.Errorf("from = %q, want %q", from, wantFrom)
+	}
+	if archive := propertyValues(t, got, "shouldArchive"); len(archive) != 1 {
+		t.Errorf("shouldArchive appears %d times, want 1", len(archive))
+	}
+}
+
+func TestImportXML(t *testing.T) {
+	data, err := os.ReadFile(testdataPath("exports", "mailFilters.xml"))
+	if err != nil {
+		t.Fatalf("Failed to read export: %v", err)
+	}
+
+	cfg, err := ImportXML(data)
+	if err != nil {
+		t.Fatalf("ImportXML() error = %v", err)
+	}
+
+	if !equalStrings(cfg.Emails, []string{"me@example.com"}) {
+		t.Errorf("Emails = %q", cfg.Emails)
+	}
+	if len(cfg.Filters) != 3 {
+		t.Fatalf("got %d filters, want 3", len(cfg.Filters))
+	}
+
+	family := cfg.Filters[0]
+	if family.Name != "personal/family" || !equalStrings(family.Conditions.From, []string{"mom@example.com", "dad@example.com"}) {
+		t.Errorf("family filter not imported correctly: %+v", family)
+	}
+	if family.Actions.Label != "personal/family" || !family.Actions.Star {
+		t.Errorf("family actions not imported correctly: %+v", family.Actions)
+	}
+
+	robots := cfg.Filters[1].Conditions
+	if !equalStrings(robots.Subject, []string{"Monthly Statement"}) {
+		t.Errorf("Subject = %q", robots.Subject)
+	}
+	if !equalStrings(robots.List, []string{"robots@bigco.com"}) {
+		t.Errorf("List = %q", robots.List)
+	}
+	if !equalStrings(robots.Cc, []string{"a@example.com", "b@example.com"}) {
+		t.Errorf("Cc = %q", robots.Cc)
+	}
+	if !equalStrings(robots.HasNot, []string{"to:me@example.com", "cc:me@example.com", "subject:Chunder"}) {
+		t.Errorf("HasNot = %q", robots.HasNot)
+	}
+
+	deals := cfg.Filters[2]
+	if deals.Conditions.Larger != "5M" {
+		t.Errorf("Larger = %q, want 5M", deals.Conditions.Larger)
+	}
+	if !deals.Actions.Delete || deals.Actions.Category != "promotions" || deals.Actions.Forward != "archive@example.com" {
+		t.Errorf("deals actions not imported correctly: %+v", deals.Actions)
+	}
+
+	// The imported config must generate the same filters again
+	if _, err := GenerateXML(cfg); err != nil {
+		t.Fatalf("GenerateXML() error = %v", err)
+	}
+}
+
+func TestRunTests(t *testing.T) {
+	cfg, err := config.LoadFromFile(testdataPath("filters", "tests.yaml"))
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	results, skipped, err := RunTests(cfg)
+	if err != nil {
+		t.Fatalf("RunTests() error = %v", err)
+	}
+	want := `filter "Unread" not evaluated: is:unread cannot be evaluated locally`
+	if len(skipped) != 1 || skipped[0] != want {
+		t.Errorf("RunTests() not evaluated = %q, want %q", skipped, want)
+	}
+	for _, r := range results {
+		if !r.Passed() {
+			t.Errorf("test %q failed: %q", r.Name, r.Failures)
+		}
+	}
+
+	// Break the expectations and check that the failures are reported
+	yes := true
+	cfg.Tests[0].Expect.Labels = []string{"work/robots/meh"}
+	cfg.Tests[3].Expect.Archive = &yes
+	results, _, err = RunTests(cfg)
+	if err != nil {
+		t.Fatalf("RunTests() error = %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := WriteTestResults(&out, results); err != nil {
+		t.Fatalf("WriteTestResults() error = %v", err)
+	}
+	for _, want := range []string{
+		"FAIL Important robot mail stays in the inbox\n" +
+			"    labels: got work/robots/important, want work/robots/meh\n" +
+			"    matched: Important\n",
+		"FAIL Personal mail is untouched\n" +
+			"    archive: got false, want true\n" +
+			"    matched: (none)\n",
+		"PASS Other robot mail is archived\n",
+		"2 passed, 2 failed\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("WriteTestResults() output missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+// propertyValues returns the values of every property with the given name in generated XML
+func propertyValues(t *testing.T, data []byte, name string) []string {
+	t.Helper()
+	var feed struct {
+		Entries []struct {
+			Properties []struct {
+				Name  string `xml:"name,attr"`
+				Value string `xml:"value,attr"`
+			} `xml:"property"`
+		} `xml:"entry"`
+	}
+	if err := xml.Unmarshal(data, &feed); err != nil {
+		t.Fatalf("Failed to parse generated XML: %v", err)
+	}
+	var values []string
+	for _, e := range feed.Entries {
+		for _, p := range e.Properties {
+			if p.Name == name {
+				values = append(values, p.Value)
+			}
+		}
+	}
+	return values
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,229 @@
+package britta
+
+import (
+	"fmt"
+
+	"github.com/brendanryan/gmail-brita/internal/config"
+	"github.com/brendanryan/gmail-brita/internal/filter"
+	"github.com/brendanryan/gmail-brita/internal/query"
+)
+
+// structuredOperators maps search operators to the condition field that
+// expresses them directly
+var structuredOperators = map[string]func(*config.Conditions) *[]string{
+	"from":        func(c *config.Conditions) *[]string { return &c.From },
+	"to":          func(c *config.Conditions) *[]string { return &c.To },
+	"cc":          func(c *config.Conditions) *[]string { return &c.Cc },
+	"bcc":         func(c *config.Conditions) *[]string { return &c.Bcc },
+	"subject":     func(c *config.Conditions) *[]string { return &c.Subject },
+	"list":        func(c *config.Conditions) *[]string { return &c.List },
+	"deliveredto": func(c *config.Conditions) *[]string { return &c.DeliveredTo },
+	"filename":    func(c *config.Conditions) *[]string { return &c.Filename },
+}
+
+// ImportXML converts a Gmail filter export into a configuration
+func ImportXML(data []byte) (*config.Config, error) {
+	set, err := filter.ParseXML(data)
+	if err != nil {
+		return nil, err
+	}
+	return ConfigFromSet(set)
+}
+
+// ConfigFromSet converts a filter set into a configuration. Search terms
+// are mapped onto structured condition fields where possible, and filters
+// are named after their first label.
+func ConfigFromSet(set *filter.Set) (*config.Config, error) {
+	cfg := &config.Config{
+		Emails:  append([]string(nil), set.Emails...),
+		Filters: make([]config.Filter, 0, len(set.Filters)),
+	}
+
+	names := make(map[string]int)
+	for i, f := range set.Filters {
+		conditions, err := conditionsFromFilter(f)
+		if err != nil {
+			return nil, fmt.Errorf("filter %d: %w", i+1, err)
+		}
+
+		actions := config.Actions{
+			Archive:        f.Archive,
+			MarkRead:       f.MarkRead,
+			Star:           f.Star,
+			NeverSpam:      f.NeverSpam,
+			Delete:         f.Trash,
+			MarkImportant:  f.MarkImportant,
+			NeverImportant: f.NeverImportant,
+			Category:       f.Category,
+			Forward:        f.ForwardTo,
+		}
+		var label string
+		switch len(f.Labels) {
+		case 0:
+		case 1:
+			label = f.Labels[0]
+			actions.Label = label
+		default:
+			label = f.Labels[0]
+			actions.Labels = append([]string(nil), f.Labels...)
+		}
+		cfg.Filters = append(cfg.Filters, config.Filter{
+			Name:       uniqueName(names, filterName(label, i)),
+			Conditions: conditions,
+			Actions:    actions,
+		})
+	}
+
+	return cfg, nil
+}
+
+// filterName derives a readable name for an imported filter
+func filterName(label string, index int) string {
+	if label != "" {
+		return label
+	}
+	return fmt.Sprintf("Filter %d", index+1)
+}
+
+// uniqueName disambiguates repeated names by numbering them
+func uniqueName(seen map[string]int, name string) string {
+	seen[name]++
+	if n := seen[name]; n > 1 {
+		return fmt.Sprintf("%s (%d)", name, n)
+	}
+	return name
+}
+
+// conditionsFromFilter maps a filter's fields and search terms onto
+// configured conditions
+func conditionsFromFilter(f *filter.Filter) (config.Conditions, error) {
+	conditions := config.Conditions{
+		From:    append([]string(nil), f.From...),
+		To:      append([]string(nil), f.To...),
+		Subject: append([]string(nil), f.Subject...),
+		HasNot:  append([]string(nil), f.DoesNotHaveWords...),
+	}
+	if f.Size != nil {
+		setSize(&conditions, f.Size.Operator, query.FormatSize(f.Size.Bytes))
+	}
+
+	for _, words := range f.HasWords {
+		n, err := query.Parse(words)
+		if err != nil {
+			return conditions, err
+		}
+		terms, ok := n.(query.And)
+		if !ok {
+			terms = query.And{n}
+		}
+		for _, term := range terms {
+			addTerm(&conditions, term)
+		}
+	}
+
+	return conditions, nil
+}
+
+// addTerm adds a single top-level search term to the conditions, using
+// the most specific field that expresses it
+func addTerm(conditions *config.Conditions, term query.Node) {
+	switch v := term.(type) {
+	case nil:
+		return
+	case query.Word:
+		if (v.Op == string(filter.Larger) || v.Op == string(filter.Smaller)) && !v.Phrase {
+			if setSize(conditions, filter.SizeOperator(v.Op), v.Value) {
+				return
+			}
+		}
+		if field, ok := structuredOperators[v.Op]; ok && len(*field(conditions)) == 0 {
+			*field(conditions) = []string{fieldValue(v)}
+			return
+		}
+	case query.Or:
+		if op, values, ok := sameOperator(v); ok {
+			if field, ok := structuredOperators[op]; ok && len(*field(conditions)) == 0 {
+				*field(conditions) = values
+				return
+			}
+		}
+		c := conditionFromQuery(v)
+		if conditions.Any == nil {
+			conditions.Any = c.Any
+		} else {
+			conditions.All = append(conditions.All, c)
+		}
+		return
+	case query.Not:
+		if _, ok := v.X.(query.Word); ok {
+			conditions.HasNot = append(conditions.HasNot, v.X.String())
+			return
+		}
+	}
+	conditions.Has = append(conditions.Has, term.String())
+}
+
+// setSize sets the size condition for op unless it is already set,
+// reporting whether it was set
+func setSize(conditions *config.Conditions, op filter.SizeOperator, value string) bool {
+	field := &conditions.Larger
+	if op == filter.Smaller {
+		field = &conditions.Smaller
+	}
+	if *field != "" {
+		return false
+	}
+	*field = value
+	return true
+}
+
+// sameOperator reports whether every alternative is a word with the same
+// operator, returning the operator and the values
+func sameOperator(alternatives query.Or) (string, []string, bool) {
+	var op string
+	values := make([]string, 0, len(alternatives))
+	for i, n := range alternatives {
+		w, ok := n.(query.Word)
+		if !ok || w.Op == "" || (i > 0 && w.Op != op) {
+			return "", nil, false
+		}
+		op = w.Op
+		values = append(values, fieldValue(w))
+	}
+	return op, values, true
+}
+
+// fieldValue returns the value of a word for a structured condition field,
+// keeping the quotes of an exact phrase
+func fieldValue(w query.Word) string {
+	if w.Phrase {
+		return `"` + w.Value + `"`
+	}
+	return w.Value
+}
+
+// conditionFromQuery converts a parsed query into a configured condition
+func conditionFromQuery(n query.Node) config.Condition {
+	switch v := n.(type) {
+	case query.And:
+		c := config.Condition{All: make([]config.Condition, 0, len(v))}
+		for _, child := range v {
+			c.All = append(c.All, conditionFromQuery(child))
+		}
+		return c
+	case query.Or:
+		c := config.Condition{Any: make([]config.Condition, 0, len(v))}
+		for _, child := range v {
+			c.Any = append(c.Any, conditionFromQuery(child))
+		}
+		return c
+	case query.Not:
+		if _, ok := v.X.(query.Word); ok {
+			return config.Condition{Term: n.String()}
+		}
+		x := conditionFromQuery(v.X)
+		return config.Condition{Not: &x}
+	default:
+		return config.Condition{Term: n.String()}
+	}
+}
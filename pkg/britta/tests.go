@@ -0,0 +1,150 @@
+package britta
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/brendanryan/gmail-brita/internal/config"
+	"github.com/brendanryan/gmail-brita/internal/query"
+	"github.com/brendanryan/gmail-brita/internal/simulate"
+)
+
+// TestResult is the outcome of one of a configuration's tests
+type TestResult struct {
+	Name string
+	// Matches names the filters that matched the test message
+	Matches []string
+	// Failures describes each way the outcome differed from the expected one
+	Failures []string
+}
+
+// Passed reports whether the test produced the expected outcome
+func (r TestResult) Passed() bool {
+	return len(r.Failures) == 0
+}
+
+// RunTests evaluates the configuration's tests against the filters it
+// generates. It also describes each filter left out of the tests because
+// its search terms cannot be evaluated without a mailbox, so callers can
+// report that it went unchecked.
+func RunTests(cfg *config.Config) ([]TestResult, []string, error) {
+	set, err := Build(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	sim, err := simulate.New(set)
+	if err != nil {
+		return nil, nil, err
+	}
+	var skipped []string
+	for _, s := range sim.Skipped() {
+		skipped = append(skipped, s.String())
+	}
+
+	results := make([]TestResult, 0, len(cfg.Tests))
+	for _, test := range cfg.Tests {
+		m := simulate.NewMessage(test.Headers, test.Body, test.Attachments)
+		if test.Size != "" {
+			if m.Size, err = query.ParseSize(test.Size); err != nil {
+				return nil, nil, fmt.Errorf("test %q: %w", test.Name, err)
+			}
+		}
+
+		outcome := sim.Run(m)
+		result := TestResult{
+			Name:     test.Name,
+			Matches:  make([]string, 0, len(outcome.Matches)),
+			Failures: checkExpect(test.Expect, outcome.State),
+		}
+		for _, match := range outcome.Matches {
+			name := match.Name
+			if name == "" {
+				name = fmt.Sprintf("filter %d", match.Index)
+			}
+			result.Matches = append(result.Matches, name)
+		}
+		results = append(results, result)
+	}
+	return results, skipped, nil
+}
+
+// checkExpect compares the state of a message with the expected outcome
+func checkExpect(want config.Expect, got simulate.State) []string {
+	var failures []string
+
+	if want.Labels != nil {
+		wantLabels := sortedCopy(want.Labels)
+		gotLabels := sortedCopy(got.Labels)
+		if strings.Join(wantLabels, "\n") != strings.Join(gotLabels, "\n") {
+			failures = append(failures, fmt.Sprintf("labels: got %s, want %s", listOrNone(gotLabels), listOrNone(wantLabels)))
+		}
+	}
+
+	for _, flag := range []struct {
+		name string
+		want *bool
+		got  bool
+	}{
+		{"archive", want.Archive, got.Archived},
+		{"mark_read", want.MarkRead, got.Read},
+		{"star", want.Star, got.Starred},
+		{"never_spam", want.NeverSpam, got.NeverSpam},
+		{"delete", want.Delete, got.Trashed},
+		{"mark_important", want.MarkImportant, got.Important},
+		{"never_important", want.NeverImportant, got.NeverImportant},
+	} {
+		if flag.want != nil && *flag.want != flag.got {
+			failures = append(failures, fmt.Sprintf("%s: got %t, want %t", flag.name, flag.got, *flag.want))
+		}
+	}
+
+	if want.Category != nil && *want.Category != got.Category {
+		failures = append(failures, fmt.Sprintf("category: got %q, want %q", got.Category, *want.Category))
+	}
+	if want.Forward != nil {
+		forwarded := strings.Join(got.ForwardedTo, ", ")
+		if *want.Forward != forwarded {
+			failures = append(failures, fmt.Sprintf("forward: got %q, want %q", forwarded, *want.Forward))
+		}
+	}
+
+	return failures
+}
+
+func sortedCopy(list []string) []string {
+	out := append([]string(nil), list...)
+	sort.Strings(out)
+	return out
+}
+
+func listOrNone(list []string) string {
+	if len(list) == 0 {
+		return "(none)"
+	}
+	return strings.Join(list, ", ")
+}
+
+// WriteTestResults writes a readable report of test results, detailing
+// each failure along with the filters that matched
+func WriteTestResults(w io.Writer, results []TestResult) error {
+	var b strings.Builder
+	failed := 0
+	for _, r := range results {
+		if r.Passed() {
+			fmt.Fprintf(&b, "PASS %s\n", r.Name)
+			continue
+		}
+		failed++
+		fmt.Fprintf(&b, "FAIL %s\n", r.Name)
+		for _, f := range r.Failures {
+			fmt.Fprintf(&b, "    %s\n", f)
+		}
+		fmt.Fprintf(&b, "    matched: %s\n", listOrNone(r.Matches))
+	}
+	fmt.Fprintf(&b, "\n%d passed, %d failed\n", len(results)-failed, failed)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
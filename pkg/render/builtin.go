@@ -0,0 +1,69 @@
+package render
+
+import "github.com/brendanryan/gmail-brita/internal/filter"
+
+// Names of the built-in renderers
+const (
+	XML         = "xml"
+	Sieve       = "sieve"
+	GmailJSON   = "gmail-json"
+	Exchange    = "exchange"
+	GraphJSON   = "graph-json"
+	Thunderbird = "thunderbird"
+)
+
+func init() {
+	Register(xmlRenderer{})
+	Register(sieveRenderer{})
+	Register(GmailAPI{})
+	Register(exchangeRenderer{})
+	Register(graphRenderer{})
+	Register(ThunderbirdFilters{})
+}
+
+// xmlRenderer writes Gmail's filter export format
+type xmlRenderer struct{}
+
+// Name implements Renderer
+func (xmlRenderer) Name() string { return XML }
+
+// Extension implements Renderer
+func (xmlRenderer) Extension() string { return ".xml" }
+
+// Render implements Renderer, writing the set as ToXML does
+func (xmlRenderer) Render(set *Set) ([]byte, error) {
+	return set.ToXML()
+}
+
+// Warnings implements Warner, reporting the filters over Gmail's limits
+// unless the set's policy already makes rendering fail for them
+func (xmlRenderer) Warnings(set *Set) []error {
+	return limitWarnings(set)
+}
+
+// sieveRenderer writes a Sieve script
+type sieveRenderer struct{}
+
+// Name implements Renderer
+func (sieveRenderer) Name() string { return Sieve }
+
+// Extension implements Renderer
+func (sieveRenderer) Extension() string { return ".sieve" }
+
+// Render implements Renderer, writing the set as ToSieve does
+func (sieveRenderer) Render(set *Set) ([]byte, error) {
+	return set.ToSieve()
+}
+
+// limitWarnings returns the limits a set exceeds when its policy does not
+// turn them into errors
+func limitWarnings(set *Set) []error {
+	if set.Limits == filter.LimitFail {
+		return nil
+	}
+	var warnings []error
+	for _, e := range set.CheckLimits() {
+		warnings = append(warnings, e)
+	}
+	return warnings
+}
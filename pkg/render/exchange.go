@@ -0,0 +1,77 @@
+package render
+
+import (
+	"encoding/json"
+
+	"github.com/brendanryan/gmail-brita/internal/exchange"
+)
+
+// exchangeRenderer writes an Exchange Online PowerShell script of
+// New-InboxRule commands
+type exchangeRenderer struct{}
+
+// Name implements Renderer
+func (exchangeRenderer) Name() string { return Exchange }
+
+// Extension implements Renderer
+func (exchangeRenderer) Extension() string { return ".ps1" }
+
+// Render implements Renderer
+func (exchangeRenderer) Render(set *Set) ([]byte, error) {
+	rules, unsupported, err := exchange.Convert(set)
+	if err != nil {
+		return nil, err
+	}
+	return exchange.PowerShell(rules, unsupported), nil
+}
+
+// Warnings implements Warner, reporting the parts of filters that have no
+// inbox rule equivalent
+func (exchangeRenderer) Warnings(set *Set) []error {
+	return exchangeWarnings(set)
+}
+
+// graphRenderer writes a JSON array of Microsoft Graph messageRule resources
+type graphRenderer struct{}
+
+// Name implements Renderer
+func (graphRenderer) Name() string { return GraphJSON }
+
+// Extension implements Renderer
+func (graphRenderer) Extension() string { return ".json" }
+
+// Render implements Renderer
+func (graphRenderer) Render(set *Set) ([]byte, error) {
+	rules, _, err := exchange.Convert(set)
+	if err != nil {
+		return nil, err
+	}
+	if rules == nil {
+		rules = []exchange.Rule{}
+	}
+	data, err := json.MarshalIndent(rules, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// Warnings implements Warner, reporting the parts of filters that have no
+// inbox rule equivalent
+func (graphRenderer) Warnings(set *Set) []error {
+	return exchangeWarnings(set)
+}
+
+// exchangeWarnings reports the parts of filters that have no inbox rule
+// equivalent
+func exchangeWarnings(set *Set) []error {
+	_, unsupported, err := exchange.Convert(set)
+	if err != nil {
+		return nil
+	}
+	warnings := make([]error, 0, len(unsupported))
+	for _, u := range unsupported {
+		warnings = append(warnings, u)
+	}
+	return warnings
+}
@@ -0,0 +1,40 @@
+package render
+
+import (
+	"encoding/json"
+
+	"github.com/brendanryan/gmail-brita/internal/gmail"
+)
+
+// GmailAPI writes the filters as a JSON array of Gmail API filter resources,
+// as users.settings.filters.create takes them, for scripting with GAM or
+// the API directly. Each filter has at most one label, as in Gmail's XML.
+type GmailAPI struct {
+	// LabelIDs maps label names to the IDs of the mailbox's labels. Labels
+	// missing from it are written by name.
+	LabelIDs map[string]string
+}
+
+// Name implements Renderer
+func (GmailAPI) Name() string { return GmailJSON }
+
+// Extension implements Renderer
+func (GmailAPI) Extension() string { return ".json" }
+
+// Render implements Renderer
+func (r GmailAPI) Render(set *Set) ([]byte, error) {
+	filters, err := gmail.ConvertSet(set, r.LabelIDs)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(filters, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// Warnings implements Warner, reporting the filters over Gmail's limits
+func (GmailAPI) Warnings(set *Set) []error {
+	return limitWarnings(set)
+}
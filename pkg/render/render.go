@@ -0,0 +1,91 @@
+// Package render turns filter sets into the files mail systems import.
+// Gmail's XML and Sieve renderers are built in, and other programs can add
+// their own with Register.
+package render
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/brendanryan/gmail-brita/internal/filter"
+)
+
+// Set is the filter set a renderer receives, as returned by britta.Build
+type Set = filter.Set
+
+// Filter is a single filter in a Set
+type Filter = filter.Filter
+
+// Renderer writes a filter set in one output format
+type Renderer interface {
+	// Name identifies the format, as given to the -format flag
+	Name() string
+	// Extension is the usual file extension of the output, including the
+	// leading dot
+	Extension() string
+	// Render returns the set in the renderer's format
+	Render(set *Set) ([]byte, error)
+}
+
+// Warner is implemented by renderers that can report problems with a set
+// that do not stop it rendering, such as filters over Gmail's limits
+type Warner interface {
+	Warnings(set *Set) []error
+}
+
+var (
+	mu        sync.RWMutex
+	renderers = make(map[string]Renderer)
+)
+
+// Register makes a renderer available by name. It panics when the name is
+// empty or already registered.
+func Register(r Renderer) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	name := r.Name()
+	if name == "" {
+		panic("render: Register called with an unnamed renderer")
+	}
+	if _, ok := renderers[name]; ok {
+		panic(fmt.Sprintf("render: Register called twice for %q", name))
+	}
+	renderers[name] = r
+}
+
+// Lookup returns the renderer registered under name
+func Lookup(name string) (Renderer, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	r, ok := renderers[name]
+	return r, ok
+}
+
+// ForExtension returns the renderer whose output uses the file extension,
+// ignoring case. The first by name wins when several share an extension.
+func ForExtension(ext string) (Renderer, bool) {
+	for _, name := range Names() {
+		r, _ := Lookup(name)
+		if strings.EqualFold(r.Extension(), ext) {
+			return r, true
+		}
+	}
+	return nil, false
+}
+
+// Names lists the registered renderers in order
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	names := make([]string, 0, len(renderers))
+	for name := range renderers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
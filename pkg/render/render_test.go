@@ -0,0 +1,150 @@
+package render
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/brendanryan/gmail-brita/internal/filter"
+)
+
+type testRenderer struct{}
+
+func (testRenderer) Name() string      { return "test" }
+func (testRenderer) Extension() string { return ".TXT" }
+
+func (testRenderer) Render(set *Set) ([]byte, error) {
+	names := make([]string, 0, len(set.Filters))
+	for _, f := range set.Filters {
+		names = append(names, f.Name)
+	}
+	return []byte(strings.Join(names, "\n")), nil
+}
+
+func TestRegistry(t *testing.T) {
+	Register(testRenderer{})
+	defer func() {
+		mu.Lock()
+		delete(renderers, "test")
+		mu.Unlock()
+	}()
+
+	if got := strings.Join(Names(), ","); got != "exchange,gmail-json,graph-json,sieve,test,thunderbird,xml" {
+		t.Errorf("Names() = %s", got)
+	}
+	if r, ok := Lookup("test"); !ok || r.Name() != "test" {
+		t.Errorf("Lookup(test) = %v, %v", r, ok)
+	}
+	if _, ok := Lookup("yaml"); ok {
+		t.Error("Lookup(yaml) found a renderer")
+	}
+
+	for ext, want := range map[string]string{".xml": XML, ".sieve": Sieve, ".json": GmailJSON, ".ps1": Exchange, ".dat": Thunderbird, ".txt": "test", ".yaml": ""} {
+		r, ok := ForExtension(ext)
+		if want == "" {
+			if ok {
+				t.Errorf("ForExtension(%s) = %s, want none", ext, r.Name())
+			}
+			continue
+		}
+		if !ok || r.Name() != want {
+			t.Errorf("ForExtension(%s) = %v, want %s", ext, r, want)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a name twice did not panic")
+		}
+	}()
+	Register(testRenderer{})
+}
+
+func TestBuiltins(t *testing.T) {
+	set := filter.NewFilterSet([]string{"me@example.com"})
+	filter.NewBuilder(set).Name("Robots").
+		From([]string{"robot@example.com"}).
+		Label("robots")
+	filter.NewBuilder(set).Name("Blocked").
+		From(strings.Split(strings.Repeat("spammer@example.com ", 100), " ")[:100]).
+		Trash()
+
+	for name, want := range map[string]string{
+		XML:       `<apps:property name="label" value="robots">`,
+		Sieve:     `fileinto :copy :create "robots"`,
+		Exchange:  `-CopyToFolder ($Mailbox + ':\robots')`,
+		GraphJSON: `"copyToFolder": "robots"`,
+		GmailJSON: `"addLabelIds": [
+        "robots"
+      ]`,
+	} {
+		r, _ := Lookup(name)
+		out, err := r.Render(set)
+		if err != nil {
+			t.Fatalf("%s Render() error = %v", name, err)
+		}
+		if !strings.Contains(string(out), want) {
+			t.Errorf("%s output missing %q:\n%s", name, want, out)
+		}
+	}
+
+	r, _ := Lookup(XML)
+	if warnings := r.(Warner).Warnings(set); len(warnings) != 1 {
+		t.Errorf("Warnings() = %v, want the Blocked filter over the query limit", warnings)
+	}
+	set.Limits = filter.LimitFail
+	if warnings := r.(Warner).Warnings(set); len(warnings) != 0 {
+		t.Errorf("Warnings() with LimitFail = %v, want none", warnings)
+	}
+	if _, err := r.Render(set); err == nil {
+		t.Error("Render() with LimitFail succeeded")
+	}
+}
+
+func TestGmailAPI(t *testing.T) {
+	set := filter.NewFilterSet([]string{"me@example.com"})
+	filter.NewBuilder(set).Name("Invoices").
+		From([]string{"billing@example.com"}).
+		Has([]string{"has:attachment", "invoice"}).
+		Label("finance").
+		Archive()
+	filter.NewBuilder(set).Name("Big").
+		Larger(10 * 1024 * 1024).
+		Star()
+
+	out, err := GmailAPI{LabelIDs: map[string]string{"finance": "Label_7"}}.Render(set)
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	want := `[
+  {
+    "criteria": {
+      "from": "billing@example.com",
+      "query": "invoice",
+      "hasAttachment": true
+    },
+    "action": {
+      "addLabelIds": [
+        "Label_7"
+      ],
+      "removeLabelIds": [
+        "INBOX"
+      ]
+    }
+  },
+  {
+    "criteria": {
+      "size": 10485760,
+      "sizeComparison": "larger"
+    },
+    "action": {
+      "addLabelIds": [
+        "STARRED"
+      ]
+    }
+  }
+]
+`
+	if string(out) != want {
+		t.Errorf("Render() =\n%s\nwant\n%s", out, want)
+	}
+}
@@ -0,0 +1,40 @@
+package render
+
+import (
+	"github.com/brendanryan/gmail-brita/internal/thunderbird"
+)
+
+// ThunderbirdFilters writes Thunderbird's msgFilterRules.dat for reading
+// Gmail over IMAP
+type ThunderbirdFilters struct {
+	// Account is the URI of the IMAP account whose folders labels are
+	// copied and moved to, such as imap://me%40gmail.com@imap.gmail.com.
+	// Rendering filters that apply labels or archive fails without it.
+	Account string
+}
+
+// Name implements Renderer
+func (ThunderbirdFilters) Name() string { return Thunderbird }
+
+// Extension implements Renderer
+func (ThunderbirdFilters) Extension() string { return ".dat" }
+
+// Render implements Renderer
+func (r ThunderbirdFilters) Render(set *Set) ([]byte, error) {
+	data, _, err := thunderbird.Write(set, r.Account)
+	return data, err
+}
+
+// Warnings implements Warner, reporting the parts of filters that have no
+// Thunderbird equivalent
+func (r ThunderbirdFilters) Warnings(set *Set) []error {
+	_, unsupported, err := thunderbird.Write(set, r.Account)
+	if err != nil {
+		return nil
+	}
+	warnings := make([]error, 0, len(unsupported))
+	for _, u := range unsupported {
+		warnings = append(warnings, u)
+	}
+	return warnings
+}